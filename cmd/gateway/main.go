@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ForLina/sxc_contract/gateway"
+	"github.com/ForLina/sxc_contract/gateway/mock"
+)
+
+// 启动 Sxc 的 REST 网关
+// 客户端列表文件中的每个令牌对应一个客户端 请求需要携带 Authorization: Bearer <token>
+// 链码看到的调用者始终是网关用户 -msp-id/-cert 的组织需要只拥有网关客户端允许的角色
+// 范例 go run ./cmd/gateway -backend mock -clients clients.json
+// 范例 go run ./cmd/gateway -clients clients.json -backend fabric -peer localhost:7051 -tls-cert tls/ca.crt -msp-id Org1MSP -cert user/cert.pem -key user/key.pem
+func main() {
+	addr := flag.String("addr", ":8080", "监听地址")
+	backend := flag.String("backend", "mock", "链码后端 mock/fabric")
+	mspID := flag.String("msp-id", "Org1MSP", "网关使用的MSP ID")
+	governance := flag.String("governance", "", "mock 后端的治理组织列表 逗号分隔 为空时使用 -msp-id")
+	clientsPath := flag.String("clients", "", "客户端列表文件 格式参考 gateway.LoadClients")
+
+	config := gateway.FabricConfig{}
+	flag.StringVar(&config.PeerEndpoint, "peer", "localhost:7051", "节点的 gateway 服务地址")
+	flag.StringVar(&config.ServerName, "server-name", "", "节点TLS证书中的主机名")
+	flag.StringVar(&config.TLSCertPath, "tls-cert", "", "节点的TLS CA证书")
+	flag.StringVar(&config.CertPath, "cert", "", "网关用户的证书")
+	flag.StringVar(&config.KeyPath, "key", "", "网关用户的私钥")
+	flag.StringVar(&config.Channel, "channel", "mychannel", "通道名称")
+	flag.StringVar(&config.Chaincode, "chaincode", "sxc", "链码名称")
+	flag.Parse()
+
+	if *clientsPath == "" {
+		fmt.Println("需要通过 -clients 指定客户端列表")
+		os.Exit(1)
+	}
+	clients, err := gateway.LoadClients(*clientsPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var b gateway.Backend
+	var fabric *gateway.FabricBackend
+	switch *backend {
+	case "mock":
+		governanceMSPs := []string{}
+		if *governance != "" {
+			governanceMSPs = strings.Split(*governance, ",")
+		}
+
+		mockBackend, err := mock.NewBackend(*mspID, governanceMSPs)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		b = mockBackend
+	case "fabric":
+		config.MSPID = *mspID
+		fabric, err = gateway.NewFabricBackend(config)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		b = fabric
+	default:
+		fmt.Printf("未知的后端 %s\n", *backend)
+		os.Exit(1)
+	}
+
+	log.Printf("sxc gateway 后端 %s 客户端 %d 个", *backend, len(clients))
+	err = serve(*addr, gateway.NewServer(b, clients))
+	// 连接在退出前关闭 os.Exit 不会执行 defer
+	if fabric != nil {
+		fabric.Close()
+	}
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+// 监听直到收到中断或终止信号 之后等待处理中的请求完成再返回
+func serve(addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("sxc gateway 监听 %s", addr)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("sxc gateway 正在退出")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/ForLina/sxc_contract/scenario"
+)
+
+// 先重放已保存的回归用例 再随机生成交易序列检查资金不变量
+// 发现失败的序列时缩小后保存为新的回归用例 并以状态码1退出
+// 范例 go run ./cmd/invariants -runs 500 -steps 40
+func main() {
+	dir := flag.String("regressions", "scenario/regressions", "回归用例所在的目录")
+	runs := flag.Int("runs", 200, "随机序列的数量")
+	steps := flag.Int("steps", 30, "每个序列的交易数量")
+	seed := flag.Int64("seed", 0, "随机种子 为0时使用当前时间")
+	save := flag.Bool("save", true, "是否保存缩小后的失败序列")
+	flag.Parse()
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	regressions, err := scenario.LoadRegressions(*dir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, regression := range regressions {
+		violation, err := scenario.CheckSequence(regression.Operations)
+		if err != nil {
+			fmt.Printf("FAIL %s: %s\n", regression.Name, err)
+			failed = true
+		} else if violation != nil {
+			fmt.Printf("FAIL %s: %s\n", regression.Name, violation)
+			failed = true
+		} else {
+			fmt.Printf("ok   %s\n", regression.Name)
+		}
+	}
+
+	for run := 0; run < *runs; run++ {
+		runSeed := *seed + int64(run)
+		operations := scenario.Generate(rand.New(rand.NewSource(runSeed)), *steps)
+
+		violation, err := scenario.CheckSequence(operations)
+		if err != nil {
+			fmt.Printf("FAIL seed %d: %s\n", runSeed, err)
+			os.Exit(1)
+		}
+		if violation == nil {
+			continue
+		}
+
+		fmt.Printf("FAIL seed %d: %s\n", runSeed, violation)
+		minimized, err := scenario.Minimize(operations, violation.Invariant)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		// 记录缩小后的序列实际破坏不变量时的信息
+		violation, err = scenario.CheckSequence(minimized)
+		if err != nil || violation == nil {
+			fmt.Printf("FAIL seed %d: 缩小后的序列无法复现 %v\n", runSeed, err)
+			os.Exit(1)
+		}
+
+		for _, operation := range minimized {
+			fmt.Printf("     %s %v\n", operation.Function, operation.Args)
+		}
+
+		if *save {
+			path, err := scenario.SaveRegression(*dir, scenario.Regression{
+				Name:       fmt.Sprintf("%s_%d", violation.Invariant, runSeed),
+				Invariant:  violation.Invariant,
+				Message:    violation.Err.Error(),
+				Seed:       runSeed,
+				Operations: minimized,
+			})
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("     saved %s\n", path)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d regressions, %d random sequences of %d steps, seed %d\n", len(regressions), *runs, *steps, *seed)
+	if failed {
+		os.Exit(1)
+	}
+}
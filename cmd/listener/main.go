@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/ForLina/sxc_contract/gateway"
+	"github.com/ForLina/sxc_contract/projection"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 消费 Sxc 的链码事件 维护链下的投影数据库
+// 连接节点时持续运行 事件流断开后从检查点重新订阅 读取区块文件时读完即退出
+// 连接节点时没有检查点的投影先从账本当前状态初始化 区块文件没有账本状态 只能从创世区块开始
+// -rebuild 清空投影后从创世区块重放 -reseed 清空投影后从账本当前状态初始化 只能连接节点时使用
+// 投影与事件不一致时重试也不会成功 直接退出 需要用 -reseed 重建
+// 范例 go run ./cmd/listener -blocks sxc.blocks -dsn sxc_projection.db -summary
+// 范例 go run ./cmd/listener -driver postgres -dsn postgres://sxc@localhost/sxc -peer localhost:7051 -tls-cert tls/ca.crt -cert user/cert.pem -key user/key.pem
+func main() {
+	driver := flag.String("driver", "sqlite3", "数据库驱动 sqlite3/postgres")
+	dsn := flag.String("dsn", "sxc_projection.db", "数据库连接串")
+	blocks := flag.String("blocks", "", "sxcctl 生成的区块文件 设置时代替节点")
+	rebuild := flag.Bool("rebuild", false, "清空投影后从创世区块重放全部事件")
+	reseed := flag.Bool("reseed", false, "清空投影后从账本当前状态初始化 只能连接节点时使用")
+	summary := flag.Bool("summary", false, "读取区块文件之后输出汇总")
+
+	config := gateway.FabricConfig{}
+	flag.StringVar(&config.PeerEndpoint, "peer", "localhost:7051", "节点的 gateway 服务地址")
+	flag.StringVar(&config.ServerName, "server-name", "", "节点TLS证书中的主机名")
+	flag.StringVar(&config.TLSCertPath, "tls-cert", "", "节点的TLS CA证书")
+	flag.StringVar(&config.MSPID, "msp-id", "Org1MSP", "监听使用的MSP ID")
+	flag.StringVar(&config.CertPath, "cert", "", "用户的证书")
+	flag.StringVar(&config.KeyPath, "key", "", "用户的私钥")
+	flag.StringVar(&config.Channel, "channel", "mychannel", "通道名称")
+	flag.StringVar(&config.Chaincode, "chaincode", "sxc", "链码名称")
+	flag.Parse()
+
+	mode := projection.Resume
+	switch {
+	case *rebuild && *reseed:
+		fmt.Println("-rebuild 和 -reseed 只能选一个")
+		os.Exit(1)
+	case *reseed && *blocks != "":
+		fmt.Println("区块文件没有账本状态 不能使用 -reseed")
+		os.Exit(1)
+	case *rebuild:
+		mode = projection.RebuildFromGenesis
+	case *reseed:
+		mode = projection.RebuildFromSnapshot
+	}
+
+	store, err := projection.Open(*driver, *dsn)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *blocks != "" {
+		listener := projection.NewListener(projection.NewBlockFileSource(*blocks, config.Chaincode), store)
+		applied, err := listener.Run(ctx, mode)
+		fmt.Printf("处理了 %d 个事件\n", applied)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if *summary {
+			printSummary(store)
+		}
+		return
+	}
+
+	backend, err := gateway.NewFabricBackend(config)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer backend.Close()
+
+	listener := projection.NewListener(projection.NewFabricSource(backend.Network(), config.Chaincode), store)
+	for {
+		applied, err := listener.Run(ctx, mode)
+		fmt.Printf("处理了 %d 个事件 %v\n", applied, err)
+		if ctx.Err() != nil {
+			return
+		}
+
+		var inconsistentError *projection.InconsistentError
+		if errors.As(err, &inconsistentError) {
+			os.Exit(1)
+		}
+
+		// 重建只做一次 之后从检查点继续
+		mode = projection.Resume
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func printSummary(store *projection.Store) {
+	totals, err := store.HospitalTotals()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, total := range totals {
+		fmt.Printf("医院 %s 申请 %d 募集 %v 贷款 %v 充值 %v\n", total.HospitalCode, total.Applications, total.AmountRaised, total.LoanTotal, total.RechargeTotal)
+	}
+
+	counts, err := store.StateCounts()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	states := []int{}
+	for state := range counts {
+		states = append(states, state)
+	}
+	sort.Ints(states)
+	for _, state := range states {
+		fmt.Printf("状态 %d 申请 %d\n", state, counts[state])
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/sample"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// main function starts up the chaincode in the container during instantiate
+func main() {
+	if err := shim.Start(new(sample.SimpleAsset)); err != nil {
+		fmt.Printf("Error starting SimpleAsset chaincode: %s", err)
+	}
+}
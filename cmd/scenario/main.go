@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/scenario"
+)
+
+// 回放场景文件 有失败的场景时以状态码1退出
+// 范例 go run ./cmd/scenario -dir scenario/scenarios -run sxc
+func main() {
+	dir := flag.String("dir", "scenario/scenarios", "场景文件所在的目录")
+	filter := flag.String("run", "", "只运行名称中包含此内容的场景")
+	verbose := flag.Bool("v", false, "输出每个步骤的结果")
+	flag.Parse()
+
+	scenarios, err := scenario.LoadDir(*dir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	total := 0
+	for _, s := range scenarios {
+		if !strings.Contains(s.Name, *filter) {
+			continue
+		}
+		total++
+
+		result := scenario.Run(s)
+		if result.Failed() {
+			failed++
+			fmt.Printf("FAIL %s\n", result.Scenario)
+		} else {
+			fmt.Printf("ok   %s (%d steps)\n", result.Scenario, len(result.Steps))
+		}
+
+		if result.Err != nil {
+			fmt.Printf("     %s\n", result.Err)
+		}
+		for _, step := range result.Steps {
+			if step.Err != nil {
+				fmt.Printf("     FAIL %s: %s\n", step.Name, step.Err)
+			} else if *verbose {
+				fmt.Printf("     ok   %s\n", step.Name)
+			}
+		}
+	}
+
+	fmt.Printf("%d/%d scenarios passed\n", total-failed, total)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
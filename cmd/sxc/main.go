@@ -0,0 +1,23 @@
+//go:build !legacy
+// +build !legacy
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/sxc/contract"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func main() {
+	chaincode, err := contractapi.NewChaincode(contract.NewSxcContract())
+	if err != nil {
+		fmt.Printf("Error creating Sxc chaincode: %s", err)
+		return
+	}
+
+	if err := chaincode.Start(); err != nil {
+		fmt.Printf("Error starting Sxc chaincode: %s", err)
+	}
+}
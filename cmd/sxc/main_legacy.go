@@ -0,0 +1,18 @@
+//go:build legacy
+// +build legacy
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 使用 -tags legacy 构建时 仍然以 shim 的方式启动 参数为字符串数组
+func main() {
+	if err := shim.Start(new(sxc.Sxc)); err != nil {
+		fmt.Printf("Error starting Sxc chaincode: %s", err)
+	}
+}
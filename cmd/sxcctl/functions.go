@@ -0,0 +1,212 @@
+package main
+
+// 函数的一个参数 按顺序对应链码参数列表中的一项
+type param struct {
+	Name     string // 命令行参数名
+	Usage    string // 说明
+	Optional bool   // 可选参数 为空时不传入 后面的可选参数也不再传入
+}
+
+// 函数的参数表
+type function struct {
+	Query  bool // 只读的函数 默认使用 query 调用
+	Params []param
+}
+
+var applicationNumber = param{Name: "application-number", Usage: "申请编号"}
+
+var pollID = param{Name: "poll-id", Usage: "投票ID"}
+
+// 各链码的函数参数表 与函数注释中的入参列表一致
+var functions = map[string]map[string]function{
+	"sxc": {
+		"applicate": {Params: []param{
+			applicationNumber,
+			{Name: "name", Usage: "申请者姓名"},
+			{Name: "id", Usage: "申请者身份证号"},
+			{Name: "hospital-code", Usage: "医院编号"},
+			{Name: "department-code", Usage: "科室编号"},
+			{Name: "street-office-code", Usage: "街道办编号"},
+			{Name: "card-number", Usage: "就诊卡号"},
+			{Name: "desc-md5", Usage: "病情描述的md5"},
+			{Name: "need-amount", Usage: "资金需求"},
+		}},
+		"hVerify": {Params: []param{
+			applicationNumber,
+			{Name: "operator", Usage: "审核人员姓名"},
+			{Name: "agree", Usage: "是否同意 0不同意 1同意"},
+			{Name: "approve-amount", Usage: "同意的金额"},
+			{Name: "attachments", Usage: "附件列表 json"},
+		}},
+		"donate": {Params: []param{
+			applicationNumber,
+			{Name: "donator", Usage: "捐赠者姓名 非公开模式下为空"},
+			{Name: "amount", Usage: "捐赠金额"},
+			{Name: "serial-number", Usage: "业务流水号"},
+			{Name: "platform-id", Usage: "捐赠者的平台ID 非公开模式下为空"},
+			{Name: "privacy", Usage: "隐私模式 public/pseudonymous/anonymous", Optional: true},
+		}},
+		"getRaised": {Query: true, Params: []param{applicationNumber}},
+		"loan": {Params: []param{
+			applicationNumber,
+			{Name: "amount", Usage: "贷款金额"},
+			{Name: "loan-number", Usage: "贷款单号"},
+			{Name: "first-repayment", Usage: "第一次还款的月份"},
+			{Name: "total-month", Usage: "总共需要还款多少期"},
+			{Name: "bank", Usage: "放款银行编号", Optional: true},
+		}},
+		"receivedLoan": {Params: []param{
+			applicationNumber,
+			{Name: "loan-number", Usage: "贷款单号"},
+			{Name: "loan-counter", Usage: "贷款计数器"},
+			{Name: "serial-number", Usage: "放款入账流水号"},
+		}},
+		"repay": {Params: []param{
+			applicationNumber,
+			{Name: "loan-number", Usage: "贷款单号"},
+			{Name: "loan-counter", Usage: "贷款计数器"},
+			{Name: "serial-number", Usage: "还款流水号"},
+		}},
+		"setCheat": {Params: []param{applicationNumber}},
+		"recharge": {Params: []param{
+			applicationNumber,
+			{Name: "serial-number", Usage: "充值流水号"},
+			{Name: "amount", Usage: "充值金额"},
+		}},
+		"getApplicationInfo": {Query: true, Params: []param{applicationNumber}},
+		"getApplications": {Query: true, Params: []param{
+			{Name: "page-size", Usage: "每页返回的申请数量 0表示不分页"},
+			{Name: "bookmark", Usage: "上一页返回的书签"},
+		}},
+		"getDonationReceipt": {Query: true, Params: []param{
+			{Name: "receipt-id", Usage: "回执编号"},
+		}},
+		"verifyDonationReceipt": {Query: true, Params: []param{
+			{Name: "receipt", Usage: "回执 json 即 getDonationReceipt 的返回值"},
+			{Name: "platform-id", Usage: "捐赠者平台ID", Optional: true},
+			{Name: "salt", Usage: "捐赠时使用的盐", Optional: true},
+		}},
+		"getDonations": {Query: true, Params: []param{applicationNumber}},
+		"setRoles": {Params: []param{
+			{Name: "roles", Usage: "角色配置 json"},
+		}},
+		"getFundFlowReport": {Query: true, Params: []param{
+			applicationNumber,
+			{Name: "format", Usage: "输出格式 json/csv", Optional: true},
+		}},
+		"auditApplication":      {Query: true, Params: []param{applicationNumber}},
+		"repairApplication":     {Params: []param{applicationNumber}},
+		"getApplicationHistory": {Query: true, Params: []param{applicationNumber}},
+		"getLoanHistory": {Query: true, Params: []param{
+			applicationNumber,
+			{Name: "loan-counter", Usage: "贷款计数器"},
+		}},
+		"migrate": {Params: []param{
+			{Name: "page-size", Usage: "每页处理的键数量 0表示不分页"},
+			{Name: "bookmark", Usage: "上一页返回的书签"},
+			{Name: "dry-run", Usage: "只报告需要修改的文档 true/false"},
+		}},
+		"setCoveragePolicy": {Params: []param{
+			{Name: "policy", Usage: "覆盖策略 json"},
+		}},
+		"getCoveragePolicy": {Query: true},
+		"getLoanCapacity": {Query: true, Params: []param{
+			applicationNumber,
+			{Name: "bank", Usage: "放款银行编号", Optional: true},
+		}},
+		"executeProposal": {Params: []param{
+			{Name: "proposal-id", Usage: "提案ID"},
+		}},
+		"getParameterHistory": {Query: true, Params: []param{
+			{Name: "parameter", Usage: "参数名 coverage/roles"},
+		}},
+	},
+	"vote": {
+		"createPoll": {Params: []param{
+			{Name: "poll", Usage: "投票定义 json"},
+		}},
+		"getPoll": {Query: true, Params: []param{pollID}},
+		"listPolls": {Query: true, Params: []param{
+			{Name: "status", Usage: "投票状态 pending/open/closed", Optional: true},
+		}},
+		"voteUser": {Params: []param{
+			pollID,
+			{Name: "username", Usage: "被投票的用户 ranked/approval 可以传候选人数组 json"},
+		}},
+		"getUserVote": {Query: true, Params: []param{
+			pollID,
+			{Name: "page-size", Usage: "每页的候选人数量 0 表示不分页", Optional: true},
+			{Name: "bookmark", Usage: "上一页返回的 bookmark", Optional: true},
+			{Name: "order", Usage: "排序方式 candidate/votes", Optional: true},
+		}},
+		"getTopCandidates": {Query: true, Params: []param{
+			pollID,
+			{Name: "n", Usage: "候选人数量"},
+		}},
+		"getCandidateVote": {Query: true, Params: []param{
+			pollID,
+			{Name: "username", Usage: "候选人"},
+		}},
+		"registerCandidate": {Params: []param{
+			pollID,
+			{Name: "candidate", Usage: "候选人信息 json"},
+		}},
+		"approveCandidate": {Params: []param{
+			pollID,
+			{Name: "candidate-id", Usage: "候选人ID"},
+			{Name: "agree", Usage: "是否同意 0不同意 1同意"},
+		}},
+		"listCandidates": {Query: true, Params: []param{
+			pollID,
+			{Name: "status", Usage: "审核状态 pending/approved/rejected", Optional: true},
+		}},
+		"setVoterWeights": {Params: []param{
+			pollID,
+			{Name: "weights", Usage: "投票者到权重的映射 json"},
+		}},
+		"finalizePoll": {Params: []param{pollID}},
+		"getResult":    {Query: true, Params: []param{pollID}},
+		"getBallot": {Query: true, Params: []param{
+			pollID,
+			{Name: "voter", Usage: "投票者 默认为调用者自己", Optional: true},
+		}},
+		"commitVote": {Params: []param{
+			pollID,
+			{Name: "hash", Usage: "选票内容和盐的sha256 十六进制"},
+		}},
+		"revealVote": {Params: []param{
+			pollID,
+			{Name: "choice", Usage: "选票内容 与 voteUser 的 username 写法相同"},
+			{Name: "salt", Usage: "提交承诺时使用的盐"},
+		}},
+		"delegate": {Params: []param{
+			{Name: "scope", Usage: "委托范围 poll/topic"},
+			{Name: "target", Usage: "投票ID或主题"},
+			{Name: "delegate", Usage: "受托人"},
+		}},
+		"revokeDelegation": {Params: []param{
+			{Name: "scope", Usage: "委托范围 poll/topic"},
+			{Name: "target", Usage: "投票ID或主题"},
+		}},
+		"getDelegationChain": {Query: true, Params: []param{
+			pollID,
+			{Name: "voter", Usage: "投票者 默认查询全部委托人", Optional: true},
+		}},
+		"createProposal": {Params: []param{
+			{Name: "poll", Usage: "投票定义 json 不能设置候选人"},
+			{Name: "change", Usage: "参数修改 json"},
+		}},
+		"getProposal": {Query: true, Params: []param{
+			{Name: "proposal-id", Usage: "提案ID"},
+		}},
+	},
+	"sample": {
+		"set": {Params: []param{
+			{Name: "key", Usage: "资产的键"},
+			{Name: "value", Usage: "资产的值"},
+		}},
+		"get": {Query: true, Params: []param{
+			{Name: "key", Usage: "资产的键"},
+		}},
+	},
+}
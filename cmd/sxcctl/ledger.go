@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ForLina/sxc_contract/projection"
+	"github.com/ForLina/sxc_contract/scenario"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 保存在文件中的账本 导出和导入也使用这个格式
+// 值是json时原样保存 其他值保存为json字符串
+type ledgerFile struct {
+	Chaincode string                                `json:"chaincode"` // 链码名称
+	TxCount   int                                   `json:"tx_count"`  // 已经执行的交易数 用于生成交易ID
+	State     map[string]json.RawMessage            `json:"state"`     // 公开状态
+	Private   map[string]map[string]json.RawMessage `json:"private"`   // 私有数据 按集合分组
+}
+
+// 文件账本
+type ledger struct {
+	path       string
+	file       ledgerFile
+	identities map[string][]byte
+	blocks     *projection.BlockWriter // 不为空时每笔成功的交易写入一个区块
+}
+
+func newLedger(path string, chaincode string) *ledger {
+	return &ledger{
+		path: path,
+		file: ledgerFile{
+			Chaincode: chaincode,
+			State:     map[string]json.RawMessage{},
+			Private:   map[string]map[string]json.RawMessage{},
+		},
+		identities: map[string][]byte{},
+	}
+}
+
+func loadLedger(path string) (*ledger, error) {
+	fileAsBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取账本文件失败 %s 需要先执行 init", path)
+	}
+
+	l := newLedger(path, "")
+	err = json.Unmarshal(fileAsBytes, &l.file)
+	if err != nil {
+		return nil, fmt.Errorf("账本文件格式错误 %s %s", path, err)
+	}
+
+	_, ok := scenario.Chaincodes[l.file.Chaincode]
+	if !ok {
+		return nil, fmt.Errorf("账本文件中的链码未知 %s", l.file.Chaincode)
+	}
+	if l.file.State == nil {
+		l.file.State = map[string]json.RawMessage{}
+	}
+	if l.file.Private == nil {
+		l.file.Private = map[string]map[string]json.RawMessage{}
+	}
+
+	return l, nil
+}
+
+// 打开区块文件 path 为空时不写区块
+func (l *ledger) openBlocks(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	blocks, err := projection.NewBlockWriter(path, "mychannel")
+	if err != nil {
+		return err
+	}
+	l.blocks = blocks
+	return nil
+}
+
+func (l *ledger) save() error {
+	return writeJSON(l.path, l.file)
+}
+
+// 写入格式化的json文件
+func writeJSON(path string, v interface{}) error {
+	valueAsBytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法将账本转换为Json字符串")
+	}
+
+	err = os.WriteFile(path, append(valueAsBytes, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("写入文件失败 %s", path)
+	}
+	return nil
+}
+
+// 一笔交易
+type call struct {
+	Init      bool              // 以 Init 的方式调用
+	Query     bool              // 查询 不保存对账本的修改
+	Creator   string            // 调用者MSP ID
+	Transient map[string][]byte // transient 数据
+	Args      []string          // 交易参数 包含函数名
+}
+
+// 执行交易 每笔交易使用新的 MockStub
+// 交易成功且不是查询时才将修改写回账本 与节点上失败的交易不会改变状态一致
+func (l *ledger) execute(c call) (peer.Response, error) {
+	newChaincode, ok := scenario.Chaincodes[l.file.Chaincode]
+	if !ok {
+		return peer.Response{}, fmt.Errorf("未知的链码 %s", l.file.Chaincode)
+	}
+
+	chaincode, err := newChaincode()
+	if err != nil {
+		return peer.Response{}, err
+	}
+
+	stub := shimtest.NewMockStub(l.file.Chaincode, chaincode)
+	l.file.TxCount++
+	txID := fmt.Sprintf("tx%d", l.file.TxCount)
+
+	err = l.restore(stub, txID)
+	if err != nil {
+		return peer.Response{}, err
+	}
+
+	if c.Creator != "" {
+		creator, ok := l.identities[c.Creator]
+		if !ok {
+			creator, err = scenario.CreatorIdentity(c.Creator, nil)
+			if err != nil {
+				return peer.Response{}, err
+			}
+			l.identities[c.Creator] = creator
+		}
+		stub.Creator = creator
+	}
+	stub.TransientMap = c.Transient
+
+	args := [][]byte{}
+	for _, arg := range c.Args {
+		args = append(args, []byte(arg))
+	}
+
+	var response peer.Response
+	if c.Init {
+		response = stub.MockInit(txID, args)
+	} else {
+		response = stub.MockInvoke(txID, args)
+	}
+
+	events := scenario.DrainEvents(stub)
+	if response.Status >= 400 || c.Query {
+		return response, nil
+	}
+
+	l.dump(stub)
+	if l.blocks != nil {
+		err = l.writeBlock(txID, events)
+		if err != nil {
+			return peer.Response{}, err
+		}
+	}
+
+	return response, nil
+}
+
+// 将交易写入区块文件 Fabric 每笔交易只保留最后一个事件
+func (l *ledger) writeBlock(txID string, events []*peer.ChaincodeEvent) error {
+	transaction := projection.ChaincodeEvent{TxID: txID, ChaincodeName: l.file.Chaincode}
+	if len(events) > 0 {
+		transaction.EventName = events[len(events)-1].EventName
+		transaction.Payload = events[len(events)-1].Payload
+	}
+
+	_, err := l.blocks.WriteBlock([]projection.ChaincodeEvent{transaction})
+	return err
+}
+
+// 将文件中的状态写入 MockStub
+// 通过 PutState 写入 MockStub 才会维护范围查询使用的有序键列表
+func (l *ledger) restore(stub *shimtest.MockStub, txID string) error {
+	stub.MockTransactionStart(txID)
+	defer stub.MockTransactionEnd(txID)
+
+	for key, value := range l.file.State {
+		err := stub.PutState(key, decodeValue(value))
+		if err != nil {
+			return fmt.Errorf("恢复账本状态失败 %q %s", key, err)
+		}
+	}
+
+	for collection, values := range l.file.Private {
+		for key, value := range values {
+			err := stub.PutPrivateData(collection, key, decodeValue(value))
+			if err != nil {
+				return fmt.Errorf("恢复私有数据失败 %s %q", collection, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *ledger) dump(stub *shimtest.MockStub) {
+	l.file.State = map[string]json.RawMessage{}
+	for key, value := range stub.State {
+		l.file.State[key] = encodeValue(value)
+	}
+
+	l.file.Private = map[string]map[string]json.RawMessage{}
+	for collection, values := range stub.PvtState {
+		l.file.Private[collection] = map[string]json.RawMessage{}
+		for key, value := range values {
+			l.file.Private[collection][key] = encodeValue(value)
+		}
+	}
+}
+
+// 值是json时原样保存 否则保存为json字符串
+func encodeValue(value []byte) json.RawMessage {
+	if json.Valid(value) {
+		return json.RawMessage(value)
+	}
+
+	valueAsBytes, _ := json.Marshal(string(value))
+	return json.RawMessage(valueAsBytes)
+}
+
+// encodeValue 的逆过程 格式化时加入的空白会被去掉
+func decodeValue(value json.RawMessage) []byte {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) > 0 && trimmed[0] == '"' {
+		var str string
+		if json.Unmarshal(trimmed, &str) == nil {
+			return []byte(str)
+		}
+	}
+
+	var compacted bytes.Buffer
+	if json.Compact(&compacted, trimmed) != nil {
+		return trimmed
+	}
+	return compacted.Bytes()
+}
+
+// 按键排序的公开状态 用于输出
+func (l *ledger) keys() []string {
+	keys := []string{}
+	for key := range l.file.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
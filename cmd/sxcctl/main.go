@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/scenario"
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const usage = `sxcctl 在本地的模拟账本上调用链码 账本保存在json文件中
+
+用法 sxcctl [-ledger 文件] [-creator MSP[/用户]] [-transient 键=值] [-blocks 区块文件] <命令> [参数]
+
+命令
+  init -chaincode <sxc|sxc-contract|vote|sample> [参数...]  创建账本并实例化链码
+  invoke <函数> [-参数名 值...] [-- 参数...]                调用函数并保存账本
+  query <函数> [-参数名 值...] [-- 参数...]                 调用函数 不保存账本
+  functions [函数]                                          列出函数以及参数
+  state [键]                                                输出公开状态
+  export [-out 文件]                                        导出账本状态
+  import -in 文件                                           导入账本状态
+  replay <脚本>                                             按顺序执行脚本中的调用
+  verify-receipt -roots 根证书... <签名回执文件>            离线校验网关返回的签名回执 不需要账本 -chaincode 为链码名称
+
+范例
+  sxcctl init -chaincode sxc init '["Org1MSP"]'
+  sxcctl invoke applicate -application-number 1 -name 张三 -id 110101 -hospital-code h1 \
+      -department-code d1 -street-office-code s1 -card-number c1 -desc-md5 md5 -need-amount 10000
+  sxcctl query getApplicationInfo -application-number 1
+`
+
+// 区块文件 设置时每笔成功的交易追加一个区块
+var blockFile string
+
+// 可以重复出现的 键=值 参数
+type keyValues map[string][]byte
+
+func (kv keyValues) String() string {
+	return fmt.Sprint(map[string][]byte(kv))
+}
+
+func (kv keyValues) Set(value string) error {
+	pair := strings.SplitN(value, "=", 2)
+	if len(pair) != 2 {
+		return fmt.Errorf("transient 参数需要是 键=值 的格式 %s", value)
+	}
+	kv[pair[0]] = []byte(pair[1])
+	return nil
+}
+
+func main() {
+	path := flag.String("ledger", "sxcctl.json", "账本文件")
+	creator := flag.String("creator", "Org1MSP", "调用者 MSP ID 或者 MSP ID/用户名")
+	transient := keyValues{}
+	flag.Var(transient, "transient", "transient 数据 键=值 可以重复")
+	flag.StringVar(&blockFile, "blocks", "", "区块文件 设置时每笔成功的交易追加一个区块 可以用 cmd/listener 重放")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	base := call{Creator: *creator, Transient: transient}
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	var err error
+	switch command {
+	case "init":
+		err = initLedger(*path, base, args)
+	case "invoke", "query":
+		err = invoke(*path, base, command == "query", args)
+	case "functions":
+		err = listFunctions(*path, args)
+	case "state":
+		err = printState(*path, args)
+	case "export":
+		err = exportLedger(*path, args)
+	case "import":
+		err = importLedger(*path, args)
+	case "replay":
+		err = replay(*path, base, args)
+	case "verify-receipt":
+		err = verifyReceipt(args)
+	default:
+		err = fmt.Errorf("未知的命令 %s", command)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// 创建账本文件并以 Init 的方式调用链码 已经存在的账本文件会被覆盖
+func initLedger(path string, base call, args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	chaincode := flags.String("chaincode", "sxc", "链码名称")
+	flags.Parse(args)
+
+	if _, ok := scenario.Chaincodes[*chaincode]; !ok {
+		return fmt.Errorf("未知的链码 %s", *chaincode)
+	}
+
+	l := newLedger(path, *chaincode)
+	err := l.openBlocks(blockFile)
+	if err != nil {
+		return err
+	}
+	base.Init = true
+	base.Args = flags.Args()
+	if len(base.Args) == 0 {
+		base.Args = []string{""}
+	}
+
+	response, err := l.execute(base)
+	if err != nil {
+		return err
+	}
+	err = printResponse(response)
+	if err != nil {
+		return err
+	}
+	return l.save()
+}
+
+// 调用一个函数 函数参数可以使用参数表中的参数名 也可以在 -- 之后按顺序给出
+func invoke(path string, base call, query bool, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("需要指定函数名")
+	}
+
+	l, err := loadLedger(path)
+	if err != nil {
+		return err
+	}
+	err = l.openBlocks(blockFile)
+	if err != nil {
+		return err
+	}
+
+	fnArgs, err := parseArgs(l.file.Chaincode, args[0], args[1:])
+	if err != nil {
+		return err
+	}
+
+	base.Query = query
+	base.Args = append([]string{args[0]}, fnArgs...)
+	response, err := l.execute(base)
+	if err != nil {
+		return err
+	}
+
+	err = printResponse(response)
+	if err != nil {
+		return err
+	}
+	if query {
+		return nil
+	}
+	return l.save()
+}
+
+// 将命名参数按参数表的顺序转换为链码参数
+// 参数表中没有的函数只能在 -- 之后按顺序给出参数
+func parseArgs(chaincode string, fn string, args []string) ([]string, error) {
+	params := functions[chaincode][fn].Params
+
+	flags := flag.NewFlagSet(fn, flag.ContinueOnError)
+	values := make([]*string, len(params))
+	for i, p := range params {
+		values[i] = flags.String(p.Name, "", p.Usage)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// -- 之后的参数原样传入
+	if flags.NArg() > 0 {
+		return flags.Args(), nil
+	}
+
+	named := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { named[f.Name] = true })
+
+	fnArgs := []string{}
+	for i, p := range params {
+		if p.Optional && !named[p.Name] {
+			break
+		}
+		if !p.Optional && !named[p.Name] {
+			return nil, fmt.Errorf("缺少参数 -%s %s", p.Name, p.Usage)
+		}
+		fnArgs = append(fnArgs, *values[i])
+	}
+	return fnArgs, nil
+}
+
+// 输出函数的参数表 账本存在时只输出账本中链码的函数
+func listFunctions(path string, args []string) error {
+	chaincodes := []string{}
+	if l, err := loadLedger(path); err == nil {
+		chaincodes = append(chaincodes, l.file.Chaincode)
+	} else {
+		for chaincode := range functions {
+			chaincodes = append(chaincodes, chaincode)
+		}
+		sort.Strings(chaincodes)
+	}
+
+	for _, chaincode := range chaincodes {
+		names := []string{}
+		for name := range functions[chaincode] {
+			if len(args) == 0 || args[0] == name {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fn := functions[chaincode][name]
+			kind := "invoke"
+			if fn.Query {
+				kind = "query"
+			}
+			fmt.Printf("%s %s (%s)\n", chaincode, name, kind)
+			for _, p := range fn.Params {
+				optional := ""
+				if p.Optional {
+					optional = " 可选"
+				}
+				fmt.Printf("    -%s  %s%s\n", p.Name, p.Usage, optional)
+			}
+		}
+	}
+	return nil
+}
+
+// 输出公开状态 复合键中的分隔符显示为 \x00
+func printState(path string, args []string) error {
+	l, err := loadLedger(path)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 {
+		value, ok := l.file.State[args[0]]
+		if !ok {
+			return fmt.Errorf("账本中不存在此键 %s", args[0])
+		}
+		return printPayload(decodeValue(value))
+	}
+
+	for _, key := range l.keys() {
+		fmt.Printf("%q\n", key)
+		fmt.Printf("    %s\n", decodeValue(l.file.State[key]))
+	}
+	return nil
+}
+
+// 导出账本 不指定文件时输出到标准输出
+func exportLedger(path string, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "", "导出的文件")
+	flags.Parse(args)
+
+	l, err := loadLedger(path)
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		return writeJSON(*out, l.file)
+	}
+
+	fileAsBytes, err := json.MarshalIndent(l.file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法将账本转换为Json字符串")
+	}
+	fmt.Println(string(fileAsBytes))
+	return nil
+}
+
+// 从导出的文件导入账本 覆盖当前的账本文件
+func importLedger(path string, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	in := flags.String("in", "", "导入的文件")
+	flags.Parse(args)
+
+	if *in == "" {
+		return fmt.Errorf("需要指定导入的文件 -in")
+	}
+
+	l, err := loadLedger(*in)
+	if err != nil {
+		return err
+	}
+	l.path = path
+
+	err = l.save()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已导入 %s 链码 %s 公开状态 %d 个键\n", *in, l.file.Chaincode, len(l.file.State))
+	return nil
+}
+
+// 可以重复出现的参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// 校验签名回执 即网关 GET /receipts/{id}/signed 的返回值
+// 输出回执内容与背书组织 需要自行确认这些组织满足链码的背书策略
+// 背书者的证书需要由 -roots 中的根证书签发 没有根证书时无法确认背书者的身份 直接报错
+func verifyReceipt(args []string) error {
+	flags := flag.NewFlagSet("verify-receipt", flag.ExitOnError)
+	roots := stringList{}
+	flags.Var(&roots, "roots", "背书组织的根证书 PEM文件 可以重复 至少需要一个")
+	chaincode := flags.String("chaincode", "sxc", "Sxc 部署时的链码名称")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("需要指定签名回执文件")
+	}
+	if len(roots) == 0 {
+		return fmt.Errorf("需要通过 -roots 指定背书组织的根证书")
+	}
+
+	signedAsBytes, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("读取签名回执失败 %s", flags.Arg(0))
+	}
+	signed := sxc.SignedReceipt{}
+	err = json.Unmarshal(signedAsBytes, &signed)
+	if err != nil {
+		return fmt.Errorf("签名回执格式错误 %s", flags.Arg(0))
+	}
+
+	certPool := x509.NewCertPool()
+	for _, root := range roots {
+		rootAsBytes, err := os.ReadFile(root)
+		if err != nil {
+			return fmt.Errorf("读取根证书失败 %s", root)
+		}
+		if !certPool.AppendCertsFromPEM(rootAsBytes) {
+			return fmt.Errorf("根证书格式错误 %s", root)
+		}
+	}
+
+	endorsers, err := sxc.VerifySignedReceipt(signed, *chaincode, certPool)
+	if err != nil {
+		return err
+	}
+
+	receiptAsBytes, err := json.MarshalIndent(signed.Receipt, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法将回执转换为Json字符串")
+	}
+	fmt.Println(string(receiptAsBytes))
+	fmt.Printf("区块 %d 背书组织 %s\n", signed.BlockNumber, strings.Join(endorsers, ","))
+	return nil
+}
+
+// 脚本中的一次调用
+type scriptCall struct {
+	Name      string            `json:"name"`      // 调用的说明 只用于输出
+	Query     bool              `json:"query"`     // 查询 不保存对账本的修改
+	Init      bool              `json:"init"`      // 以 Init 的方式调用 例如升级
+	Creator   string            `json:"creator"`   // 调用者 MSP ID 或者 MSP ID/用户名 为空时使用 -creator
+	Transient map[string]string `json:"transient"` // transient 数据
+	Args      []string          `json:"args"`      // 交易参数 包含函数名
+}
+
+// 按顺序执行脚本中的调用 遇到失败的调用时停止
+// 脚本是调用的json数组 范例 [{"args":["applicate","1",...]},{"query":true,"args":["getRaised","1"]}]
+func replay(path string, base call, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("需要指定脚本文件")
+	}
+
+	scriptAsBytes, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("读取脚本失败 %s", args[0])
+	}
+
+	calls := []scriptCall{}
+	err = json.Unmarshal(scriptAsBytes, &calls)
+	if err != nil {
+		return fmt.Errorf("脚本格式错误 %s %s", args[0], err)
+	}
+
+	l, err := loadLedger(path)
+	if err != nil {
+		return err
+	}
+	err = l.openBlocks(blockFile)
+	if err != nil {
+		return err
+	}
+
+	for i, c := range calls {
+		if len(c.Args) == 0 {
+			return fmt.Errorf("第 %d 个调用缺少参数", i+1)
+		}
+
+		next := call{Init: c.Init, Query: c.Query, Creator: base.Creator, Transient: base.Transient, Args: c.Args}
+		if c.Creator != "" {
+			next.Creator = c.Creator
+		}
+		if c.Transient != nil {
+			next.Transient = map[string][]byte{}
+			for key, value := range c.Transient {
+				next.Transient[key] = []byte(value)
+			}
+		}
+
+		name := c.Name
+		if name == "" {
+			name = strings.Join(c.Args, " ")
+		}
+		fmt.Printf("# %d %s\n", i+1, name)
+
+		response, err := l.execute(next)
+		if err != nil {
+			return err
+		}
+		err = printResponse(response)
+		if err != nil {
+			return fmt.Errorf("第 %d 个调用失败 %s", i+1, err)
+		}
+
+		err = l.save()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 输出返回值 失败时返回错误信息
+func printResponse(response peer.Response) error {
+	if response.Status >= 400 {
+		return fmt.Errorf("状态码 %d %s", response.Status, response.Message)
+	}
+	return printPayload(response.Payload)
+}
+
+// 返回值是json时格式化输出 否则原样输出
+func printPayload(payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	var indented bytes.Buffer
+	if json.Indent(&indented, payload, "", "  ") == nil {
+		fmt.Println(indented.String())
+	} else {
+		fmt.Println(string(payload))
+	}
+	return nil
+}
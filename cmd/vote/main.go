@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/vote"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+func main() {
+	err := shim.Start(new(vote.VoteChaincode))
+	if err != nil {
+		fmt.Println("vote chaincode start err")
+	}
+}
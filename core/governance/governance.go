@@ -0,0 +1,111 @@
+// Package governance 定义 Sxc 和投票链码之间共享的治理提案数据结构
+package governance
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 可以修改的策略参数
+const (
+	ParameterCoverage = "coverage" // 贷款覆盖策略 参考 CoveragePolicy
+	ParameterRoles    = "roles"    // 角色配置 参考 RoleConfig
+)
+
+// 贷款覆盖策略
+// 决定一个申请在当前募集情况下最多还能贷多少款
+type CoveragePolicy struct {
+	MaxLoanRatio     float64            `json:"max_loan_ratio"`                          // 贷款总额占可用募集资金的最大比例
+	CollateralRatio  float64            `json:"collateral_ratio"`                        // 保留作为还款担保的捐赠资金比例 这部分资金不计入可贷额度
+	BankLimits       map[string]float64 `json:"bank_limits" metadata:",optional"`        // 每个银行在所有申请上的贷款总额上限 为空时不限制银行
+	DefaultBankLimit float64            `json:"default_bank_limit" metadata:",optional"` // 配置了 bank_limits 时 其中没有列出的银行的贷款上限 为0时这些银行不能放款
+}
+
+// 角色配置 由治理组织维护
+type RoleConfig struct {
+	PlatformMSPs []string `json:"platform_msps"`                   // 捐赠平台的MSP ID列表 可以查看捐赠者的真实身份
+	AdminMSPs    []string `json:"admin_msps" metadata:",optional"` // 管理员的MSP ID列表 可以修复申请的汇总数据
+}
+
+// 一次参数修改 治理提案和治理组织直接修改使用相同的结构
+// 只能设置与 parameter 对应的一个字段
+type ParameterChange struct {
+	Parameter string          `json:"parameter"`                               // 参考常量定义 修改的参数
+	Coverage  *CoveragePolicy `json:"coverage,omitempty" metadata:",optional"` // 新的贷款覆盖策略
+	Roles     *RoleConfig     `json:"roles,omitempty" metadata:",optional"`    // 新的角色配置
+}
+
+// 投票链码 getProposal 的返回值 Sxc 按此结构读取提案
+type Proposal struct {
+	ProposalID string          `json:"proposal_id"` // 提案ID 与投票ID相同
+	Change     ParameterChange `json:"change"`      // 提案的参数修改
+	VoterMSPs  []string        `json:"voter_msps"`  // 有投票资格的组织
+	Status     string          `json:"status"`      // 投票的结论 还没有计票时为空
+	Approved   bool            `json:"approved"`    // 投票是否通过并且同意票胜出 只有通过的提案可以执行
+	Turnout    float64         `json:"turnout"`     // 投票的组织数量 还没有计票时为0
+	Share      float64         `json:"share"`       // 同意票的得票比例 没有通过时为0
+}
+
+// 校验贷款覆盖策略
+func (p CoveragePolicy) Validate() error {
+	if p.MaxLoanRatio <= 0 || p.MaxLoanRatio > 1 {
+		return fmt.Errorf("最大贷款比例需要在 (0, 1] 之间 %v", p.MaxLoanRatio)
+	}
+	if p.CollateralRatio < 0 || p.CollateralRatio >= 1 {
+		return fmt.Errorf("担保资金比例需要在 [0, 1) 之间 %v", p.CollateralRatio)
+	}
+	for bank, limit := range p.BankLimits {
+		if limit < 0 {
+			return fmt.Errorf("银行贷款上限不能为负数 %s", bank)
+		}
+	}
+	if p.DefaultBankLimit < 0 {
+		return fmt.Errorf("默认银行贷款上限不能为负数 %v", p.DefaultBankLimit)
+	}
+	return nil
+}
+
+// 校验角色配置 两个列表都不能为空 否则没有组织可以查看捐赠者身份或者修复申请
+func (r RoleConfig) Validate() error {
+	lists := []struct {
+		name string
+		msps []string
+	}{
+		{"platform_msps", r.PlatformMSPs},
+		{"admin_msps", r.AdminMSPs},
+	}
+
+	for _, list := range lists {
+		if len(list.msps) == 0 {
+			return fmt.Errorf("角色配置的 %s 不能为空", list.name)
+		}
+		seen := map[string]bool{}
+		for _, msp := range list.msps {
+			if strings.TrimSpace(msp) == "" {
+				return fmt.Errorf("角色配置的 %s 中有空的MSP ID", list.name)
+			}
+			if seen[msp] {
+				return fmt.Errorf("角色配置的 %s 中有重复的MSP ID %s", list.name, msp)
+			}
+			seen[msp] = true
+		}
+	}
+	return nil
+}
+
+// 校验参数修改
+func (c ParameterChange) Validate() error {
+	switch c.Parameter {
+	case ParameterCoverage:
+		if c.Coverage == nil || c.Roles != nil {
+			return fmt.Errorf("修改 %s 时只能设置 coverage", c.Parameter)
+		}
+		return c.Coverage.Validate()
+	case ParameterRoles:
+		if c.Roles == nil || c.Coverage != nil {
+			return fmt.Errorf("修改 %s 时只能设置 roles", c.Parameter)
+		}
+		return c.Roles.Validate()
+	}
+	return fmt.Errorf("不支持修改的参数 %s", c.Parameter)
+}
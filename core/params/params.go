@@ -0,0 +1,55 @@
+// Package params 提供链码入参的校验与转换
+package params
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// 校验参数数量
+func Count(args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("参数目错误，需要 %d 个参数, 收到 %d 个", n, len(args))
+	}
+	return nil
+}
+
+// 校验参数数量在 min 到 max 之间
+func Between(args []string, min int, max int) error {
+	if len(args) >= min && len(args) <= max {
+		return nil
+	}
+	if max == min+1 {
+		return fmt.Errorf("参数目错误，需要 %d 或 %d 个参数, 收到 %d 个", min, max, len(args))
+	}
+	return fmt.Errorf("参数目错误，需要 %d 到 %d 个参数, 收到 %d 个", min, max, len(args))
+}
+
+// 读取可选参数 未传入时返回默认值
+func Optional(args []string, i int, defaultValue string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return defaultValue
+}
+
+// 将参数转换为float64 name 为参数的中文名称 用于错误信息
+func Float(value string, name string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无法将%s转换为float64类型  %s", name, value)
+	}
+	return f, nil
+}
+
+// 将参数转换为正数
+func PositiveFloat(value string, name string) (float64, error) {
+	f, err := Float(value, name)
+	if err != nil {
+		return 0, err
+	}
+	if f <= 0 {
+		return 0, fmt.Errorf("%s需要是正数  %s", name, value)
+	}
+	return f, nil
+}
@@ -0,0 +1,30 @@
+// Package response 将链码函数的返回值转换为 peer.Response
+package response
+
+import (
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 链码函数 返回成功时的内容或者错误
+type Function func(stub shim.ChaincodeStubInterface, args []string) (string, error)
+
+// 根据函数的返回值生成响应
+func FromResult(result string, err error) peer.Response {
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte(result))
+}
+
+// 按函数名分发调用 未注册的函数返回 notFound
+func Dispatch(stub shim.ChaincodeStubInterface, functions map[string]Function, notFound string) peer.Response {
+	fn, args := stub.GetFunctionAndParameters()
+
+	function, ok := functions[fn]
+	if !ok {
+		return shim.Error(notFound)
+	}
+
+	return FromResult(function(stub, args))
+}
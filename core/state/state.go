@@ -0,0 +1,60 @@
+// Package state 提供以json格式读写账本状态的辅助函数
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 读取键对应的json文档 键不存在时 found 为 false
+func GetJSON(stub shim.ChaincodeStubInterface, key string, v interface{}) (bool, error) {
+	valueAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("获取账本状态失败 %s", key)
+	}
+	if valueAsBytes == nil {
+		return false, nil
+	}
+
+	err = json.Unmarshal(valueAsBytes, v)
+	if err != nil {
+		return false, fmt.Errorf("json串转换为对象失败 %s", key)
+	}
+
+	return true, nil
+}
+
+// 将对象转换为json后写入账本
+func PutJSON(stub shim.ChaincodeStubInterface, key string, v interface{}) error {
+	valueAsBytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("无法将对象转换为Json字符串 %s", key)
+	}
+
+	err = stub.PutState(key, valueAsBytes)
+	if err != nil {
+		return fmt.Errorf("写入账本失败 %s", key)
+	}
+
+	return nil
+}
+
+// 读取复合键对应的json文档
+func GetCompositeJSON(stub shim.ChaincodeStubInterface, objectType string, attributes []string, v interface{}) (bool, error) {
+	key, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return false, fmt.Errorf("创建复合键失败 %s %v", objectType, attributes)
+	}
+	return GetJSON(stub, key, v)
+}
+
+// 将对象转换为json后写入复合键
+func PutCompositeJSON(stub shim.ChaincodeStubInterface, objectType string, attributes []string, v interface{}) error {
+	key, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return fmt.Errorf("创建复合键失败 %s %v", objectType, attributes)
+	}
+	return PutJSON(stub, key, v)
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// 可以调用网关的客户端 通过请求头 Authorization: Bearer <token> 识别
+// 网关使用同一个 Fabric 身份调用链码 链码中的组织和角色校验针对的是网关用户
+// 因此按客户端区分的权限只能在网关中校验 只读客户端只能调用 GET 接口
+type Client struct {
+	Name  string `json:"name"`  // 客户端名称 用于日志和错误信息
+	Token string `json:"token"` // 客户端令牌
+	Write bool   `json:"write"` // 是否可以调用提交交易的接口
+}
+
+// 读取客户端列表
+// 文件格式 [{"name":"hospital","token":"...","write":true},{"name":"web","token":"..."}]
+func LoadClients(path string) ([]Client, error) {
+	clientsAsBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取客户端列表失败 %s", path)
+	}
+
+	clients := []Client{}
+	err = json.Unmarshal(clientsAsBytes, &clients)
+	if err != nil {
+		return nil, fmt.Errorf("客户端列表格式错误 %s %s", path, err)
+	}
+
+	tokens := map[string]bool{}
+	for _, client := range clients {
+		if client.Name == "" || client.Token == "" {
+			return nil, fmt.Errorf("客户端的名称和令牌不能为空")
+		}
+		if tokens[client.Token] {
+			return nil, fmt.Errorf("客户端 %s 的令牌与其他客户端重复", client.Name)
+		}
+		tokens[client.Token] = true
+	}
+
+	return clients, nil
+}
+
+// 按请求头中的令牌查找客户端
+// 比较令牌的sha256 避免按令牌内容提前返回
+func (s *Server) authenticate(r *http.Request) (Client, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return Client{}, false
+	}
+	digest := sha256.Sum256([]byte(strings.TrimPrefix(header, "Bearer ")))
+
+	found := Client{}
+	ok := false
+	for _, client := range s.clients {
+		clientDigest := sha256.Sum256([]byte(client.Token))
+		if subtle.ConstantTimeCompare(digest[:], clientDigest[:]) == 1 {
+			found, ok = client, true
+		}
+	}
+	return found, ok
+}
+
+// 校验调用者 失败时已经写入了错误响应
+// 没有令牌或令牌未知时返回 401 只读客户端调用 GET 以外的接口时返回 403
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	client, ok := s.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("需要有效的客户端令牌"))
+		return false
+	}
+
+	if r.Method != http.MethodGet && !client.Write {
+		writeError(w, http.StatusForbidden, fmt.Errorf("客户端 %s 只能查询", client.Name))
+		return false
+	}
+	return true
+}
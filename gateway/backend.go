@@ -0,0 +1,30 @@
+// Package gateway 将 Sxc 的链码函数映射为 REST 资源 供不能直接访问节点的前端使用
+// 链码调用通过 Backend 完成 生产环境使用 FabricBackend 本地开发与测试使用 gateway/mock 包中的后端
+// 每个请求都需要携带网关签发的令牌 参考 Client
+package gateway
+
+// 调用链码的后端
+type Backend interface {
+	// 提交交易 交易写入账本之后返回链码的返回值
+	Submit(function string, args []string, transient map[string][]byte) ([]byte, error)
+	// 查询 不写入账本
+	Evaluate(function string, args []string) ([]byte, error)
+}
+
+// 可以读取已提交交易的后端 用于生成签名回执 没有实现时网关不提供签名回执
+type TransactionReader interface {
+	// 读取有效交易所在的区块号和交易信封 交易不存在或者无效时返回错误
+	Transaction(txID string) (uint64, []byte, error)
+	// 交易所属的链码名称 签名回执只接受此链码写入的回执
+	Chaincode() string
+}
+
+// 链码拒绝了交易 错误信息来自链码
+// 其他错误 例如无法连接节点 不使用这个类型
+type ChaincodeError struct {
+	Message string
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,207 @@
+package gateway
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/gateway"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// 连接 Fabric 节点的配置
+type FabricConfig struct {
+	PeerEndpoint string // 节点的 gateway 服务地址 例如 localhost:7051
+	ServerName   string // 节点TLS证书中的主机名 为空时使用地址中的主机名
+	TLSCertPath  string // 节点的TLS CA证书
+	MSPID        string // 网关使用的MSP ID
+	CertPath     string // 网关用户的证书
+	KeyPath      string // 网关用户的私钥
+	Channel      string // 通道名称
+	Chaincode    string // 链码名称
+}
+
+// 通过 Fabric Gateway 调用节点上的链码
+type FabricBackend struct {
+	connection *grpc.ClientConn
+	gateway    *client.Gateway
+	network    *client.Network
+	contract   *client.Contract
+	channel    string
+	chaincode  string
+}
+
+// 连接节点 使用完之后需要调用 Close
+func NewFabricBackend(config FabricConfig) (*FabricBackend, error) {
+	tlsCertAsBytes, err := os.ReadFile(config.TLSCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取节点TLS证书失败 %s", config.TLSCertPath)
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(tlsCertAsBytes) {
+		return nil, fmt.Errorf("节点TLS证书格式错误 %s", config.TLSCertPath)
+	}
+
+	serverName := config.ServerName
+	if serverName == "" {
+		serverName = strings.Split(config.PeerEndpoint, ":")[0]
+	}
+
+	connection, err := grpc.Dial(config.PeerEndpoint, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(certPool, serverName)))
+	if err != nil {
+		return nil, fmt.Errorf("连接节点失败 %s %s", config.PeerEndpoint, err)
+	}
+
+	id, sign, err := loadSigner(config)
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	gw, err := client.Connect(id,
+		client.WithSign(sign),
+		client.WithClientConnection(connection),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(time.Minute),
+	)
+	if err != nil {
+		connection.Close()
+		return nil, fmt.Errorf("连接 Fabric Gateway 失败 %s", err)
+	}
+
+	network := gw.GetNetwork(config.Channel)
+	return &FabricBackend{
+		connection: connection,
+		gateway:    gw,
+		network:    network,
+		contract:   network.GetContract(config.Chaincode),
+		channel:    config.Channel,
+		chaincode:  config.Chaincode,
+	}, nil
+}
+
+// 读取网关用户的证书和私钥
+func loadSigner(config FabricConfig) (*identity.X509Identity, identity.Sign, error) {
+	certAsBytes, err := os.ReadFile(config.CertPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取用户证书失败 %s", config.CertPath)
+	}
+	cert, err := identity.CertificateFromPEM(certAsBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("用户证书格式错误 %s", config.CertPath)
+	}
+	id, err := identity.NewX509Identity(config.MSPID, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyAsBytes, err := os.ReadFile(config.KeyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取用户私钥失败 %s", config.KeyPath)
+	}
+	key, err := identity.PrivateKeyFromPEM(keyAsBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("用户私钥格式错误 %s", config.KeyPath)
+	}
+	sign, err := identity.NewPrivateKeySign(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return id, sign, nil
+}
+
+// 后端连接的通道 用于订阅事件等合约调用以外的操作
+func (b *FabricBackend) Network() *client.Network {
+	return b.network
+}
+
+func (b *FabricBackend) Close() {
+	b.gateway.Close()
+	b.connection.Close()
+}
+
+func (b *FabricBackend) Submit(function string, args []string, transient map[string][]byte) ([]byte, error) {
+	result, err := b.contract.Submit(function, client.WithArguments(args...), client.WithTransient(transient))
+	if err != nil {
+		return nil, fabricError(err)
+	}
+	return result, nil
+}
+
+func (b *FabricBackend) Evaluate(function string, args []string) ([]byte, error) {
+	result, err := b.contract.EvaluateTransaction(function, args...)
+	if err != nil {
+		return nil, fabricError(err)
+	}
+	return result, nil
+}
+
+// 交易所属的链码名称
+func (b *FabricBackend) Chaincode() string {
+	return b.chaincode
+}
+
+// 通过系统链码 qscc 读取交易所在的区块 返回区块号和交易信封
+func (b *FabricBackend) Transaction(txID string) (uint64, []byte, error) {
+	blockAsBytes, err := b.network.GetContract("qscc").EvaluateTransaction("GetBlockByTxID", b.channel, txID)
+	if err != nil {
+		return 0, nil, fabricError(err)
+	}
+
+	block := &common.Block{}
+	err = proto.Unmarshal(blockAsBytes, block)
+	if err != nil || block.Header == nil || block.Data == nil || block.Metadata == nil {
+		return 0, nil, fmt.Errorf("区块格式错误 %s", txID)
+	}
+	filter := block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+
+	for i, envelopeAsBytes := range block.Data.Data {
+		envelope := &common.Envelope{}
+		payload := &common.Payload{}
+		channelHeader := &common.ChannelHeader{}
+		if proto.Unmarshal(envelopeAsBytes, envelope) != nil || proto.Unmarshal(envelope.Payload, payload) != nil ||
+			payload.Header == nil || proto.Unmarshal(payload.Header.ChannelHeader, channelHeader) != nil {
+			continue
+		}
+		if channelHeader.TxId != txID {
+			continue
+		}
+
+		if i >= len(filter) || peer.TxValidationCode(filter[i]) != peer.TxValidationCode_VALID {
+			return 0, nil, &ChaincodeError{Message: fmt.Sprintf("交易无效 %s", txID)}
+		}
+		return block.Header.Number, envelopeAsBytes, nil
+	}
+
+	return 0, nil, fmt.Errorf("区块 %d 中没有交易 %s", block.Header.Number, txID)
+}
+
+// 背书节点返回的链码错误转换为 ChaincodeError
+// 错误详情中的信息形如 chaincode response 500, 未找到此申请的信息 1
+func fabricError(err error) error {
+	for _, detail := range status.Convert(err).Details() {
+		errorDetail, ok := detail.(*gateway.ErrorDetail)
+		if !ok {
+			continue
+		}
+
+		message := errorDetail.GetMessage()
+		if index := strings.Index(message, ", "); strings.HasPrefix(message, "chaincode response") && index >= 0 {
+			message = message[index+2:]
+		}
+		return &ChaincodeError{Message: message}
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+// Package mock 提供使用进程内 MockStub 的网关后端 只用于本地开发和测试
+// 依赖 scenario 包的测试身份 不要在生产环境的网关中使用
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/ForLina/sxc_contract/gateway"
+	"github.com/ForLina/sxc_contract/scenario"
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+// 使用进程内 MockStub 的后端 状态只保存在内存中
+// MockStub 不会回滚失败交易的写入 与节点的行为不同 参考 scenario 包的说明
+type Backend struct {
+	mu      sync.Mutex
+	stub    *shimtest.MockStub
+	txCount int
+}
+
+// 创建后端并实例化 Sxc
+// 入参列表
+//
+//	mspID 网关调用链码时使用的MSP ID
+//	governanceMSPs 治理组织列表 为空时使用 mspID
+func NewBackend(mspID string, governanceMSPs []string) (*Backend, error) {
+	creator, err := scenario.NewIdentity(mspID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(governanceMSPs) == 0 {
+		governanceMSPs = []string{mspID}
+	}
+	governanceAsBytes, err := json.Marshal(governanceMSPs)
+	if err != nil {
+		return nil, fmt.Errorf("无法将治理组织列表转换为Json字符串")
+	}
+
+	b := &Backend{stub: shimtest.NewMockStub("sxc", new(sxc.Sxc))}
+	b.stub.Creator = creator
+
+	response := b.stub.MockInit(b.nextTxID(), [][]byte{[]byte("init"), governanceAsBytes})
+	if response.Status >= 400 {
+		return nil, fmt.Errorf("实例化链码失败 %s", response.Message)
+	}
+
+	return b, nil
+}
+
+func (b *Backend) nextTxID() string {
+	b.txCount++
+	return fmt.Sprintf("tx%d", b.txCount)
+}
+
+func (b *Backend) Submit(function string, args []string, transient map[string][]byte) ([]byte, error) {
+	return b.invoke(function, args, transient)
+}
+
+func (b *Backend) Evaluate(function string, args []string) ([]byte, error) {
+	return b.invoke(function, args, nil)
+}
+
+// MockStub 不能并发调用 所有交易串行执行
+func (b *Backend) invoke(function string, args []string, transient map[string][]byte) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	argsAsBytes := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		argsAsBytes = append(argsAsBytes, []byte(arg))
+	}
+
+	b.stub.TransientMap = transient
+	response := b.stub.MockInvoke(b.nextTxID(), argsAsBytes)
+	scenario.DrainEvents(b.stub)
+	if response.Status >= 400 {
+		return nil, &gateway.ChaincodeError{Message: response.Message}
+	}
+	return response.Payload, nil
+}
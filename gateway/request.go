@@ -0,0 +1,272 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/sxc"
+)
+
+// 请求参数不合法 在调用链码之前返回
+type ValidationError struct {
+	Field   string // 不合法的字段
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Message)
+}
+
+func required(field string, value string) error {
+	if value == "" {
+		return &ValidationError{Field: field, Message: "不能为空"}
+	}
+	return nil
+}
+
+func positive(field string, value float64) error {
+	if value <= 0 {
+		return &ValidationError{Field: field, Message: "需要是正数"}
+	}
+	return nil
+}
+
+// 依次执行校验 返回第一个错误
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+// POST /applications 发起申请
+type ApplicationRequest struct {
+	ApplicationNumber string  `json:"application_number"` // 申请编号
+	Name              string  `json:"name"`               // 申请者姓名
+	ID                string  `json:"id"`                 // 申请者身份证号
+	HospitalCode      string  `json:"hospital_code"`      // 医院编号
+	DepartmentCode    string  `json:"department_code"`    // 科室编号
+	StreetOfficeCode  string  `json:"street_office_code"` // 街道办编号
+	CardNumber        string  `json:"card_number"`        // 就诊卡号
+	DescMd5           string  `json:"desc_md5"`           // 病情描述的md5
+	NeedAmount        float64 `json:"need_amount"`        // 资金需求
+}
+
+func (r ApplicationRequest) Validate() error {
+	return firstError(
+		required("application_number", r.ApplicationNumber),
+		required("name", r.Name),
+		required("id", r.ID),
+		positive("need_amount", r.NeedAmount),
+	)
+}
+
+// applicate 的参数
+func (r ApplicationRequest) Args() []string {
+	return []string{r.ApplicationNumber, r.Name, r.ID, r.HospitalCode, r.DepartmentCode,
+		r.StreetOfficeCode, r.CardNumber, r.DescMd5, formatAmount(r.NeedAmount)}
+}
+
+// POST /applications/{id}/verification 医院审核
+type VerificationRequest struct {
+	Operator      string           `json:"operator"`       // 审核人员姓名
+	Agree         bool             `json:"agree"`          // 是否同意
+	ApproveAmount float64          `json:"approve_amount"` // 同意的金额 不同意时忽略
+	Attachments   []sxc.Attachment `json:"attachments"`    // 附件列表
+}
+
+func (r VerificationRequest) Validate() error {
+	err := required("operator", r.Operator)
+	if err != nil {
+		return err
+	}
+	if r.ApproveAmount < 0 {
+		return &ValidationError{Field: "approve_amount", Message: "不能为负数"}
+	}
+	_, err = r.attachments()
+	if err != nil {
+		return &ValidationError{Field: "attachments", Message: "无法转换为Json字符串"}
+	}
+	return nil
+}
+
+// 附件列表的Json字符串 没有附件时为 []
+func (r VerificationRequest) attachments() ([]byte, error) {
+	attachments := r.Attachments
+	if attachments == nil {
+		attachments = []sxc.Attachment{}
+	}
+	return json.Marshal(attachments)
+}
+
+// hVerify 的参数 需要先通过 Validate
+func (r VerificationRequest) Args(applicationNumber string) []string {
+	attachmentsAsBytes, _ := r.attachments()
+
+	agree := sxc.Reject
+	if r.Agree {
+		agree = sxc.Agree
+	}
+	return []string{applicationNumber, r.Operator, agree, formatAmount(r.ApproveAmount), string(attachmentsAsBytes)}
+}
+
+// POST /applications/{id}/donations 捐赠
+// 公开模式使用 donator 和 platform_id 非公开模式使用 donor 通过 transient 传入链码
+type DonationRequest struct {
+	Donator      string             `json:"donator"`       // 捐赠者姓名 公开模式
+	Amount       float64            `json:"amount"`        // 捐赠金额
+	SerialNumber string             `json:"serial_number"` // 业务流水号
+	PlatformID   string             `json:"platform_id"`   // 捐赠者的平台ID 公开模式
+	Privacy      string             `json:"privacy"`       // 隐私模式 默认 public
+	Donor        *sxc.DonorIdentity `json:"donor"`         // 捐赠者的真实身份 非公开模式
+}
+
+func (r DonationRequest) Validate() error {
+	err := firstError(
+		positive("amount", r.Amount),
+		required("serial_number", r.SerialNumber),
+	)
+	if err != nil {
+		return err
+	}
+
+	switch r.Privacy {
+	case "", sxc.PrivacyPublic:
+		if r.Donor != nil {
+			return &ValidationError{Field: "donor", Message: "公开模式下不能使用 donor 需要使用 donator 和 platform_id"}
+		}
+		return nil
+	case sxc.PrivacyPseudonymous, sxc.PrivacyAnonymous:
+	default:
+		return &ValidationError{Field: "privacy", Message: "需要是 public/pseudonymous/anonymous"}
+	}
+
+	if r.Donator != "" || r.PlatformID != "" {
+		return &ValidationError{Field: "donator", Message: "非公开模式下 donator 和 platform_id 需要为空 身份通过 donor 传入"}
+	}
+	if r.Donor == nil {
+		return &ValidationError{Field: "donor", Message: "非公开模式下不能为空"}
+	}
+	err = firstError(
+		required("donor.platform_id", r.Donor.PlatformID),
+		required("donor.salt", r.Donor.Salt),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = json.Marshal(r.Donor)
+	if err != nil {
+		return &ValidationError{Field: "donor", Message: "无法转换为Json字符串"}
+	}
+	return nil
+}
+
+// donate 的参数和 transient 数据 需要先通过 Validate
+func (r DonationRequest) Args(applicationNumber string) ([]string, map[string][]byte) {
+	privacy := r.Privacy
+	if privacy == "" {
+		privacy = sxc.PrivacyPublic
+	}
+	args := []string{applicationNumber, r.Donator, formatAmount(r.Amount), r.SerialNumber, r.PlatformID, privacy}
+
+	if r.Donor == nil {
+		return args, nil
+	}
+
+	donorAsBytes, _ := json.Marshal(r.Donor)
+	return args, map[string][]byte{"donor": donorAsBytes}
+}
+
+// POST /applications/{id}/loans 贷款
+type LoanRequest struct {
+	Amount         float64 `json:"amount"`          // 贷款金额
+	LoanNumber     string  `json:"loan_number"`     // 贷款单号
+	FirstRepayment string  `json:"first_repayment"` // 第一次还款的月份
+	TotalMonth     int     `json:"total_month"`     // 总共需要还款多少期
+	Bank           string  `json:"bank"`            // 放款银行编号 可选
+}
+
+func (r LoanRequest) Validate() error {
+	err := firstError(
+		positive("amount", r.Amount),
+		required("loan_number", r.LoanNumber),
+		required("first_repayment", r.FirstRepayment),
+	)
+	if err != nil {
+		return err
+	}
+	if r.TotalMonth <= 0 {
+		return &ValidationError{Field: "total_month", Message: "需要是正整数"}
+	}
+	return nil
+}
+
+// loan 的参数
+func (r LoanRequest) Args(applicationNumber string) []string {
+	args := []string{applicationNumber, formatAmount(r.Amount), r.LoanNumber, r.FirstRepayment, strconv.Itoa(r.TotalMonth)}
+	if r.Bank != "" {
+		args = append(args, r.Bank)
+	}
+	return args
+}
+
+// POST /applications/{id}/loans/{counter}/disbursement 收到银行放款
+type DisbursementRequest struct {
+	LoanNumber   string `json:"loan_number"`   // 贷款单号 需要与贷款记录一致
+	SerialNumber string `json:"serial_number"` // 放款入账流水号
+}
+
+func (r DisbursementRequest) Validate() error {
+	return firstError(
+		required("loan_number", r.LoanNumber),
+		required("serial_number", r.SerialNumber),
+	)
+}
+
+// receivedLoan 的参数
+func (r DisbursementRequest) Args(applicationNumber string, loanCounter int) []string {
+	return []string{applicationNumber, r.LoanNumber, strconv.Itoa(loanCounter), r.SerialNumber}
+}
+
+// POST /applications/{id}/loans/{counter}/repayments 偿还贷款的一期
+type RepaymentRequest struct {
+	LoanNumber   string `json:"loan_number"`   // 贷款单号 需要与贷款记录一致
+	SerialNumber string `json:"serial_number"` // 还款流水号
+}
+
+func (r RepaymentRequest) Validate() error {
+	return firstError(
+		required("loan_number", r.LoanNumber),
+		required("serial_number", r.SerialNumber),
+	)
+}
+
+// repay 的参数
+func (r RepaymentRequest) Args(applicationNumber string, loanCounter int) []string {
+	return []string{applicationNumber, r.LoanNumber, strconv.Itoa(loanCounter), r.SerialNumber}
+}
+
+// POST /applications/{id}/recharges 为就诊卡充值
+type RechargeRequest struct {
+	SerialNumber string  `json:"serial_number"` // 充值流水号
+	Amount       float64 `json:"amount"`        // 充值金额
+}
+
+func (r RechargeRequest) Validate() error {
+	return firstError(
+		required("serial_number", r.SerialNumber),
+		positive("amount", r.Amount),
+	)
+}
+
+// recharge 的参数
+func (r RechargeRequest) Args(applicationNumber string) []string {
+	return []string{applicationNumber, r.SerialNumber, formatAmount(r.Amount)}
+}
@@ -0,0 +1,357 @@
+package gateway
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/sxc"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte // 接口说明 GET /openapi.json 返回
+
+// 请求体的最大长度
+const maxBodySize = 1 << 20
+
+// REST 网关 将请求转换为链码调用
+type Server struct {
+	backend Backend
+	clients []Client
+}
+
+// 入参列表
+//
+//	backend 调用链码的后端
+//	clients 可以调用网关的客户端 为空时只能读取 openapi.json
+func NewServer(backend Backend, clients []Client) *Server {
+	return &Server{backend: backend, clients: clients}
+}
+
+// 按路径分发请求 除 openapi.json 之外都需要先校验客户端令牌
+// /applications/{id} 之后的路径决定调用的链码函数 参考 openapi.json
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/openapi.json" && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+		return
+	}
+	if !s.authorize(w, r) {
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(segments) == 1 && segments[0] == "applications":
+		s.route(w, r, map[string]handler{http.MethodPost: s.createApplication}, "")
+	case len(segments) == 2 && segments[0] == "receipts":
+		s.route(w, r, map[string]handler{http.MethodGet: s.getReceipt}, segments[1])
+	case len(segments) == 3 && segments[0] == "receipts" && segments[2] == "signed":
+		s.route(w, r, map[string]handler{http.MethodGet: s.getSignedReceipt}, segments[1])
+	case len(segments) >= 2 && segments[0] == "applications":
+		s.routeApplication(w, r, segments[1], segments[2:])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("未知的路径 %s", r.URL.Path))
+	}
+}
+
+// 处理一个资源的请求 id 为路径中的资源编号
+type handler func(w http.ResponseWriter, r *http.Request, id string)
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, handlers map[string]handler, id string) {
+	h, ok := handlers[r.Method]
+	if !ok {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("不支持的请求方法 %s", r.Method))
+		return
+	}
+	h(w, r, id)
+}
+
+func (s *Server) routeApplication(w http.ResponseWriter, r *http.Request, applicationNumber string, rest []string) {
+	switch {
+	case len(rest) == 0:
+		s.route(w, r, map[string]handler{http.MethodGet: s.getApplication}, applicationNumber)
+	case len(rest) == 1 && rest[0] == "verification":
+		s.route(w, r, map[string]handler{http.MethodPost: s.verify}, applicationNumber)
+	case len(rest) == 1 && rest[0] == "donations":
+		s.route(w, r, map[string]handler{http.MethodPost: s.donate, http.MethodGet: s.getDonations}, applicationNumber)
+	case len(rest) == 1 && rest[0] == "raised":
+		s.route(w, r, map[string]handler{http.MethodGet: s.getRaised}, applicationNumber)
+	case len(rest) == 1 && rest[0] == "loans":
+		s.route(w, r, map[string]handler{http.MethodPost: s.loan}, applicationNumber)
+	case len(rest) == 3 && rest[0] == "loans" && rest[2] == "disbursement":
+		s.route(w, r, map[string]handler{http.MethodPost: func(w http.ResponseWriter, r *http.Request, id string) {
+			s.disburse(w, r, id, rest[1])
+		}}, applicationNumber)
+	case len(rest) == 3 && rest[0] == "loans" && rest[2] == "repayments":
+		s.route(w, r, map[string]handler{http.MethodPost: func(w http.ResponseWriter, r *http.Request, id string) {
+			s.repay(w, r, id, rest[1])
+		}}, applicationNumber)
+	case len(rest) == 1 && rest[0] == "recharges":
+		s.route(w, r, map[string]handler{http.MethodPost: s.recharge}, applicationNumber)
+	case len(rest) == 1 && rest[0] == "cheat":
+		s.route(w, r, map[string]handler{http.MethodPost: s.setCheat}, applicationNumber)
+	case len(rest) == 1 && rest[0] == "report":
+		s.route(w, r, map[string]handler{http.MethodGet: s.getReport}, applicationNumber)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("未知的路径 %s", r.URL.Path))
+	}
+}
+
+// 请求参数 需要在调用链码之前校验
+type request interface {
+	Validate() error
+}
+
+// 读取并校验请求体 失败时已经写入了错误响应
+func decode(w http.ResponseWriter, r *http.Request, v request) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求体格式错误 %s", err))
+		return false
+	}
+
+	err = v.Validate()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) createApplication(w http.ResponseWriter, r *http.Request, _ string) {
+	request := ApplicationRequest{}
+	if !decode(w, r, &request) {
+		return
+	}
+
+	_, err := s.backend.Submit("applicate", request.Args(), nil)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/applications/"+request.ApplicationNumber)
+	writeJSON(w, http.StatusCreated, map[string]string{"application_number": request.ApplicationNumber})
+}
+
+func (s *Server) getApplication(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	s.evaluate(w, "getApplicationInfo", applicationNumber)
+}
+
+func (s *Server) verify(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	request := VerificationRequest{}
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.submit(w, "hVerify", request.Args(applicationNumber), nil)
+}
+
+func (s *Server) donate(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	request := DonationRequest{}
+	if !decode(w, r, &request) {
+		return
+	}
+
+	args, transient := request.Args(applicationNumber)
+	receiptID, err := s.backend.Submit("donate", args, transient)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/receipts/"+string(receiptID))
+	writeJSON(w, http.StatusCreated, map[string]string{"receipt_id": string(receiptID)})
+}
+
+func (s *Server) getDonations(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	s.evaluate(w, "getDonations", applicationNumber)
+}
+
+// getRaised 返回科学计数法的字符串 转换为数字返回
+func (s *Server) getRaised(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	result, err := s.backend.Evaluate("getRaised", []string{applicationNumber})
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	raised, err := strconv.ParseFloat(string(result), 64)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("无法将募集金额转换为float64类型  %s", result))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]float64{"amount_raised": raised})
+}
+
+// 返回贷款计数器与剩余可贷额度
+func (s *Server) loan(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	request := LoanRequest{}
+	if !decode(w, r, &request) {
+		return
+	}
+
+	result, err := s.backend.Submit("loan", request.Args(applicationNumber), nil)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	loanResult := struct {
+		Counter int `json:"counter"`
+	}{}
+	if json.Unmarshal(result, &loanResult) == nil {
+		w.Header().Set("Location", fmt.Sprintf("/applications/%s/loans/%d", applicationNumber, loanResult.Counter))
+	}
+	writeRaw(w, http.StatusCreated, result)
+}
+
+func (s *Server) disburse(w http.ResponseWriter, r *http.Request, applicationNumber string, counter string) {
+	loanCounter, err := strconv.Atoi(counter)
+	if err != nil || loanCounter <= 0 {
+		writeError(w, http.StatusBadRequest, &ValidationError{Field: "counter", Message: "贷款计数器需要是正整数"})
+		return
+	}
+
+	request := DisbursementRequest{}
+	if !decode(w, r, &request) {
+		return
+	}
+	s.submit(w, "receivedLoan", request.Args(applicationNumber, loanCounter), nil)
+}
+
+func (s *Server) repay(w http.ResponseWriter, r *http.Request, applicationNumber string, counter string) {
+	loanCounter, err := strconv.Atoi(counter)
+	if err != nil || loanCounter <= 0 {
+		writeError(w, http.StatusBadRequest, &ValidationError{Field: "counter", Message: "贷款计数器需要是正整数"})
+		return
+	}
+
+	request := RepaymentRequest{}
+	if !decode(w, r, &request) {
+		return
+	}
+	s.submit(w, "repay", request.Args(applicationNumber, loanCounter), nil)
+}
+
+func (s *Server) recharge(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	request := RechargeRequest{}
+	if !decode(w, r, &request) {
+		return
+	}
+	s.submit(w, "recharge", request.Args(applicationNumber), nil)
+}
+
+func (s *Server) setCheat(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	s.submit(w, "setCheat", []string{applicationNumber}, nil)
+}
+
+func (s *Server) getReport(w http.ResponseWriter, r *http.Request, applicationNumber string) {
+	s.evaluate(w, "getFundFlowReport", applicationNumber)
+}
+
+func (s *Server) getReceipt(w http.ResponseWriter, r *http.Request, receiptID string) {
+	s.evaluate(w, "getDonationReceipt", receiptID)
+}
+
+// 签名回执 由账本中的回执和捐赠交易的信封组成 后端不能读取区块时返回 501
+func (s *Server) getSignedReceipt(w http.ResponseWriter, r *http.Request, receiptID string) {
+	reader, ok := s.backend.(TransactionReader)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, fmt.Errorf("后端不支持读取区块 无法生成签名回执"))
+		return
+	}
+
+	result, err := s.backend.Evaluate("getDonationReceipt", []string{receiptID})
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	digested := sxc.DigestReceipt{}
+	err = json.Unmarshal(result, &digested)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("回执json串转换为回执对象失败"))
+		return
+	}
+
+	blockNumber, envelope, err := reader.Transaction(digested.Receipt.TxID)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	signed, err := sxc.NewSignedReceipt(digested, blockNumber, envelope, reader.Chaincode())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, signed)
+}
+
+// 提交交易 链码只返回 成功 时响应 204
+func (s *Server) submit(w http.ResponseWriter, function string, args []string, transient map[string][]byte) {
+	_, err := s.backend.Submit(function, args, transient)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 查询 链码返回的json原样输出
+func (s *Server) evaluate(w http.ResponseWriter, function string, args ...string) {
+	result, err := s.backend.Evaluate(function, args)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeRaw(w, http.StatusOK, result)
+}
+
+func writeRaw(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("无法将响应转换为Json字符串"))
+		return
+	}
+	writeRaw(w, status, body)
+}
+
+// 错误响应 {"error":错误信息, "field":不合法的字段}
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := map[string]string{"error": err.Error()}
+
+	var validationError *ValidationError
+	if errors.As(err, &validationError) {
+		body["error"] = validationError.Message
+		body["field"] = validationError.Field
+	}
+
+	bodyAsBytes, _ := json.Marshal(body)
+	writeRaw(w, status, bodyAsBytes)
+}
+
+// 链码拒绝的交易返回 422 其他错误说明后端不可用 返回 502
+func writeBackendError(w http.ResponseWriter, err error) {
+	var chaincodeError *ChaincodeError
+	if errors.As(err, &chaincodeError) {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeError(w, http.StatusBadGateway, err)
+}
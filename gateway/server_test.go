@@ -0,0 +1,239 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ForLina/sxc_contract/gateway"
+	"github.com/ForLina/sxc_contract/gateway/mock"
+)
+
+var clients = []gateway.Client{
+	{Name: "hospital", Token: "write-token", Write: true},
+	{Name: "web", Token: "read-token"},
+}
+
+func newServer(t *testing.T) *gateway.Server {
+	t.Helper()
+
+	backend, err := mock.NewBackend("Org1MSP", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gateway.NewServer(backend, clients)
+}
+
+// 一次请求 token 为空时不携带 Authorization
+type call struct {
+	name       string
+	token      string
+	method     string
+	path       string
+	body       string
+	wantStatus int
+	wantBody   map[string]interface{} // 响应中需要包含的字段
+	wantHeader map[string]string
+}
+
+func (c call) do(t *testing.T, server http.Handler) {
+	t.Helper()
+
+	r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if w.Code != c.wantStatus {
+		t.Fatalf("%s %s status = %d, want %d, body %s", c.method, c.path, w.Code, c.wantStatus, w.Body)
+	}
+	for name, value := range c.wantHeader {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("header %s = %q, want %q", name, got, value)
+		}
+	}
+	if len(c.wantBody) == 0 {
+		return
+	}
+
+	body := map[string]interface{}{}
+	err := json.Unmarshal(w.Body.Bytes(), &body)
+	if err != nil {
+		t.Fatalf("响应不是Json对象 %s", w.Body)
+	}
+	for field, value := range c.wantBody {
+		if fmt.Sprint(body[field]) != fmt.Sprint(value) {
+			t.Errorf("%s = %v, want %v, body %s", field, body[field], value, w.Body)
+		}
+	}
+}
+
+const application = `{"application_number":"1","name":"lyx","id":"500222199009214433","need_amount":1000}`
+
+func TestAuthorization(t *testing.T) {
+	server := newServer(t)
+
+	tests := []call{
+		{name: "接口说明不需要令牌", method: "GET", path: "/openapi.json", wantStatus: 200},
+		{name: "没有令牌", method: "GET", path: "/applications/1", wantStatus: 401,
+			wantBody: map[string]interface{}{"error": "需要有效的客户端令牌"}, wantHeader: map[string]string{"WWW-Authenticate": "Bearer"}},
+		{name: "未知的令牌", token: "nothing", method: "GET", path: "/applications/1", wantStatus: 401},
+		{name: "只读客户端不能提交交易", token: "read-token", method: "POST", path: "/applications", body: application, wantStatus: 403,
+			wantBody: map[string]interface{}{"error": "客户端 web 只能查询"}},
+		{name: "只读客户端可以查询", token: "read-token", method: "GET", path: "/applications/1", wantStatus: 422},
+		{name: "可写客户端", token: "write-token", method: "POST", path: "/applications", body: application, wantStatus: 201},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.do(t, server)
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	server := newServer(t)
+
+	tests := []call{
+		{name: "未知的路径", method: "GET", path: "/loans", wantStatus: 404},
+		{name: "申请下未知的路径", method: "GET", path: "/applications/1/history", wantStatus: 404},
+		{name: "不支持的请求方法", method: "DELETE", path: "/applications/1", wantStatus: 405,
+			wantBody: map[string]interface{}{"error": "不支持的请求方法 DELETE"}},
+		{name: "查询募集金额只支持 GET", method: "POST", path: "/applications/1/raised", body: "{}", wantStatus: 405},
+		{name: "模拟后端不能读取区块 没有签名回执", method: "GET", path: "/receipts/r1/signed", wantStatus: 501},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.token = "write-token"
+			tt.do(t, server)
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	server := newServer(t)
+
+	tests := []call{
+		{name: "请求体格式", path: "/applications", body: "{", wantStatus: 400},
+		{name: "未知字段", path: "/applications", body: `{"application_number":"1","extra":1}`, wantStatus: 400},
+		{name: "必填字段", path: "/applications", body: `{"application_number":"1","id":"x","need_amount":1}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "name", "error": "不能为空"}},
+		{name: "金额需要是正数", path: "/applications", body: `{"application_number":"1","name":"a","id":"x","need_amount":0}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "need_amount"}},
+		{name: "审核金额", path: "/applications/1/verification", body: `{"operator":"op","agree":true,"approve_amount":-1}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "approve_amount"}},
+		{name: "隐私模式", path: "/applications/1/donations", body: `{"amount":1,"serial_number":"s","privacy":"secret"}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "privacy"}},
+		{name: "非公开模式需要 donor", path: "/applications/1/donations", body: `{"amount":1,"serial_number":"s","privacy":"anonymous"}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "donor"}},
+		{name: "还款期数", path: "/applications/1/loans", body: `{"amount":1,"loan_number":"L1","first_repayment":"2020-09"}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "total_month"}},
+		{name: "贷款计数器", path: "/applications/1/loans/x/disbursement", body: `{"loan_number":"L1","serial_number":"s"}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "counter"}},
+		{name: "充值金额", path: "/applications/1/recharges", body: `{"serial_number":"s","amount":-1}`, wantStatus: 400,
+			wantBody: map[string]interface{}{"field": "amount"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.token = "write-token"
+			tt.method = "POST"
+			tt.do(t, server)
+		})
+	}
+}
+
+// 按顺序完成一次申请 捐赠 贷款 放款 还款 充值 链码拒绝的交易返回 422
+func TestApplicationFlow(t *testing.T) {
+	server := newServer(t)
+
+	tests := []call{
+		{method: "POST", path: "/applications", body: application, wantStatus: 201,
+			wantBody: map[string]interface{}{"application_number": "1"}, wantHeader: map[string]string{"Location": "/applications/1"}},
+		{method: "POST", path: "/applications", body: application, wantStatus: 422,
+			wantBody: map[string]interface{}{"error": "已经存在此合约编号 1"}},
+		{method: "POST", path: "/applications/1/verification", body: `{"operator":"op","agree":true,"approve_amount":800}`, wantStatus: 204},
+		{method: "POST", path: "/applications/1/donations", body: `{"donator":"zhangsan","amount":600,"serial_number":"sn1","platform_id":"p1"}`, wantStatus: 201},
+		{method: "GET", path: "/applications/1/raised", wantStatus: 200, wantBody: map[string]interface{}{"amount_raised": 600}},
+		{method: "POST", path: "/applications/1/loans", body: `{"amount":200,"loan_number":"L1","first_repayment":"2020-09","total_month":24}`, wantStatus: 201,
+			wantBody: map[string]interface{}{"counter": 1}, wantHeader: map[string]string{"Location": "/applications/1/loans/1"}},
+		{method: "POST", path: "/applications/1/loans/1/disbursement", body: `{"loan_number":"L2","serial_number":"bsn1"}`, wantStatus: 422},
+		{method: "POST", path: "/applications/1/loans/1/disbursement", body: `{"loan_number":"L1","serial_number":"bsn1"}`, wantStatus: 204},
+		{method: "POST", path: "/applications/1/loans/1/repayments", body: `{"loan_number":"L1","serial_number":"psn1"}`, wantStatus: 204},
+		{method: "POST", path: "/applications/1/recharges", body: `{"serial_number":"rsn1","amount":900}`, wantStatus: 422,
+			wantBody: map[string]interface{}{"error": "充值金额超过可用资金  900, 可用资金 800"}},
+		{method: "POST", path: "/applications/1/recharges", body: `{"serial_number":"rsn1","amount":120}`, wantStatus: 204},
+		{method: "GET", path: "/applications/1", wantStatus: 200,
+			wantBody: map[string]interface{}{"amount_raised": 600, "loan_total": 200, "received_loan_total": 200, "recharge_total": 120}},
+		{method: "GET", path: "/applications/1/report", wantStatus: 200},
+		{method: "GET", path: "/receipts/nothing", wantStatus: 422},
+		{method: "POST", path: "/applications/1/cheat", wantStatus: 204},
+		{method: "POST", path: "/applications/1/recharges", body: `{"serial_number":"rsn2","amount":1}`, wantStatus: 422},
+	}
+
+	for _, tt := range tests {
+		tt.token = "write-token"
+		tt.do(t, server)
+	}
+}
+
+// 无法访问节点的后端
+type unavailableBackend struct{}
+
+func (unavailableBackend) Submit(function string, args []string, transient map[string][]byte) ([]byte, error) {
+	return nil, fmt.Errorf("无法连接节点")
+}
+
+func (unavailableBackend) Evaluate(function string, args []string) ([]byte, error) {
+	return nil, fmt.Errorf("无法连接节点")
+}
+
+func TestBackendUnavailable(t *testing.T) {
+	server := gateway.NewServer(unavailableBackend{}, clients)
+
+	call{token: "read-token", method: "GET", path: "/applications/1", wantStatus: 502,
+		wantBody: map[string]interface{}{"error": "无法连接节点"}}.do(t, server)
+	call{token: "write-token", method: "POST", path: "/applications", body: application, wantStatus: 502}.do(t, server)
+}
+
+func TestLoadClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"客户端列表", `[{"name":"hospital","token":"a","write":true},{"name":"web","token":"b"}]`, ""},
+		{"格式错误", `{`, "客户端列表格式错误"},
+		{"令牌为空", `[{"name":"web"}]`, "客户端的名称和令牌不能为空"},
+		{"令牌重复", `[{"name":"hospital","token":"a"},{"name":"web","token":"a"}]`, "客户端 web 的令牌与其他客户端重复"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "clients.json")
+			err := os.WriteFile(path, []byte(tt.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := gateway.LoadClients(path)
+			if tt.wantErr == "" {
+				if err != nil || len(loaded) != 2 || !loaded[0].Write || loaded[1].Write {
+					t.Fatalf("LoadClients = %+v, %v", loaded, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
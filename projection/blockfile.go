@@ -0,0 +1,306 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 区块文件是本仓库自己的格式 由 BlockWriter 或 sxcctl 的 -blocks 生成
+// 每个区块为 varint 编码的长度加上序列化的 common.Block
+// 节点账本目录下的 blockfile_* 带有节点的索引和校验信息 不是这个格式 不能直接读取
+
+// 从区块文件读取链码事件 用于测试和重建 代替节点
+type BlockFileSource struct {
+	path      string
+	chaincode string
+}
+
+// chaincode 为空时返回全部链码的事件
+func NewBlockFileSource(path string, chaincode string) *BlockFileSource {
+	return &BlockFileSource{path: path, chaincode: chaincode}
+}
+
+func (s *BlockFileSource) Events(ctx context.Context, startBlock uint64, handle func(ChaincodeEvent) error) error {
+	return readBlocks(s.path, func(block *common.Block) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if block.GetHeader().GetNumber() < startBlock {
+			return nil
+		}
+
+		events, err := BlockEvents(block, s.chaincode)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			err = handle(event)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 按顺序读取文件中的区块
+func readBlocks(path string, handle func(*common.Block) error) error {
+	fileAsBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取区块文件失败 %s", path)
+	}
+
+	for offset := 0; offset < len(fileAsBytes); {
+		length, n := proto.DecodeVarint(fileAsBytes[offset:])
+		if n == 0 || offset+n+int(length) > len(fileAsBytes) {
+			return fmt.Errorf("区块文件不完整 %s 偏移 %d", path, offset)
+		}
+		offset += n
+
+		block := &common.Block{}
+		err = proto.Unmarshal(fileAsBytes[offset:offset+int(length)], block)
+		if err != nil {
+			return fmt.Errorf("区块格式错误 %s 偏移 %d", path, offset)
+		}
+		offset += int(length)
+
+		err = handle(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 取出区块中有效交易发出的链码事件 无效交易的事件不会生效 直接跳过
+// chaincode 为空时返回全部链码的事件
+func BlockEvents(block *common.Block, chaincode string) ([]ChaincodeEvent, error) {
+	var filter []byte
+	metadata := block.GetMetadata().GetMetadata()
+	if len(metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	events := []ChaincodeEvent{}
+	for i, envelopeAsBytes := range block.GetData().GetData() {
+		if i < len(filter) && peer.TxValidationCode(filter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+
+		txID, event, err := transactionEvent(envelopeAsBytes)
+		if err != nil {
+			return nil, fmt.Errorf("区块 %d 第 %d 笔交易格式错误 %s", block.GetHeader().GetNumber(), i, err)
+		}
+		if event == nil || (chaincode != "" && event.ChaincodeId != chaincode) {
+			continue
+		}
+
+		events = append(events, ChaincodeEvent{
+			BlockNumber:   block.GetHeader().GetNumber(),
+			TxID:          txID,
+			ChaincodeName: event.ChaincodeId,
+			EventName:     event.EventName,
+			Payload:       event.Payload,
+		})
+	}
+
+	return events, nil
+}
+
+// 解析交易 返回交易ID和链码事件 不是背书交易或者没有事件时事件为 nil
+func transactionEvent(envelopeAsBytes []byte) (string, *peer.ChaincodeEvent, error) {
+	envelope := &common.Envelope{}
+	err := proto.Unmarshal(envelopeAsBytes, envelope)
+	if err != nil {
+		return "", nil, err
+	}
+
+	payload := &common.Payload{}
+	err = proto.Unmarshal(envelope.Payload, payload)
+	if err != nil {
+		return "", nil, err
+	}
+	if payload.Header == nil {
+		return "", nil, nil
+	}
+
+	channelHeader := &common.ChannelHeader{}
+	err = proto.Unmarshal(payload.Header.ChannelHeader, channelHeader)
+	if err != nil {
+		return "", nil, err
+	}
+	if common.HeaderType(channelHeader.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return channelHeader.TxId, nil, nil
+	}
+
+	transaction := &peer.Transaction{}
+	err = proto.Unmarshal(payload.Data, transaction)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, action := range transaction.Actions {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		err = proto.Unmarshal(action.Payload, actionPayload)
+		if err != nil {
+			return "", nil, err
+		}
+		if actionPayload.Action == nil {
+			continue
+		}
+
+		responsePayload := &peer.ProposalResponsePayload{}
+		err = proto.Unmarshal(actionPayload.Action.ProposalResponsePayload, responsePayload)
+		if err != nil {
+			return "", nil, err
+		}
+
+		chaincodeAction := &peer.ChaincodeAction{}
+		err = proto.Unmarshal(responsePayload.Extension, chaincodeAction)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(chaincodeAction.Events) == 0 {
+			continue
+		}
+
+		event := &peer.ChaincodeEvent{}
+		err = proto.Unmarshal(chaincodeAction.Events, event)
+		if err != nil {
+			return "", nil, err
+		}
+		return channelHeader.TxId, event, nil
+	}
+
+	return channelHeader.TxId, nil, nil
+}
+
+// 将交易写成区块文件 没有节点时代替节点产生区块 例如 sxcctl -blocks
+// 只写入解析事件需要的字段 没有签名和哈希
+type BlockWriter struct {
+	path    string
+	channel string
+	next    uint64 // 下一个区块号
+}
+
+// 打开区块文件 文件已经存在时在末尾追加
+func NewBlockWriter(path string, channel string) (*BlockWriter, error) {
+	w := &BlockWriter{path: path, channel: channel}
+
+	if _, err := os.Stat(path); err != nil {
+		return w, nil
+	}
+
+	err := readBlocks(path, func(block *common.Block) error {
+		w.next = block.GetHeader().GetNumber() + 1
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// 写入一个区块 每个事件对应一笔有效交易 EventName 为空的交易不带事件
+// 事件中的区块号会被忽略 返回写入的区块号
+func (w *BlockWriter) WriteBlock(transactions []ChaincodeEvent) (uint64, error) {
+	block := &common.Block{
+		Header:   &common.BlockHeader{Number: w.next},
+		Data:     &common.BlockData{},
+		Metadata: &common.BlockMetadata{Metadata: make([][]byte, len(common.BlockMetadataIndex_name))},
+	}
+
+	filter := []byte{}
+	for _, transaction := range transactions {
+		envelopeAsBytes, err := w.envelope(transaction)
+		if err != nil {
+			return 0, err
+		}
+		block.Data.Data = append(block.Data.Data, envelopeAsBytes)
+		filter = append(filter, byte(peer.TxValidationCode_VALID))
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = filter
+
+	blockAsBytes, err := proto.Marshal(block)
+	if err != nil {
+		return 0, fmt.Errorf("序列化区块失败 %s", err)
+	}
+
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("打开区块文件失败 %s", w.path)
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(proto.EncodeVarint(uint64(len(blockAsBytes))), blockAsBytes...))
+	if err != nil {
+		return 0, fmt.Errorf("写入区块文件失败 %s", w.path)
+	}
+
+	w.next++
+	return block.Header.Number, nil
+}
+
+// 按 BlockEvents 解析的路径构造交易
+func (w *BlockWriter) envelope(transaction ChaincodeEvent) ([]byte, error) {
+	chaincodeAction := &peer.ChaincodeAction{
+		ChaincodeId: &peer.ChaincodeID{Name: transaction.ChaincodeName},
+	}
+	if transaction.EventName != "" {
+		eventAsBytes, err := proto.Marshal(&peer.ChaincodeEvent{
+			ChaincodeId: transaction.ChaincodeName,
+			TxId:        transaction.TxID,
+			EventName:   transaction.EventName,
+			Payload:     transaction.Payload,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chaincodeAction.Events = eventAsBytes
+	}
+
+	extension, err := proto.Marshal(chaincodeAction)
+	if err != nil {
+		return nil, err
+	}
+	responsePayload, err := proto.Marshal(&peer.ProposalResponsePayload{Extension: extension})
+	if err != nil {
+		return nil, err
+	}
+	actionPayload, err := proto.Marshal(&peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: responsePayload},
+	})
+	if err != nil {
+		return nil, err
+	}
+	transactionAsBytes, err := proto.Marshal(&peer.Transaction{
+		Actions: []*peer.TransactionAction{{Payload: actionPayload}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: w.channel,
+		TxId:      transaction.TxID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&common.Payload{
+		Header: &common.Header{ChannelHeader: channelHeader},
+		Data:   transactionAsBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&common.Envelope{Payload: payload})
+}
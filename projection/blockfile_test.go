@@ -0,0 +1,407 @@
+package projection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ForLina/sxc_contract/scenario"
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 在 MockStub 上执行一次完整流程 返回每笔交易发出的链码事件
+func sxcEvents(t *testing.T) []ChaincodeEvent {
+	t.Helper()
+
+	_, events := sxcLedger(t)
+	return events
+}
+
+// 同 sxcEvents 另外返回执行之后的 MockStub 第i笔交易的ID为 tx{i}
+func sxcLedger(t *testing.T) (*shimtest.MockStub, []ChaincodeEvent) {
+	t.Helper()
+
+	stub := shimtest.NewMockStub("sxc", new(sxc.Sxc))
+	creator, err := scenario.NewIdentity("Org1MSP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.Creator = creator
+
+	response := stub.MockInit("init", [][]byte{[]byte("init"), []byte("[\"Org1MSP\"]")})
+	if response.Status != 200 {
+		t.Fatalf("init: %s", response.Message)
+	}
+
+	transactions := [][]string{
+		{"applicate", "1", "lyx", "500222199009214433", "995", "3", "8876", "9988123519", "abcdabcdabcdabcdabcdabcdabcdabcd", "1000"},
+		{"hVerify", "1", "op", sxc.Agree, "800", "[]"},
+		{"donate", "1", "zhangsan", "600", "sn1", "platform1"},
+		{"loan", "1", "200", "L1", "2020-09", "24"},
+		{"receivedLoan", "1", "L1", "1", "bsn1"},
+		{"recharge", "1", "rsn1", "120"},
+	}
+
+	events := []ChaincodeEvent{}
+	for i, args := range transactions {
+		argsAsBytes := [][]byte{}
+		for _, arg := range args {
+			argsAsBytes = append(argsAsBytes, []byte(arg))
+		}
+
+		txID := fmt.Sprintf("tx%d", i)
+		response = stub.MockInvoke(txID, argsAsBytes)
+		if response.Status != 200 {
+			t.Fatalf("%s: %s", args[0], response.Message)
+		}
+
+		for _, event := range scenario.DrainEvents(stub) {
+			events = append(events, ChaincodeEvent{TxID: txID, ChaincodeName: "sxc", EventName: event.EventName, Payload: event.Payload})
+		}
+	}
+	return stub, events
+}
+
+// 每笔交易写入一个区块 另外写入一个其他链码的事件和一笔没有事件的交易
+func writeBlocks(t *testing.T, path string, events []ChaincodeEvent) {
+	t.Helper()
+
+	w, err := NewBlockWriter(path, "mychannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range events {
+		_, err = w.WriteBlock([]ChaincodeEvent{event})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = w.WriteBlock([]ChaincodeEvent{
+		{TxID: "other", ChaincodeName: "vote", EventName: "poll", Payload: []byte("{}")},
+		{TxID: "silent", ChaincodeName: "sxc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readEvents(t *testing.T, source Source, startBlock uint64) []ChaincodeEvent {
+	t.Helper()
+
+	events := []ChaincodeEvent{}
+	err := source.Events(context.Background(), startBlock, func(event ChaincodeEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestBlockFileSource(t *testing.T) {
+	events := sxcEvents(t)
+	if len(events) != 6 {
+		t.Fatalf("events = %d, want 6", len(events))
+	}
+
+	path := filepath.Join(t.TempDir(), "sxc.blocks")
+	writeBlocks(t, path, events)
+
+	replayed := readEvents(t, NewBlockFileSource(path, "sxc"), 0)
+	if len(replayed) != len(events) {
+		t.Fatalf("replayed = %d, want %d", len(replayed), len(events))
+	}
+	for i, event := range replayed {
+		if event.BlockNumber != uint64(i) || event.TxID != events[i].TxID || event.EventName != sxc.ChangeEventName {
+			t.Errorf("event %d = %+v", i, event)
+		}
+	}
+
+	// 事件中的申请和贷款是写入账本的内容 包含修改者和文档版本
+	for _, event := range replayed {
+		change := sxc.ChangeEvent{}
+		err := json.Unmarshal(event.Payload, &change)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := change.Application; a != nil && (a.UpdatedBy != "Org1MSP" || a.SchemaVersion == 0) {
+			t.Errorf("%s 申请 updated_by %q schema_version %d", event.TxID, a.UpdatedBy, a.SchemaVersion)
+		}
+		for _, loan := range change.Loans {
+			if loan.UpdatedBy != "Org1MSP" || loan.SchemaVersion == 0 {
+				t.Errorf("%s 贷款 updated_by %q schema_version %d", event.TxID, loan.UpdatedBy, loan.SchemaVersion)
+			}
+		}
+		for _, donation := range change.Donations {
+			if donation.SchemaVersion == 0 {
+				t.Errorf("%s 捐赠 schema_version 0", event.TxID)
+			}
+		}
+		for _, recharge := range change.Recharges {
+			if recharge.SchemaVersion == 0 {
+				t.Errorf("%s 充值 schema_version 0", event.TxID)
+			}
+		}
+	}
+
+	if all := readEvents(t, NewBlockFileSource(path, ""), 0); len(all) != len(events)+1 || all[len(events)].ChaincodeName != "vote" {
+		t.Errorf("全部链码的事件 = %+v", all)
+	}
+	if fromBlock := readEvents(t, NewBlockFileSource(path, "sxc"), 4); len(fromBlock) != 2 || fromBlock[0].BlockNumber != 4 {
+		t.Errorf("从区块4开始的事件 = %+v", fromBlock)
+	}
+}
+
+// 追加写入时区块号接着文件中最后一个区块
+func TestBlockWriterAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sxc.blocks")
+	writeBlocks(t, path, nil)
+
+	w, err := NewBlockWriter(path, "mychannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	number, err := w.WriteBlock([]ChaincodeEvent{{TxID: "tx", ChaincodeName: "sxc", EventName: "e"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 1 {
+		t.Errorf("number = %d, want 1", number)
+	}
+}
+
+// 区块过滤器标记为无效的交易不返回事件
+func TestBlockEventsInvalidTransaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sxc.blocks")
+	w, err := NewBlockWriter(path, "mychannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.WriteBlock([]ChaincodeEvent{
+		{TxID: "valid", ChaincodeName: "sxc", EventName: "e"},
+		{TxID: "invalid", ChaincodeName: "sxc", EventName: "e"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = readBlocks(path, func(block *common.Block) error {
+		block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER][1] = byte(peer.TxValidationCode_MVCC_READ_CONFLICT)
+
+		events, err := BlockEvents(block, "sxc")
+		if err != nil {
+			return err
+		}
+		if len(events) != 1 || events[0].TxID != "valid" {
+			t.Errorf("events = %+v", events)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sxc.blocks")
+	writeBlocks(t, path, nil)
+
+	fileAsBytes, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, fileAsBytes[:len(fileAsBytes)-1], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewBlockFileSource(path, "").Events(context.Background(), 0, func(ChaincodeEvent) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "区块文件不完整") {
+		t.Errorf("error = %v, want 区块文件不完整", err)
+	}
+
+	err = NewBlockFileSource(filepath.Join(dir, "none"), "").Events(context.Background(), 0, func(ChaincodeEvent) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "读取区块文件失败") {
+		t.Errorf("error = %v, want 读取区块文件失败", err)
+	}
+}
+
+// 从区块文件重建投影 重复处理同一个区块不改变结果
+func TestListenerReplay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sxc.blocks")
+	writeBlocks(t, path, sxcEvents(t))
+
+	store, err := Open("sqlite3", filepath.Join(dir, "projection.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	listener := NewListener(NewBlockFileSource(path, "sxc"), store)
+	for _, mode := range []Mode{RebuildFromGenesis, Resume} {
+		_, err = listener.Run(context.Background(), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		totals, err := store.HospitalTotals()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := HospitalTotal{HospitalCode: "995", Applications: 1, AmountRaised: 600, LoanTotal: 200, RechargeTotal: 120}
+		if len(totals) != 1 || totals[0] != want {
+			t.Errorf("mode %v totals = %+v, want %+v", mode, totals, want)
+		}
+
+		counts, err := store.StateCounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts[sxc.Raising] != 1 {
+			t.Errorf("mode %v counts = %v", mode, counts)
+		}
+	}
+
+	checkpoint, found, err := store.Checkpoint()
+	if err != nil || !found || checkpoint.BlockNumber != 5 || checkpoint.TxID != "tx5" {
+		t.Errorf("checkpoint = %+v %v %v", checkpoint, found, err)
+	}
+}
+
+// 区块文件之外从 MockStub 读取快照 代替节点
+type stubSnapshotSource struct {
+	*BlockFileSource
+	stub        *shimtest.MockStub
+	blockNumber uint64
+}
+
+func (s stubSnapshotSource) Snapshot(ctx context.Context) (uint64, []sxc.ChangeEvent, error) {
+	// MockStub 的范围查询不支持只有起始键 不分页
+	changes, err := readApplications(ctx, 0, func(args ...string) ([]byte, error) {
+		response := s.stub.MockInvoke("snapshot", [][]byte{[]byte("getApplications"), []byte(args[0]), []byte(args[1])})
+		if response.Status != 200 {
+			return nil, fmt.Errorf("%s", response.Message)
+		}
+		return response.Payload, nil
+	})
+	return s.blockNumber, changes, err
+}
+
+// 账本在链码发出变更事件之前已经有申请 前三笔交易没有事件 申请2之后没有再修改过
+func TestListenerLegacyLedger(t *testing.T) {
+	stub, events := sxcLedger(t)
+	response := stub.MockInvoke("legacy", [][]byte{[]byte("applicate"), []byte("2"), []byte("wxm"), []byte("500222199009214434"), []byte("995"),
+		[]byte("3"), []byte("8876"), []byte("9988123519"), []byte("abcdabcdabcdabcdabcdabcdabcdabcd"), []byte("500")})
+	if response.Status != 200 {
+		t.Fatal(response.Message)
+	}
+
+	for i := 0; i < 3; i++ {
+		events[i] = ChaincodeEvent{TxID: events[i].TxID, ChaincodeName: "sxc"}
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sxc.blocks")
+	writeBlocks(t, path, events)
+
+	store, err := Open("sqlite3", filepath.Join(dir, "projection.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// 区块文件没有账本状态 处理到旧申请的事件时报错 而不是得到不完整的投影
+	var inconsistentError *InconsistentError
+	_, err = NewListener(NewBlockFileSource(path, "sxc"), store).Run(context.Background(), RebuildFromGenesis)
+	if !errors.As(err, &inconsistentError) || !strings.Contains(err.Error(), "投影中没有申请 1 区块 3 交易 tx3") {
+		t.Fatalf("error = %v, want 投影中没有申请", err)
+	}
+
+	// 从创世区块重建时不读取快照 之后从检查点继续也不读取
+	source := stubSnapshotSource{BlockFileSource: NewBlockFileSource(path, "sxc"), stub: stub, blockNumber: 4}
+	for _, mode := range []Mode{RebuildFromGenesis, Resume} {
+		_, err = NewListener(source, store).Run(context.Background(), mode)
+		if !errors.As(err, &inconsistentError) {
+			t.Fatalf("mode %v error = %v, want 投影中没有申请", mode, err)
+		}
+	}
+
+	_, err = NewListener(NewBlockFileSource(path, "sxc"), store).Run(context.Background(), RebuildFromSnapshot)
+	if err == nil || !strings.Contains(err.Error(), "事件来源不支持读取账本快照") {
+		t.Fatalf("error = %v, want 事件来源不支持读取账本快照", err)
+	}
+
+	// 快照在区块4之前读取 之后只处理区块4和5的事件
+	applied, err := NewListener(source, store).Run(context.Background(), RebuildFromSnapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Errorf("applied = %d, want 2", applied)
+	}
+
+	totals, err := store.HospitalTotals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := HospitalTotal{HospitalCode: "995", Applications: 2, AmountRaised: 600, LoanTotal: 200, RechargeTotal: 120}
+	if len(totals) != 1 || totals[0] != want {
+		t.Errorf("totals = %+v, want %+v", totals, want)
+	}
+	counts, err := store.StateCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[sxc.Raising] != 1 || counts[sxc.HospitalVerify] != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+
+	checkpoint, found, err := store.Checkpoint()
+	if err != nil || !found || checkpoint.BlockNumber != 5 || checkpoint.TxID != "tx5" {
+		t.Errorf("checkpoint = %+v %v %v", checkpoint, found, err)
+	}
+
+	// 已经有检查点时不再读取快照
+	source.stub = nil
+	_, err = NewListener(source, store).Run(context.Background(), Resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadApplications(t *testing.T) {
+	pages := map[string]string{
+		"":  `{"applications":[{"application_number":"1"}],"bookmark":"2"}`,
+		"2": `{"applications":[{"application_number":"2"}],"bookmark":""}`,
+	}
+	changes, err := readApplications(context.Background(), 1, func(args ...string) ([]byte, error) {
+		if args[0] != "1" {
+			t.Errorf("page size = %s, want 1", args[0])
+		}
+		return []byte(pages[args[1]]), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].ApplicationNumber != "1" || changes[1].ApplicationNumber != "2" {
+		t.Errorf("changes = %+v", changes)
+	}
+
+	_, err = readApplications(context.Background(), 1, func(args ...string) ([]byte, error) {
+		return []byte("{"), nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "申请列表格式错误") {
+		t.Errorf("error = %v, want 申请列表格式错误", err)
+	}
+}
@@ -0,0 +1,78 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+// 读取快照时每页的申请数量
+const snapshotPageSize = 100
+
+// 通过 Fabric Gateway 从节点接收链码事件
+type FabricSource struct {
+	network   *client.Network
+	chaincode string
+}
+
+func NewFabricSource(network *client.Network, chaincode string) *FabricSource {
+	return &FabricSource{network: network, chaincode: chaincode}
+}
+
+// 节点只推送有效交易的事件 事件流断开时返回错误 由调用者从检查点重新开始
+func (s *FabricSource) Events(ctx context.Context, startBlock uint64, handle func(ChaincodeEvent) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := s.network.ChaincodeEvents(ctx, s.chaincode, client.WithStartBlock(startBlock))
+	if err != nil {
+		return fmt.Errorf("订阅链码事件失败 %s", err)
+	}
+
+	for event := range events {
+		err = handle(ChaincodeEvent{
+			BlockNumber:   event.BlockNumber,
+			TxID:          event.TransactionID,
+			ChaincodeName: event.ChaincodeName,
+			EventName:     event.EventName,
+			Payload:       event.Payload,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("节点的事件流已断开")
+}
+
+// 先通过系统链码 qscc 读取区块高度 再分页读取全部申请
+// 全部申请读入内存后在一个数据库事务中写入投影
+func (s *FabricSource) Snapshot(ctx context.Context) (uint64, []sxc.ChangeEvent, error) {
+	infoAsBytes, err := s.network.GetContract("qscc").EvaluateTransaction("GetChainInfo", s.network.Name())
+	if err != nil {
+		return 0, nil, fmt.Errorf("读取区块高度失败 %s", err)
+	}
+
+	info := &common.BlockchainInfo{}
+	err = proto.Unmarshal(infoAsBytes, info)
+	if err != nil || info.Height == 0 {
+		return 0, nil, fmt.Errorf("区块高度格式错误")
+	}
+
+	contract := s.network.GetContract(s.chaincode)
+	changes, err := readApplications(ctx, snapshotPageSize, func(args ...string) ([]byte, error) {
+		return contract.EvaluateTransaction("getApplications", args...)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return info.Height - 1, changes, nil
+}
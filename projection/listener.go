@@ -0,0 +1,85 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+)
+
+// 从事件来源读取链码事件并更新投影
+type Listener struct {
+	source Source
+	store  *Store
+}
+
+func NewListener(source Source, store *Store) *Listener {
+	return &Listener{source: source, store: store}
+}
+
+// 投影的启动方式
+type Mode int
+
+const (
+	// 从检查点继续 没有检查点时 来源实现了 Snapshotter 就先用快照初始化投影 否则从创世区块开始
+	Resume Mode = iota
+	// 清空投影后从创世区块重放全部事件
+	RebuildFromGenesis
+	// 清空投影后用快照初始化 再从快照的区块开始 来源需要实现 Snapshotter
+	RebuildFromSnapshot
+)
+
+// 从检查点所在的区块开始处理事件 返回本次处理的事件数量
+// 检查点所在区块中已经处理过的事件会再处理一次 事件是写入后的完整内容 重复处理不影响结果
+// 从创世区块开始时 账本中有链码发出变更事件之前写入的申请 处理到这些申请的事件时返回 InconsistentError 参考 Store.Apply
+func (l *Listener) Run(ctx context.Context, mode Mode) (int, error) {
+	snapshotter, canSnapshot := l.source.(Snapshotter)
+
+	switch mode {
+	case RebuildFromGenesis:
+		err := l.store.Reset()
+		if err != nil {
+			return 0, err
+		}
+		// 先写入创世区块的检查点 中断后从检查点继续时仍然是从创世区块重放 而不是读取快照
+		err = l.store.Seed(Checkpoint{}, nil)
+		if err != nil {
+			return 0, err
+		}
+	case RebuildFromSnapshot:
+		if !canSnapshot {
+			return 0, fmt.Errorf("事件来源不支持读取账本快照")
+		}
+		err := l.store.Reset()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	checkpoint, found, err := l.store.Checkpoint()
+	if err != nil {
+		return 0, err
+	}
+
+	if canSnapshot && !found {
+		blockNumber, changes, err := snapshotter.Snapshot(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		checkpoint = Checkpoint{BlockNumber: blockNumber}
+		err = l.store.Seed(checkpoint, changes)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	applied := 0
+	err = l.source.Events(ctx, checkpoint.BlockNumber, func(event ChaincodeEvent) error {
+		err := l.store.Apply(event)
+		if err != nil {
+			return err
+		}
+		applied++
+		return nil
+	})
+	return applied, err
+}
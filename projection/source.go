@@ -0,0 +1,67 @@
+// Package projection 消费 Sxc 的链码事件 在关系型数据库中维护申请 捐赠 贷款 充值的投影
+// 供看板按医院 按状态等维度做汇总查询 不需要扫描账本
+// 事件来源可以是节点 FabricSource 也可以是区块文件 BlockFileSource
+// 节点还可以提供账本当前状态的快照 链码发出变更事件之前写入的申请只能从快照得到
+package projection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/sxc"
+)
+
+// 一个有效交易发出的链码事件
+type ChaincodeEvent struct {
+	BlockNumber   uint64
+	TxID          string
+	ChaincodeName string
+	EventName     string // 为空表示交易没有发出事件
+	Payload       []byte
+}
+
+// 链码事件的来源
+type Source interface {
+	// 从 startBlock 开始按区块顺序把事件交给 handle
+	// handle 返回错误时停止并返回这个错误 ctx 取消时返回 ctx.Err()
+	// 区块文件读完时返回 nil 节点的事件流不会主动结束
+	Events(ctx context.Context, startBlock uint64, handle func(ChaincodeEvent) error) error
+}
+
+// 账本当前状态的来源 投影没有检查点时先用快照初始化 再从快照的区块开始处理事件
+// 链码发出变更事件之前写入的申请没有事件 只能从快照得到
+type Snapshotter interface {
+	// 返回读取状态之前的最后一个区块号和全部申请的当前状态 格式与变更事件相同 参考 sxc.ApplicationPage
+	// 读取期间新提交的交易会在之后从这个区块开始处理事件时再处理一次
+	Snapshot(ctx context.Context) (uint64, []sxc.ChangeEvent, error)
+}
+
+// 通过 getApplications 分页读取全部申请 evaluate 按参数调用 getApplications
+func readApplications(ctx context.Context, pageSize int, evaluate func(args ...string) ([]byte, error)) ([]sxc.ChangeEvent, error) {
+	changes := []sxc.ChangeEvent{}
+	bookmark := ""
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		pageAsBytes, err := evaluate(strconv.Itoa(pageSize), bookmark)
+		if err != nil {
+			return nil, fmt.Errorf("读取申请列表失败 %s", err)
+		}
+
+		page := sxc.ApplicationPage{}
+		err = json.Unmarshal(pageAsBytes, &page)
+		if err != nil {
+			return nil, fmt.Errorf("申请列表格式错误 %s", bookmark)
+		}
+		changes = append(changes, page.Applications...)
+
+		if page.Bookmark == "" {
+			return changes, nil
+		}
+		bookmark = page.Bookmark
+	}
+}
@@ -1,10 +1,13 @@
-package main
+// Package sample implements a simple chaincode to manage an asset.
+// The chaincode entry point is cmd/sample.
+package sample
 
 import (
 	"fmt"
 
-	"github.com/hyperledger/fabric/core/chaincode/shim"
-	"github.com/hyperledger/fabric/protos/peer"
+	"github.com/ForLina/sxc_contract/core/response"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
 )
 
 // SimpleAsset implements a simple chaincode to manage an asset
@@ -45,12 +48,9 @@ func (t *SimpleAsset) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
 	} else { // assume 'get' even if fn is nil
 		result, err = get(stub, args)
 	}
-	if err != nil {
-		return shim.Error(err.Error())
-	}
 
 	// Return the result as success payload
-	return shim.Success([]byte(result))
+	return response.FromResult(result, err)
 }
 
 // Set stores the asset (both key and value) on the ledger. If the key exists,
@@ -82,10 +82,3 @@ func get(stub shim.ChaincodeStubInterface, args []string) (string, error) {
 	}
 	return string(value), nil
 }
-
-// main function starts up the chaincode in the container during instantiate
-func main() {
-	if err := shim.Start(new(SimpleAsset)); err != nil {
-		fmt.Printf("Error starting SimpleAsset chaincode: %s", err)
-	}
-}
\ No newline at end of file
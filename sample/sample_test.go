@@ -0,0 +1,43 @@
+package sample_test
+
+import (
+	"testing"
+
+	"github.com/ForLina/sxc_contract/scenario"
+)
+
+func text(s string) *string {
+	return &s
+}
+
+func TestSimpleAsset(t *testing.T) {
+	tests := []struct {
+		name string
+		init []string
+		step scenario.Step
+	}{
+		{"实例化参数数目", nil, scenario.Step{Init: true, Args: []string{"a"}, Error: "Expecting a key and a value"}},
+		{"实例化", nil, scenario.Step{Init: true, Args: []string{"a", "10"}, State: []scenario.StateExpectation{{Key: "a", Raw: text("10")}}}},
+		{"查询", []string{"a", "10"}, scenario.Step{Args: []string{"get", "a"}, Payload: text("10")}},
+		{"其他函数名按查询处理", []string{"a", "10"}, scenario.Step{Args: []string{"read", "a"}, Payload: text("10")}},
+		{"查询参数数目", []string{"a", "10"}, scenario.Step{Args: []string{"get"}, Error: "Expecting a key"}},
+		{"资产不存在", []string{"a", "10"}, scenario.Step{Args: []string{"get", "b"}, Error: "Asset not found: b"}},
+		{"设置", []string{"a", "10"}, scenario.Step{Args: []string{"set", "a", "20"}, Payload: text("20"), State: []scenario.StateExpectation{{Key: "a", Raw: text("20")}}}},
+		{"设置新资产", []string{"a", "10"}, scenario.Step{Args: []string{"set", "b", "5"}, Payload: text("5"), State: []scenario.StateExpectation{{Key: "b", Raw: text("5")}}}},
+		{"设置参数数目", []string{"a", "10"}, scenario.Step{Args: []string{"set", "a"}, Error: "Expecting a key and a value"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := scenario.Run(scenario.Scenario{Chaincode: "sample", Init: tt.init, Steps: []scenario.Step{tt.step}})
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			for _, step := range result.Steps {
+				if step.Err != nil {
+					t.Error(step.Err)
+				}
+			}
+		})
+	}
+}
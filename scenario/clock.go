@@ -0,0 +1,54 @@
+package scenario
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 可以指定交易时间的链码
+// MockStub 在每笔交易开始时把交易时间设置为当前时间 这里在调用链码之前覆盖为步骤中指定的时间
+type clockChaincode struct {
+	chaincode shim.Chaincode
+	now       *timestamp.Timestamp // 为空时使用 MockStub 设置的当前时间
+}
+
+// 设置下一笔交易的时间 value 为 RFC3339 格式 为空时使用当前时间
+func (c *clockChaincode) set(value string) error {
+	c.now = nil
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fmt.Errorf("交易时间需要是RFC3339格式 %s", value)
+	}
+	c.now, err = ptypes.TimestampProto(t)
+	if err != nil {
+		return fmt.Errorf("交易时间超出范围 %s", value)
+	}
+	return nil
+}
+
+func (c *clockChaincode) apply(stub shim.ChaincodeStubInterface) {
+	mock, ok := stub.(*shimtest.MockStub)
+	if ok && c.now != nil {
+		mock.TxTimestamp = c.now
+	}
+}
+
+func (c *clockChaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	c.apply(stub)
+	return c.chaincode.Init(stub)
+}
+
+func (c *clockChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	c.apply(stub)
+	return c.chaincode.Invoke(stub)
+}
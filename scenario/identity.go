@@ -0,0 +1,88 @@
+package scenario
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// 生成属于某个MSP的调用者身份 序列化后可以作为 MockStub 的 Creator
+// 证书是自签名的 只用于在场景中区分调用者的组织
+func NewIdentity(mspID string) ([]byte, error) {
+	return NewUserIdentity(mspID, "", nil)
+}
+
+// Fabric CA 在证书中写入属性时使用的扩展
+var attributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+// 生成某个MSP下用户的身份 同一个MSP下不同用户的证书主题不同 cid.GetID 也不同
+// 入参列表
+//
+//	mspID 组织的MSP ID
+//	name 用户名 为空时证书的CN为MSP ID
+//	attributes 证书属性 与 Fabric CA 签发的证书格式一致 可以通过 cid.GetAttributeValue 读取
+func NewUserIdentity(mspID string, name string, attributes map[string]string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成密钥失败")
+	}
+
+	commonName := mspID
+	if name != "" {
+		commonName = name
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{mspID}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	if len(attributes) > 0 {
+		attributesAsBytes, err := json.Marshal(map[string]interface{}{"attrs": attributes})
+		if err != nil {
+			return nil, fmt.Errorf("证书属性转换为json失败")
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: attributesOID, Value: attributesAsBytes}}
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("生成证书失败")
+	}
+
+	identity := &msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}),
+	}
+
+	identityAsBytes, err := proto.Marshal(identity)
+	if err != nil {
+		return nil, fmt.Errorf("序列化调用者身份失败")
+	}
+
+	return identityAsBytes, nil
+}
+
+// 按场景中的写法生成调用者身份
+// creator 为 MSP ID 或者 MSP ID/用户名 例如 Org1MSP/alice
+func CreatorIdentity(creator string, attributes map[string]string) ([]byte, error) {
+	mspID, name := creator, ""
+	if i := strings.Index(creator, "/"); i >= 0 {
+		mspID, name = creator[:i], creator[i+1:]
+	}
+	return NewUserIdentity(mspID, name, attributes)
+}
@@ -0,0 +1,334 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+)
+
+// 金额比较的容差
+const amountTolerance = 1e-6
+
+// 随机序列操作的申请编号
+const propertyApplication = "1"
+
+// 随机序列中的一笔交易 参数不包含申请编号
+type Operation struct {
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+}
+
+// 资金相关的不变量 每一步交易之后都需要成立
+type Invariant struct {
+	Name  string
+	Check func(application sxc.Application, ledger sxc.Ledger) error
+}
+
+var Invariants = []Invariant{
+	{"loan_total", checkLoanTotal},
+	{"received_loan_total", checkReceivedLoanTotal},
+	{"balance", checkBalance},
+	{"counters", checkCounters},
+}
+
+// 贷款总额不能超过募集金额
+func checkLoanTotal(application sxc.Application, ledger sxc.Ledger) error {
+	if application.LoanTotal > application.AmountRaised+amountTolerance {
+		return fmt.Errorf("贷款总额 %v 超过募集金额 %v", application.LoanTotal, application.AmountRaised)
+	}
+	return nil
+}
+
+// 已放款总额不能超过贷款总额
+func checkReceivedLoanTotal(application sxc.Application, ledger sxc.Ledger) error {
+	if application.ReceivedLoanTotal > application.LoanTotal+amountTolerance {
+		return fmt.Errorf("已放款总额 %v 超过贷款总额 %v", application.ReceivedLoanTotal, application.LoanTotal)
+	}
+	return nil
+}
+
+// 可用资金不能为负数 可用资金为捐赠加已到账的贷款减去充值
+// 分别按申请中的汇总字段和按明细记录计算 汇总字段与记录不一致时也能发现透支
+func checkBalance(application sxc.Application, ledger sxc.Ledger) error {
+	available := application.AmountRaised + application.ReceivedLoanTotal - application.RechargeTotal
+	if available < -amountTolerance {
+		return fmt.Errorf("可用资金为负数 %v", available)
+	}
+
+	donations, err := ledger.Donations.List(application.ApplicationNumber)
+	if err != nil {
+		return err
+	}
+	loans, err := ledger.Loans.List(application.ApplicationNumber)
+	if err != nil {
+		return err
+	}
+	recharges, err := ledger.Recharges.List(application.ApplicationNumber)
+	if err != nil {
+		return err
+	}
+
+	recorded := 0.0
+	for _, donation := range donations {
+		recorded += donation.Amount
+	}
+	for _, loan := range loans {
+		if loan.MoneyReceived {
+			recorded += loan.LoanAmount
+		}
+	}
+	for _, recharge := range recharges {
+		recorded -= recharge.Amount
+	}
+	if recorded < -amountTolerance {
+		return fmt.Errorf("按明细记录计算的可用资金为负数 %v", recorded)
+	}
+	return nil
+}
+
+// 计数器与明细记录数一致
+func checkCounters(application sxc.Application, ledger sxc.Ledger) error {
+	donations, err := ledger.Donations.List(application.ApplicationNumber)
+	if err != nil {
+		return err
+	}
+	if len(donations) != application.DonateCounter {
+		return fmt.Errorf("捐赠计数器 %d 与捐赠记录数 %d 不一致", application.DonateCounter, len(donations))
+	}
+
+	loans, err := ledger.Loans.List(application.ApplicationNumber)
+	if err != nil {
+		return err
+	}
+	if len(loans) != application.LoanCounter {
+		return fmt.Errorf("贷款计数器 %d 与贷款记录数 %d 不一致", application.LoanCounter, len(loans))
+	}
+
+	recharges, err := ledger.Recharges.List(application.ApplicationNumber)
+	if err != nil {
+		return err
+	}
+	if len(recharges) != application.RechargeCounter {
+		return fmt.Errorf("充值计数器 %d 与充值记录数 %d 不一致", application.RechargeCounter, len(recharges))
+	}
+
+	return nil
+}
+
+// 不变量被破坏
+type Violation struct {
+	Invariant string // 不变量名称
+	Step      int    // 第几笔交易之后被破坏 从0开始
+	Err       error
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("第 %d 笔交易之后不变量 %s 不成立 %s", v.Step+1, v.Invariant, v.Err)
+}
+
+// 在新的 MockStub 上执行一组交易 每一步之后检查全部不变量
+// 交易本身被链码拒绝不算失败 返回第一个被破坏的不变量
+func CheckSequence(operations []Operation) (*Violation, error) {
+	stub := shimtest.NewMockStub("property", new(sxc.Sxc))
+
+	creator, err := NewIdentity("Org1MSP")
+	if err != nil {
+		return nil, err
+	}
+	stub.Creator = creator
+
+	setup := [][]string{
+		{"init", "[\"Org1MSP\"]"},
+		{"applicate", propertyApplication, "name", "id", "hospital", "department", "street", "card", "md5", "100000"},
+		{"hVerify", propertyApplication, "operator", sxc.Agree, "100000", "[]"},
+	}
+	for i, args := range setup {
+		txID := fmt.Sprintf("setup%d", i)
+		var status int32
+		if i == 0 {
+			status = stub.MockInit(txID, toBytes(args)).Status
+		} else {
+			status = stub.MockInvoke(txID, toBytes(args)).Status
+		}
+		if status != 200 {
+			return nil, fmt.Errorf("初始化申请失败 %v", args)
+		}
+	}
+
+	ledger := sxc.NewStubLedger(stub)
+	for i, operation := range operations {
+		args := append([]string{operation.Function, propertyApplication}, operation.Args...)
+		stub.MockInvoke(fmt.Sprintf("tx%d", i), toBytes(args))
+		DrainEvents(stub)
+
+		application, err := ledger.Applications.Get(propertyApplication)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, invariant := range Invariants {
+			err = invariant.Check(application, ledger)
+			if err != nil {
+				return &Violation{Invariant: invariant.Name, Step: i, Err: err}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func toBytes(args []string) [][]byte {
+	argsAsBytes := [][]byte{}
+	for _, arg := range args {
+		argsAsBytes = append(argsAsBytes, []byte(arg))
+	}
+	return argsAsBytes
+}
+
+// 随机生成一组交易
+// 金额大多为正数 偶尔为0或负数 放款时的计数器和贷款单号大多指向已经申请过的贷款
+func Generate(r *rand.Rand, n int) []Operation {
+	operations := []Operation{}
+	loans := 0
+
+	for i := 0; i < n; i++ {
+		serialNumber := "sn" + strconv.Itoa(i)
+
+		switch p := r.Intn(100); {
+		case p < 30:
+			operations = append(operations, Operation{"donate", []string{"donator", randomAmount(r), serialNumber, "platform"}})
+		case p < 50:
+			loans++
+			operations = append(operations, Operation{"loan", []string{randomAmount(r), "L" + strconv.Itoa(loans), "2020-09", "24"}})
+		case p < 70:
+			counter := r.Intn(loans+1) + 1
+			operations = append(operations, Operation{"receivedLoan", []string{"L" + strconv.Itoa(counter), strconv.Itoa(counter), serialNumber}})
+		case p < 95:
+			operations = append(operations, Operation{"recharge", []string{serialNumber, randomAmount(r)}})
+		default:
+			operations = append(operations, Operation{"setCheat", []string{}})
+		}
+	}
+
+	return operations
+}
+
+func randomAmount(r *rand.Rand) string {
+	switch p := r.Intn(20); {
+	case p == 0:
+		return "0"
+	case p == 1:
+		return "-" + strconv.Itoa(r.Intn(100)+1)
+	default:
+		return strconv.FormatFloat(float64(r.Intn(50000))/100, 'f', -1, 64)
+	}
+}
+
+// 缩小失败的交易序列 逐个尝试删除交易 只要同一个不变量仍然被破坏就保留删除
+func Minimize(operations []Operation, invariant string) ([]Operation, error) {
+	current := operations
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(current); i++ {
+			candidate := append(append([]Operation{}, current[:i]...), current[i+1:]...)
+
+			violation, err := CheckSequence(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if violation != nil && violation.Invariant == invariant {
+				current = candidate[:violation.Step+1]
+				changed = true
+				break
+			}
+		}
+	}
+	return current, nil
+}
+
+// 缩小后保存的失败序列 修复之后作为回归用例重放
+type Regression struct {
+	Name       string      `json:"name"`
+	Invariant  string      `json:"invariant"` // 当时被破坏的不变量
+	Message    string      `json:"message"`   // 当时的错误信息
+	Seed       int64       `json:"seed"`      // 生成序列使用的随机种子
+	Operations []Operation `json:"operations"`
+}
+
+// 读取目录下全部的回归用例 按文件名排序
+func LoadRegressions(dir string) ([]Regression, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("读取回归用例目录失败 %s", dir)
+	}
+	sort.Strings(paths)
+
+	regressions := []Regression{}
+	for _, path := range paths {
+		regressionAsBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取回归用例失败 %s", path)
+		}
+
+		regression := Regression{}
+		err = json.Unmarshal(regressionAsBytes, &regression)
+		if err != nil {
+			return nil, fmt.Errorf("回归用例格式错误 %s %s", path, err)
+		}
+		regressions = append(regressions, regression)
+	}
+
+	return regressions, nil
+}
+
+// 保存回归用例 文件名为用例名称
+func SaveRegression(dir string, regression Regression) (string, error) {
+	regressionAsBytes, err := json.MarshalIndent(regression, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("无法将回归用例转换为Json字符串")
+	}
+
+	path := filepath.Join(dir, regression.Name+".json")
+	err = os.WriteFile(path, append(regressionAsBytes, '\n'), 0644)
+	if err != nil {
+		return "", fmt.Errorf("写入回归用例失败 %s", path)
+	}
+
+	return path, nil
+}
+
+// 将字节解码为交易序列 供 FuzzLedgerInvariants 使用
+// 第1个字节决定交易类型 第2和第3个字节决定金额 第3个字节同时决定放款的计数器
+func DecodeOperations(data []byte) []Operation {
+	operations := []Operation{}
+	loans := 0
+
+	for i := 0; i+2 < len(data); i += 3 {
+		amount := strconv.FormatFloat(float64(int(data[i+1])<<8|int(data[i+2]))/100, 'f', -1, 64)
+		serialNumber := "sn" + strconv.Itoa(i/3)
+
+		switch data[i] % 5 {
+		case 0:
+			operations = append(operations, Operation{"donate", []string{"donator", amount, serialNumber, "platform"}})
+		case 1:
+			loans++
+			operations = append(operations, Operation{"loan", []string{amount, "L" + strconv.Itoa(loans), "2020-09", "24"}})
+		case 2:
+			counter := int(data[i+2])%(loans+1) + 1
+			operations = append(operations, Operation{"receivedLoan", []string{"L" + strconv.Itoa(counter), strconv.Itoa(counter), serialNumber}})
+		case 3:
+			operations = append(operations, Operation{"recharge", []string{serialNumber, amount}})
+		default:
+			operations = append(operations, Operation{"setCheat", []string{}})
+		}
+	}
+
+	return operations
+}
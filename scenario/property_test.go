@@ -0,0 +1,148 @@
+package scenario
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/ForLina/sxc_contract/sxc"
+)
+
+// 重放 regressions 目录下保存的失败序列 修复之后都不能再破坏不变量
+func TestRegressions(t *testing.T) {
+	regressions, err := LoadRegressions("regressions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, regression := range regressions {
+		t.Run(regression.Name, func(t *testing.T) {
+			violation, err := CheckSequence(regression.Operations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if violation != nil {
+				t.Fatal(violation)
+			}
+		})
+	}
+}
+
+// 用固定的随机种子生成交易序列 失败时输出缩小后的序列 可以用 cmd/invariants 保存为回归用例
+func TestInvariantsProperty(t *testing.T) {
+	runs, steps := 50, 30
+	if testing.Short() {
+		runs = 10
+	}
+
+	for seed := int64(1); seed <= int64(runs); seed++ {
+		operations := Generate(rand.New(rand.NewSource(seed)), steps)
+
+		violation, err := CheckSequence(operations)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if violation == nil {
+			continue
+		}
+
+		minimized, err := Minimize(operations, violation.Invariant)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		t.Fatalf("seed %d: %v\n缩小后的序列 %v", seed, violation, minimized)
+	}
+}
+
+// 捐赠和放款之后充值 可用资金为负数时 balance 不变量需要报错
+func TestCheckBalance(t *testing.T) {
+	ledger := sxc.NewMemoryLedger()
+	err := sxc.Apply(ledger, sxc.Application{ApplicationNumber: "1", NeedAmount: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sxc.Verify(ledger, "1", "op", true, 1000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sxc.Donate(ledger, "1", sxc.Donation{Amount: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ledger.Loans.Put("1", 1, sxc.LoanInfo{LoanNumber: "L1", LoanAmount: 50, MoneyReceived: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ledger.Recharges.Put("1", 1, sxc.RechargeHistory{Amount: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	application, err := ledger.Applications.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	application.LoanCounter, application.LoanTotal, application.ReceivedLoanTotal = 1, 50, 50
+	application.RechargeCounter, application.RechargeTotal = 1, 150
+
+	tests := []struct {
+		name   string
+		modify func(application *sxc.Application)
+		error  string
+	}{
+		{"可用资金为0", func(application *sxc.Application) {}, ""},
+		{"汇总的充值总额超过可用资金", func(application *sxc.Application) { application.RechargeTotal = 151 }, "可用资金为负数 -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := application
+			tt.modify(&modified)
+
+			err := checkBalance(modified, ledger)
+			if tt.error == "" && err != nil {
+				t.Fatalf("不应该报错 %v", err)
+			}
+			if tt.error != "" && (err == nil || err.Error() != tt.error) {
+				t.Fatalf("err = %v, want %q", err, tt.error)
+			}
+		})
+	}
+
+	// 明细记录透支 汇总字段看不出来
+	err = ledger.Recharges.Put("1", 2, sxc.RechargeHistory{Amount: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checkBalance(application, ledger)
+	if err == nil || err.Error() != "按明细记录计算的可用资金为负数 -10" {
+		t.Fatalf("err = %v, want 按明细记录计算的可用资金为负数 -10", err)
+	}
+}
+
+// 将输入的每3个字节解码为一笔交易 每一步之后检查全部不变量
+// 范例 go test ./scenario -run '^$' -fuzz FuzzLedgerInvariants -fuzztime 1m
+func FuzzLedgerInvariants(f *testing.F) {
+	// 捐赠100 贷款50 收到放款 充值120
+	f.Add([]byte{0, 0x27, 0x10, 1, 0x13, 0x88, 2, 0, 0, 3, 0x2e, 0xe0})
+	// 没有捐赠时充值 对应回归用例 balance_1
+	f.Add([]byte{3, 0x6e, 0x02})
+	// 贷款超过募集金额 放款指向不存在的贷款
+	f.Add([]byte{0, 0x03, 0xe8, 1, 0x27, 0x10, 2, 0, 1})
+	// 标记欺诈之后捐赠 放款和充值
+	f.Add([]byte{0, 0x27, 0x10, 1, 0x03, 0xe8, 4, 0, 0, 0, 0x27, 0x10, 2, 0, 0, 3, 0x03, 0xe8})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		operations := DecodeOperations(data)
+		if len(operations) == 0 {
+			t.Skip()
+		}
+
+		violation, err := CheckSequence(operations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if violation != nil {
+			t.Fatalf("%v\n交易序列 %v", violation, operations)
+		}
+	})
+}
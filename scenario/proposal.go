@@ -0,0 +1,47 @@
+package scenario
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 与节点一样在实例化交易的提案中标记 isInit 的链码
+// MockStub 的 MockInit 不设置交易提案 合约据提案区分实例化交易和普通交易
+type initChaincode struct {
+	chaincode shim.Chaincode
+}
+
+func (c *initChaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return c.chaincode.Init(&initStub{ChaincodeStubInterface: stub})
+}
+
+func (c *initChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return c.chaincode.Invoke(stub)
+}
+
+// 实例化交易的 stub 交易提案中只有 isInit 和交易参数
+type initStub struct {
+	shim.ChaincodeStubInterface
+}
+
+func (s *initStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	spec := &peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{
+			Input: &peer.ChaincodeInput{Args: s.GetArgs(), IsInit: true},
+		},
+	}
+	specAsBytes, err := proto.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	payloadAsBytes, err := proto.Marshal(&peer.ChaincodeProposalPayload{Input: specAsBytes})
+	if err != nil {
+		return nil, err
+	}
+	proposalAsBytes, err := proto.Marshal(&peer.Proposal{Payload: payloadAsBytes})
+	if err != nil {
+		return nil, err
+	}
+	return &peer.SignedProposal{ProposalBytes: proposalAsBytes}, nil
+}
@@ -0,0 +1,374 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 场景执行过程中的状态
+type runner struct {
+	scenario   Scenario
+	stub       *shimtest.MockStub            // 场景的链码
+	peers      map[string]*shimtest.MockStub // 同时部署的其他链码 按链码名称索引
+	clocks     []*clockChaincode             // 全部链码的时钟 被调用的链码与调用者使用相同的交易时间
+	identities map[string][]byte             // 按调用者缓存的身份
+	variables  map[string]string             // 步骤保存的返回值
+	counter    int                           // 交易计数器 用于生成交易ID
+}
+
+// 执行一个步骤并校验结果
+func (r *runner) run(step Step) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("链码执行时 panic %v", p)
+		}
+	}()
+
+	stub := r.stub
+	if step.Chaincode != "" {
+		peer, ok := r.peers[step.Chaincode]
+		if !ok {
+			return fmt.Errorf("场景没有部署链码 %s", step.Chaincode)
+		}
+		stub = peer
+	}
+	stubs := []*shimtest.MockStub{r.stub}
+	for _, peer := range r.peers {
+		stubs = append(stubs, peer)
+	}
+
+	// 被调用的链码与调用者看到相同的身份和 transient 数据
+	creator := step.Creator
+	if creator == "" {
+		creator = r.scenario.Creator
+	}
+	if creator != "" {
+		identity, err := r.identity(creator)
+		if err != nil {
+			return err
+		}
+		for _, s := range stubs {
+			s.Creator = identity
+		}
+	}
+
+	transient, err := transientMap(step.Transient)
+	if err != nil {
+		return err
+	}
+	for _, s := range stubs {
+		s.TransientMap = transient
+	}
+
+	for _, clock := range r.clocks {
+		err = clock.set(step.Time)
+		if err != nil {
+			return err
+		}
+	}
+
+	args := [][]byte{}
+	for _, arg := range step.Args {
+		args = append(args, []byte(r.expand(arg)))
+	}
+
+	r.counter++
+	txID := fmt.Sprintf("tx%d", r.counter)
+
+	var response peer.Response
+	if step.Init {
+		response = stub.MockInit(txID, args)
+	} else {
+		response = stub.MockInvoke(txID, args)
+	}
+
+	events := DrainEvents(stub)
+	for _, s := range stubs {
+		if s != stub {
+			DrainEvents(s)
+		}
+	}
+
+	if step.Payload != nil {
+		payload := r.expand(*step.Payload)
+		step.Payload = &payload
+	}
+	step.JSON = r.expandValue(step.JSON)
+
+	err = checkResponse(step, response)
+	if err != nil {
+		return err
+	}
+
+	if step.Save != "" {
+		r.variables[step.Save] = string(response.Payload)
+	}
+
+	for _, expectation := range step.State {
+		err = checkState(stub, expectation)
+		if err != nil {
+			return err
+		}
+	}
+
+	if step.Event != nil {
+		return r.checkEvent(*step.Event, events)
+	}
+
+	return nil
+}
+
+// 取出 MockStub 已经发出的链码事件
+// MockStub 的事件通道容量有限 同一个 MockStub 执行多笔交易时需要在每笔交易之后取出 否则 SetEvent 会阻塞
+func DrainEvents(stub *shimtest.MockStub) []*peer.ChaincodeEvent {
+	events := []*peer.ChaincodeEvent{}
+	for {
+		select {
+		case event := <-stub.ChaincodeEventsChannel:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// 校验交易发出的最后一个链码事件
+func (r *runner) checkEvent(expectation EventExpectation, events []*peer.ChaincodeEvent) error {
+	if expectation.Absent {
+		if len(events) > 0 {
+			return fmt.Errorf("期望不发出事件 实际发出了 %s", events[len(events)-1].EventName)
+		}
+		return nil
+	}
+
+	if len(events) == 0 {
+		return fmt.Errorf("期望发出事件 %s 实际没有发出事件", expectation.Name)
+	}
+
+	event := events[len(events)-1]
+	if event.EventName != expectation.Name {
+		return fmt.Errorf("事件名称不一致 期望 %s 实际 %s", expectation.Name, event.EventName)
+	}
+
+	if expectation.Value == nil {
+		return nil
+	}
+
+	var actual interface{}
+	err := json.Unmarshal(event.Payload, &actual)
+	if err != nil {
+		return fmt.Errorf("事件内容不是json %s", event.Payload)
+	}
+	return match(r.expandValue(expectation.Value), actual, "event")
+}
+
+// 替换参数中的变量
+func (r *runner) expand(arg string) string {
+	for name, value := range r.variables {
+		arg = strings.Replace(arg, "${"+name+"}", value, -1)
+	}
+	return arg
+}
+
+// 替换期望的json中字符串里的变量
+func (r *runner) expandValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.expand(v)
+	case map[string]interface{}:
+		expanded := map[string]interface{}{}
+		for key, field := range v {
+			expanded[key] = r.expandValue(field)
+		}
+		return expanded
+	case []interface{}:
+		expanded := []interface{}{}
+		for _, element := range v {
+			expanded = append(expanded, r.expandValue(element))
+		}
+		return expanded
+	default:
+		return value
+	}
+}
+
+func (r *runner) identity(creator string) ([]byte, error) {
+	identity, ok := r.identities[creator]
+	if ok {
+		return identity, nil
+	}
+
+	identity, err := CreatorIdentity(creator, r.scenario.Attributes[creator])
+	if err != nil {
+		return nil, err
+	}
+	r.identities[creator] = identity
+	return identity, nil
+}
+
+func transientMap(values map[string]interface{}) (map[string][]byte, error) {
+	transient := map[string][]byte{}
+	for key, value := range values {
+		if str, ok := value.(string); ok {
+			transient[key] = []byte(str)
+			continue
+		}
+
+		valueAsBytes, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("无法将 transient 数据转换为Json字符串 %s", key)
+		}
+		transient[key] = valueAsBytes
+	}
+	return transient, nil
+}
+
+// 校验状态码 返回值和错误信息
+func checkResponse(step Step, response peer.Response) error {
+	status := step.Status
+	if status == 0 {
+		status = 200
+		if step.Error != "" {
+			status = 500
+		}
+	}
+
+	if int(response.Status) != status {
+		return fmt.Errorf("期望状态码 %d 实际 %d %s", status, response.Status, response.Message)
+	}
+
+	if step.Error != "" && !strings.Contains(response.Message, step.Error) {
+		return fmt.Errorf("期望错误信息包含 %q 实际 %q", step.Error, response.Message)
+	}
+
+	if step.Payload != nil && string(response.Payload) != *step.Payload {
+		return fmt.Errorf("期望返回值 %q 实际 %q", *step.Payload, string(response.Payload))
+	}
+
+	if step.JSON != nil {
+		var actual interface{}
+		err := json.Unmarshal(response.Payload, &actual)
+		if err != nil {
+			return fmt.Errorf("返回值不是json %q", string(response.Payload))
+		}
+
+		err = match(step.JSON, actual, "返回值")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 校验账本状态
+func checkState(stub *shimtest.MockStub, expectation StateExpectation) error {
+	key := expectation.Key
+	if expectation.ObjectType != "" {
+		var err error
+		key, err = stub.CreateCompositeKey(expectation.ObjectType, expectation.Attributes)
+		if err != nil {
+			return fmt.Errorf("创建复合键失败 %s %v", expectation.ObjectType, expectation.Attributes)
+		}
+	}
+	name := describeKey(expectation)
+
+	var value []byte
+	var err error
+	if expectation.Collection != "" {
+		value, err = stub.GetPrivateData(expectation.Collection, key)
+	} else {
+		value, err = stub.GetState(key)
+	}
+	if err != nil {
+		return fmt.Errorf("读取账本状态失败 %s", name)
+	}
+
+	if expectation.Absent {
+		if value != nil {
+			return fmt.Errorf("期望 %s 不存在 实际 %s", name, string(value))
+		}
+		return nil
+	}
+
+	if value == nil {
+		return fmt.Errorf("期望 %s 存在 实际不存在", name)
+	}
+
+	if expectation.Raw != nil && string(value) != *expectation.Raw {
+		return fmt.Errorf("期望 %s 的值为 %q 实际 %q", name, *expectation.Raw, string(value))
+	}
+
+	if expectation.Value != nil {
+		var actual interface{}
+		err = json.Unmarshal(value, &actual)
+		if err != nil {
+			return fmt.Errorf("%s 的值不是json %q", name, string(value))
+		}
+		return match(expectation.Value, actual, name)
+	}
+
+	return nil
+}
+
+func describeKey(expectation StateExpectation) string {
+	name := expectation.Key
+	if expectation.ObjectType != "" {
+		name = expectation.ObjectType + "(" + strings.Join(expectation.Attributes, ",") + ")"
+	}
+	if expectation.Collection != "" {
+		name = expectation.Collection + ":" + name
+	}
+	return name
+}
+
+// json部分匹配
+// 对象只比较期望中出现的字段 数组要求长度相同并逐个比较 其他值要求相等
+func match(expected interface{}, actual interface{}, path string) error {
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		actualValue, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s 期望对象 实际 %v", path, actual)
+		}
+		for key, value := range expectedValue {
+			field, ok := actualValue[key]
+			if !ok {
+				return fmt.Errorf("%s 缺少字段 %s", path, key)
+			}
+			err := match(value, field, path+"."+key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		actualValue, ok := actual.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s 期望数组 实际 %v", path, actual)
+		}
+		if len(expectedValue) != len(actualValue) {
+			return fmt.Errorf("%s 期望 %d 个元素 实际 %d 个", path, len(expectedValue), len(actualValue))
+		}
+		for i := range expectedValue {
+			err := match(expectedValue[i], actualValue[i], fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		// 在 Go 代码中构造的期望值可能是整数 json解析出的数字都是 float64
+		if number, ok := expected.(int); ok {
+			expected = float64(number)
+		}
+		if expected != actual {
+			return fmt.Errorf("%s 期望 %v 实际 %v", path, expected, actual)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,278 @@
+// Package scenario 基于 shimtest.MockStub 的场景回放
+// 场景文件按顺序描述一组交易 以及每笔交易期望的返回值和账本状态
+// 仓库中的场景文件在 scenario/scenarios 下 通过 cmd/scenario 或者 go test ./scenario 运行
+// 各链码的测试也用 Go 代码构造场景 按表格逐个校验函数
+//
+// MockStub 没有实现历史查询和私有数据的范围查询 依赖这些接口的函数只能校验参数部分
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/sample"
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/ForLina/sxc_contract/sxc/contract"
+	"github.com/ForLina/sxc_contract/vote"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// 场景中可以使用的链码
+var Chaincodes = map[string]func() (shim.Chaincode, error){
+	"sxc": func() (shim.Chaincode, error) {
+		return new(sxc.Sxc), nil
+	},
+	"sxc-contract": func() (shim.Chaincode, error) {
+		chaincode, err := contractapi.NewChaincode(contract.NewSxcContract())
+		if err != nil {
+			return nil, err
+		}
+		return &initChaincode{chaincode: chaincode}, nil
+	},
+	"vote": func() (shim.Chaincode, error) {
+		return new(vote.VoteChaincode), nil
+	},
+	"sample": func() (shim.Chaincode, error) {
+		return new(sample.SimpleAsset), nil
+	},
+}
+
+// 一个场景
+type Scenario struct {
+	Name        string   `json:"name"`        // 场景名称
+	Description string   `json:"description"` // 场景说明
+	Chaincode   string   `json:"chaincode"`   // 链码名称 参考 Chaincodes
+	Creator     string   `json:"creator"`     // 默认的调用者 MSP ID 或者 MSP ID/用户名
+	Init        []string `json:"init"`        // 实例化参数 包含函数名 为空时不调用 Init
+	Steps       []Step   `json:"steps"`       // 按顺序执行的交易
+
+	Peers map[string][]string `json:"peers"` // 同时部署的其他链码 可以通过 InvokeChaincode 调用 值为实例化参数 为空时不调用 Init
+
+	Ledger map[string]interface{} `json:"ledger"` // 实例化之前写入的账本状态 用于模拟旧版本合约留下的数据 字符串原样写入 其他值转换为json
+
+	Attributes map[string]map[string]string `json:"attributes"` // 调用者证书中的属性 按调用者的写法索引
+}
+
+// 一笔交易以及期望的结果
+type Step struct {
+	Name      string                 `json:"name"`      // 步骤名称
+	Init      bool                   `json:"init"`      // 以 Init 的方式调用 例如升级
+	Creator   string                 `json:"creator"`   // 本笔交易的调用者 MSP ID 或者 MSP ID/用户名 为空时使用场景的默认值
+	Transient map[string]interface{} `json:"transient"` // transient 数据 字符串原样传入 其他值转换为json
+	Args      []string               `json:"args"`      // 交易参数 包含函数名 ${name} 会替换为之前保存的变量
+	Time      string                 `json:"time"`      // 交易时间 RFC3339 为空时使用当前时间
+	Chaincode string                 `json:"chaincode"` // 调用的链码 需要在场景的 peers 中 为空时为场景的链码
+
+	Status  int         `json:"status"`  // 期望的状态码 默认200 设置了 error 时默认500
+	Payload *string     `json:"payload"` // 期望的返回值 完全匹配
+	JSON    interface{} `json:"json"`    // 期望的返回值 按json部分匹配
+	Error   string      `json:"error"`   // 期望的错误信息中包含的内容
+	Save    string      `json:"save"`    // 将返回值保存为变量
+
+	State []StateExpectation `json:"state"` // 交易之后期望的账本状态
+	Event *EventExpectation  `json:"event"` // 期望交易发出的链码事件
+}
+
+// 期望的账本状态
+// 普通键使用 key 复合键使用 object_type 和 attributes
+type StateExpectation struct {
+	Key        string      `json:"key"`         // 普通键
+	ObjectType string      `json:"object_type"` // 复合键的对象类型
+	Attributes []string    `json:"attributes"`  // 复合键的属性
+	Collection string      `json:"collection"`  // 私有数据集合 为空时读取公开状态
+	Value      interface{} `json:"value"`       // 期望的值 按json部分匹配
+	Raw        *string     `json:"raw"`         // 期望的原始值 完全匹配
+	Absent     bool        `json:"absent"`      // 期望键不存在
+}
+
+// 期望的链码事件 Fabric 每笔交易只保留最后一个事件 只校验最后一个
+type EventExpectation struct {
+	Name   string      `json:"name"`   // 事件名称
+	Value  interface{} `json:"value"`  // 期望的事件内容 按json部分匹配
+	Absent bool        `json:"absent"` // 期望不发出事件
+}
+
+// 一个步骤的执行结果
+type StepResult struct {
+	Name string
+	Err  error
+}
+
+// 场景的执行结果
+type Result struct {
+	Scenario string
+	Err      error // 场景本身无法执行的原因
+	Steps    []StepResult
+}
+
+// 场景是否失败
+func (r Result) Failed() bool {
+	if r.Err != nil {
+		return true
+	}
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// 读取场景文件
+func Load(path string) (Scenario, error) {
+	scenario := Scenario{}
+
+	scenarioAsBytes, err := os.ReadFile(path)
+	if err != nil {
+		return scenario, fmt.Errorf("读取场景文件失败 %s", path)
+	}
+
+	err = json.Unmarshal(scenarioAsBytes, &scenario)
+	if err != nil {
+		return scenario, fmt.Errorf("场景文件格式错误 %s %s", path, err)
+	}
+
+	if scenario.Name == "" {
+		scenario.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return scenario, nil
+}
+
+// 读取目录下全部的 json 场景文件 按文件名排序
+func LoadDir(dir string) ([]Scenario, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("读取场景目录失败 %s", dir)
+	}
+	sort.Strings(paths)
+
+	scenarios := []Scenario{}
+	for _, path := range paths {
+		scenario, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, scenario)
+	}
+
+	return scenarios, nil
+}
+
+// 执行场景 某一步失败后继续执行后面的步骤
+func Run(scenario Scenario) Result {
+	result := Result{Scenario: scenario.Name}
+
+	newChaincode, ok := Chaincodes[scenario.Chaincode]
+	if !ok {
+		result.Err = fmt.Errorf("未知的链码 %s", scenario.Chaincode)
+		return result
+	}
+
+	chaincode, err := newChaincode()
+	if err != nil {
+		result.Err = fmt.Errorf("创建链码失败 %s %s", scenario.Chaincode, err)
+		return result
+	}
+
+	clock := &clockChaincode{chaincode: chaincode}
+	runner := &runner{
+		scenario:   scenario,
+		stub:       shimtest.NewMockStub(scenario.Name, clock),
+		peers:      map[string]*shimtest.MockStub{},
+		clocks:     []*clockChaincode{clock},
+		identities: map[string][]byte{},
+		variables:  map[string]string{},
+	}
+
+	names := []string{}
+	for name := range scenario.Peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		newPeer, ok := Chaincodes[name]
+		if !ok {
+			result.Err = fmt.Errorf("未知的链码 %s", name)
+			return result
+		}
+		peer, err := newPeer()
+		if err != nil {
+			result.Err = fmt.Errorf("创建链码失败 %s %s", name, err)
+			return result
+		}
+
+		peerClock := &clockChaincode{chaincode: peer}
+		peerStub := shimtest.NewMockStub(name, peerClock)
+		runner.stub.MockPeerChaincode(name, peerStub, "")
+		runner.peers[name] = peerStub
+		runner.clocks = append(runner.clocks, peerClock)
+
+		if len(scenario.Peers[name]) > 0 {
+			err = runner.run(Step{Name: "init " + name, Init: true, Chaincode: name, Args: scenario.Peers[name]})
+			if err != nil {
+				result.Err = err
+				return result
+			}
+		}
+	}
+
+	err = seedLedger(runner.stub, scenario.Ledger)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if len(scenario.Init) > 0 {
+		err = runner.run(Step{Name: "init", Init: true, Args: scenario.Init})
+		if err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	for i, step := range scenario.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d %s", i+1, strings.Join(step.Args, " "))
+		}
+		result.Steps = append(result.Steps, StepResult{Name: name, Err: runner.run(step)})
+	}
+
+	return result
+}
+
+// 在一笔单独的交易中写入场景的初始账本状态
+func seedLedger(stub *shimtest.MockStub, ledger map[string]interface{}) error {
+	if len(ledger) == 0 {
+		return nil
+	}
+
+	stub.MockTransactionStart("seed")
+	defer stub.MockTransactionEnd("seed")
+	for key, value := range ledger {
+		var valueAsBytes []byte
+		if str, ok := value.(string); ok {
+			valueAsBytes = []byte(str)
+		} else {
+			var err error
+			valueAsBytes, err = json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("无法将初始账本状态转换为Json字符串 %s", key)
+			}
+		}
+
+		err := stub.PutState(key, valueAsBytes)
+		if err != nil {
+			return fmt.Errorf("写入初始账本状态失败 %s", key)
+		}
+	}
+	return nil
+}
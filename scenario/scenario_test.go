@@ -0,0 +1,30 @@
+package scenario
+
+import (
+	"testing"
+)
+
+// 回放 scenarios 目录下的全部场景 与 cmd/scenario 的结果一致
+func TestScenarios(t *testing.T) {
+	scenarios, err := LoadDir("scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("scenarios 目录下没有场景文件")
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			result := Run(s)
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			for _, step := range result.Steps {
+				if step.Err != nil {
+					t.Errorf("%s: %v", step.Name, step.Err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 修复申请汇总数据后发出的事件 内容为 AuditReport
+const ApplicationRepairedEvent = "ApplicationRepaired"
+
+// 申请中由各类记录汇总得到的字段
+type ApplicationAggregates struct {
+	DonateCounter     int     `json:"donate_counter"`
+	AmountRaised      float64 `json:"amount_raised"`
+	LoanCounter       int     `json:"loan_counter"`
+	LoanTotal         float64 `json:"loan_total"`
+	ReceivedLoanTotal float64 `json:"received_loan_total"`
+	RechargeCounter   int     `json:"recharge_counter"`
+	RechargeTotal     float64 `json:"recharge_total"`
+	Balance           float64 `json:"balance"`
+}
+
+// 一个不一致的汇总字段
+type AggregateMismatch struct {
+	Field      string  `json:"field"`      // 字段名
+	Recorded   float64 `json:"recorded"`   // 申请中记录的值
+	Recomputed float64 `json:"recomputed"` // 根据明细记录重新计算的值
+}
+
+// 审计结果
+type AuditReport struct {
+	ApplicationNumber string                `json:"application_number"`
+	Consistent        bool                  `json:"consistent"`      // 汇总字段是否全部一致
+	Recorded          ApplicationAggregates `json:"recorded"`        // 申请中记录的汇总字段
+	Recomputed        ApplicationAggregates `json:"recomputed"`      // 根据明细记录重新计算的汇总字段
+	Mismatches        []AggregateMismatch   `json:"mismatches"`      // 不一致的字段
+	MissingRecords    []string              `json:"missing_records"` // 计数器范围内缺失的记录 类型,计数器
+}
+
+func recordedAggregates(application Application) ApplicationAggregates {
+	return ApplicationAggregates{
+		DonateCounter:     application.DonateCounter,
+		AmountRaised:      application.AmountRaised,
+		LoanCounter:       application.LoanCounter,
+		LoanTotal:         application.LoanTotal,
+		ReceivedLoanTotal: application.ReceivedLoanTotal,
+		RechargeCounter:   application.RechargeCounter,
+		RechargeTotal:     application.RechargeTotal,
+		Balance:           application.Balance,
+	}
+}
+
+// 根据明细记录重新计算汇总字段
+// 计数器取最大的记录序号 保证之后新增的记录不会覆盖已有记录
+// 余额只由捐赠增加 因此等于捐赠合计
+func recomputeAggregates(stub shim.ChaincodeStubInterface, applicationNumber string) (ApplicationAggregates, []string, error) {
+	aggregates := ApplicationAggregates{}
+	missing := []string{}
+
+	donations, err := getSubRecords(stub, donationObjectType, applicationNumber)
+	if err != nil {
+		return aggregates, missing, err
+	}
+	for _, record := range donations {
+		donation := Donation{}
+		err = decodeDocument(donationDocType, record.Value, &donation)
+		if err != nil {
+			return aggregates, missing, fmt.Errorf("捐赠记录json串转换为捐赠记录对象失败")
+		}
+		aggregates.AmountRaised += donation.Amount
+	}
+	aggregates.DonateCounter, missing = maxCounter(donationObjectType, donations, missing)
+	aggregates.Balance = aggregates.AmountRaised
+
+	loans, err := getSubRecords(stub, loanObjectType, applicationNumber)
+	if err != nil {
+		return aggregates, missing, err
+	}
+	for _, record := range loans {
+		loanInfo := LoanInfo{}
+		err = decodeDocument(loanDocType, record.Value, &loanInfo)
+		if err != nil {
+			return aggregates, missing, fmt.Errorf("贷款信息json串转换为贷款信息对象失败")
+		}
+		aggregates.LoanTotal += loanInfo.LoanAmount
+		if loanInfo.MoneyReceived {
+			aggregates.ReceivedLoanTotal += loanInfo.LoanAmount
+		}
+	}
+	aggregates.LoanCounter, missing = maxCounter(loanObjectType, loans, missing)
+
+	recharges, err := getSubRecords(stub, rechargeObjectType, applicationNumber)
+	if err != nil {
+		return aggregates, missing, err
+	}
+	for _, record := range recharges {
+		rechargeHistory := RechargeHistory{}
+		err = decodeDocument(rechargeDocType, record.Value, &rechargeHistory)
+		if err != nil {
+			return aggregates, missing, fmt.Errorf("充值记录json串转换为充值记录对象失败")
+		}
+		aggregates.RechargeTotal += rechargeHistory.Amount
+	}
+	aggregates.RechargeCounter, missing = maxCounter(rechargeObjectType, recharges, missing)
+
+	return aggregates, missing, nil
+}
+
+// 返回最大的记录序号 并记录 1 到最大序号之间缺失的记录
+func maxCounter(objectType string, records []subRecord, missing []string) (int, []string) {
+	max := 0
+	if len(records) > 0 {
+		max = records[len(records)-1].Counter
+	}
+
+	present := make(map[int]bool, len(records))
+	for _, record := range records {
+		present[record.Counter] = true
+	}
+	for counter := 1; counter <= max; counter++ {
+		if !present[counter] {
+			missing = append(missing, fmt.Sprintf("%s,%d", objectType, counter))
+		}
+	}
+
+	return max, missing
+}
+
+func compareAggregates(recorded ApplicationAggregates, recomputed ApplicationAggregates) []AggregateMismatch {
+	fields := []struct {
+		name       string
+		recorded   float64
+		recomputed float64
+	}{
+		{"donate_counter", float64(recorded.DonateCounter), float64(recomputed.DonateCounter)},
+		{"amount_raised", recorded.AmountRaised, recomputed.AmountRaised},
+		{"loan_counter", float64(recorded.LoanCounter), float64(recomputed.LoanCounter)},
+		{"loan_total", recorded.LoanTotal, recomputed.LoanTotal},
+		{"received_loan_total", recorded.ReceivedLoanTotal, recomputed.ReceivedLoanTotal},
+		{"recharge_counter", float64(recorded.RechargeCounter), float64(recomputed.RechargeCounter)},
+		{"recharge_total", recorded.RechargeTotal, recomputed.RechargeTotal},
+		{"balance", recorded.Balance, recomputed.Balance},
+	}
+
+	mismatches := []AggregateMismatch{}
+	for _, field := range fields {
+		if math.Abs(field.recorded-field.recomputed) > amountTolerance {
+			mismatches = append(mismatches, AggregateMismatch{Field: field.name, Recorded: field.recorded, Recomputed: field.recomputed})
+		}
+	}
+
+	return mismatches
+}
+
+func buildAuditReport(stub shim.ChaincodeStubInterface, application Application) (AuditReport, error) {
+	recomputed, missing, err := recomputeAggregates(stub, application.ApplicationNumber)
+	if err != nil {
+		return AuditReport{}, err
+	}
+
+	recorded := recordedAggregates(application)
+	mismatches := compareAggregates(recorded, recomputed)
+
+	return AuditReport{
+		ApplicationNumber: application.ApplicationNumber,
+		Consistent:        len(mismatches) == 0 && len(missing) == 0,
+		Recorded:          recorded,
+		Recomputed:        recomputed,
+		Mismatches:        mismatches,
+		MissingRecords:    missing,
+	}, nil
+}
+
+// 审计申请的汇总字段
+// 根据捐赠 贷款 充值记录重新计算汇总字段 并返回与申请中记录值不一致的字段
+// 入参列表
+//
+//	application_number 合约编号
+//
+// 范例 ["query", "auditApplication", "1"]
+func auditApplication(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	application, err := getApplication(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	report, err := buildAuditReport(stub, application)
+	if err != nil {
+		return "", err
+	}
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("无法将审计结果转换为Json字符串")
+	}
+
+	return string(reportAsBytes), nil
+}
+
+// 修复申请的汇总字段 只有管理员可以调用
+// 用重新计算的值覆盖申请中的汇总字段 并发出 ApplicationRepaired 事件 事件内容为修复前的审计结果
+// 入参列表
+//
+//	application_number 合约编号
+//
+// 范例 ["invoke", "repairApplication", "1"]
+func repairApplication(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	admin, err := isAdmin(stub)
+	if err != nil {
+		return "", err
+	}
+	if !admin {
+		return "", fmt.Errorf("只有管理员可以修复申请")
+	}
+
+	application, err := getApplication(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	report, err := buildAuditReport(stub, application)
+	if err != nil {
+		return "", err
+	}
+
+	recomputed := report.Recomputed
+	application.DonateCounter = recomputed.DonateCounter
+	application.AmountRaised = recomputed.AmountRaised
+	application.LoanCounter = recomputed.LoanCounter
+	application.LoanTotal = recomputed.LoanTotal
+	application.ReceivedLoanTotal = recomputed.ReceivedLoanTotal
+	application.RechargeCounter = recomputed.RechargeCounter
+	application.RechargeTotal = recomputed.RechargeTotal
+	application.Balance = recomputed.Balance
+
+	_, err = write(stub, application)
+	if err != nil {
+		return "", err
+	}
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("无法将审计结果转换为Json字符串")
+	}
+
+	err = stub.SetEvent(ApplicationRepairedEvent, reportAsBytes)
+	if err != nil {
+		return "", fmt.Errorf("发送修复事件失败")
+	}
+
+	return string(reportAsBytes), nil
+}
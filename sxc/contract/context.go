@@ -0,0 +1,105 @@
+package contract
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// 交易调用者的身份
+type CallerIdentity struct {
+	MSPID string          // 调用者所属组织的MSP ID
+	ID    string          // 调用者证书的唯一标识
+	Roles sxc.CallerRoles // 调用者组织拥有的角色
+	Init  bool            // 交易为实例化交易 即通过 --isInit 调用
+}
+
+// Sxc 合约使用的交易上下文 在 contractapi 的上下文上增加调用者身份
+type SxcContextInterface interface {
+	contractapi.TransactionContextInterface
+	GetCaller() CallerIdentity
+	SetCaller(CallerIdentity)
+}
+
+// 交易上下文的实现
+type SxcContext struct {
+	contractapi.TransactionContext
+	caller CallerIdentity
+}
+
+// 获取调用者身份 在交易执行前由 beforeTransaction 设置
+func (ctx *SxcContext) GetCaller() CallerIdentity {
+	return ctx.caller
+}
+
+// 设置调用者身份
+func (ctx *SxcContext) SetCaller(caller CallerIdentity) {
+	ctx.caller = caller
+}
+
+// 交易日志 链码容器的标准错误输出会被节点收集
+var logger = log.New(os.Stderr, "[SxcContract] ", log.LstdFlags)
+
+// 需要特定角色才能调用的交易
+// 在交易执行前按调用者身份拒绝 sxc 包中的业务函数仍然会再次校验 旧的 shim 入口依赖那里的校验
+// 没有治理配置时只有实例化交易可以升级 InitLedger 和 Upgrade 也可以通过普通交易调用 不能据此抢先设置治理组织列表
+var transactionRoles = map[string]func(CallerIdentity) bool{
+	"InitLedger": func(caller CallerIdentity) bool { return caller.Roles.Initialized || caller.Init },
+	"Upgrade": func(caller CallerIdentity) bool {
+		return caller.Roles.Governance || caller.Roles.Admin || (!caller.Roles.Initialized && caller.Init)
+	},
+	"SetRoles":          func(caller CallerIdentity) bool { return caller.Roles.Governance },
+	"SetCoveragePolicy": func(caller CallerIdentity) bool { return caller.Roles.Governance },
+	"RepairApplication": func(caller CallerIdentity) bool { return caller.Roles.Admin },
+}
+
+// 交易执行前 解析调用者身份并校验调用者的角色
+func beforeTransaction(ctx SxcContextInterface) error {
+	fn, _ := ctx.GetStub().GetFunctionAndParameters()
+	// 函数名带有合约名前缀 SxcContract:Upgrade
+	fn = fn[strings.LastIndex(fn, ":")+1:]
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("获取调用者MSP ID失败")
+	}
+
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("获取调用者ID失败")
+	}
+
+	roles, err := sxc.RolesOf(ctx.GetStub(), mspID)
+	if err != nil {
+		return err
+	}
+
+	isInit, err := sxc.IsInitTransaction(ctx.GetStub())
+	if err != nil {
+		return err
+	}
+
+	caller := CallerIdentity{MSPID: mspID, ID: id, Roles: roles, Init: isInit}
+	ctx.SetCaller(caller)
+	logger.Printf("交易开始 %s %s 调用者 %s %s", ctx.GetStub().GetTxID(), fn, caller.MSPID, caller.ID)
+
+	allowed, ok := transactionRoles[fn]
+	if ok && !allowed(caller) {
+		logger.Printf("交易拒绝 %s %s 调用者 %s 没有权限", ctx.GetStub().GetTxID(), fn, caller.MSPID)
+		return fmt.Errorf("调用者 %s 没有权限调用 %s", caller.MSPID, fn)
+	}
+	return nil
+}
+
+// 交易执行后记录日志 交易返回错误时 contractapi 不会调用此函数
+func afterTransaction(ctx SxcContextInterface) {
+	fn, _ := ctx.GetStub().GetFunctionAndParameters()
+	fn = fn[strings.LastIndex(fn, ":")+1:]
+
+	caller := ctx.GetCaller()
+	logger.Printf("交易结束 %s %s 调用者 %s %s", ctx.GetStub().GetTxID(), fn, caller.MSPID, caller.ID)
+}
@@ -0,0 +1,388 @@
+// Package contract 基于 fabric-contract-api-go 的 Sxc 合约
+// 方法的参数与返回值都是强类型 业务逻辑复用 sxc 包中的函数
+// 链码入口在 cmd/sxc 使用 legacy 构建标签时仍然以 shim 的方式启动 sxc.Sxc
+package contract
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-contract-api-go/metadata"
+)
+
+// 贷款结果
+type LoanResult struct {
+	Counter           int     `json:"counter"`            // 贷款计数器 收到放款时需要传入
+	RemainingCapacity float64 `json:"remaining_capacity"` // 剩余可贷额度
+}
+
+// Sxc 合约
+type SxcContract struct {
+	contractapi.Contract
+}
+
+// 创建合约 设置交易上下文与交易前后的处理函数
+func NewSxcContract() *SxcContract {
+	contract := new(SxcContract)
+	contract.Name = "SxcContract"
+	contract.Info = metadata.InfoMetadata{
+		Title:   "Sxc",
+		Version: "1.0.0",
+	}
+	contract.TransactionContextHandler = new(SxcContext)
+	contract.BeforeTransaction = beforeTransaction
+	contract.AfterTransaction = afterTransaction
+	return contract
+}
+
+// 只读的交易 在元数据中标记为 evaluate
+func (c *SxcContract) GetEvaluateTransactions() []string {
+	return []string{
+		"GetRaised",
+		"GetApplicationInfo",
+		"GetApplications",
+		"GetDonationReceipt",
+		"VerifyDonationReceipt",
+		"GetDonations",
+		"GetFundFlowReport",
+		"GetFundFlowCSV",
+		"AuditApplication",
+		"GetApplicationHistory",
+		"GetLoanHistory",
+		"GetCoveragePolicy",
+		"GetLoanCapacity",
+		"GetParameterHistory",
+	}
+}
+
+// 调用 sxc 包中注册的业务函数
+func call(ctx SxcContextInterface, fn string, args ...string) (string, error) {
+	function, ok := sxc.Functions[fn]
+	if !ok {
+		return "", fmt.Errorf("暂时不支持此函数 %s", fn)
+	}
+	return function(ctx.GetStub(), args)
+}
+
+// 调用业务函数 并将返回的json转换为对象
+func callJSON(ctx SxcContextInterface, v interface{}, fn string, args ...string) error {
+	result, err := call(ctx, fn, args...)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal([]byte(result), v)
+	if err != nil {
+		return fmt.Errorf("无法将 %s 的返回值转换为对象", fn)
+	}
+
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func toJSON(v interface{}) (string, error) {
+	valueAsBytes, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("无法将参数转换为Json字符串")
+	}
+	return string(valueAsBytes), nil
+}
+
+// 合约实例化 设置治理组织列表 治理配置已经存在时拒绝
+// 链码定义需要设置 --init-required 并使用 --isInit 调用 使实例化不能被抢先调用
+// 范例 peer chaincode invoke --isInit -c '{"Args":["SxcContract:InitLedger","[\"Org1MSP\"]"]}'
+func (c *SxcContract) InitLedger(ctx SxcContextInterface, governanceMSPs []string) error {
+	return setup(ctx, governanceMSPs, false)
+}
+
+// 合约升级 迁移账本中的文档 governanceMSPs 为空时保留原有的治理组织列表
+// 只有治理组织或者管理员可以升级 重新设置治理组织列表需要属于治理组织
+// 旧版本合约部署的账本没有治理配置 第一次升级需要使用 --isInit 调用 并同时设置治理组织列表
+func (c *SxcContract) Upgrade(ctx SxcContextInterface, governanceMSPs []string) error {
+	return setup(ctx, governanceMSPs, true)
+}
+
+func setup(ctx SxcContextInterface, governanceMSPs []string, upgrade bool) error {
+	var args []string
+	if len(governanceMSPs) > 0 {
+		strMSPs, err := toJSON(governanceMSPs)
+		if err != nil {
+			return err
+		}
+		args = append(args, strMSPs)
+	}
+	return sxc.Setup(ctx.GetStub(), args, upgrade, ctx.GetCaller().Init)
+}
+
+// 发起申请
+func (c *SxcContract) Applicate(ctx SxcContextInterface, applicationNumber string, name string, id string, hospitalCode string, departmentCode string,
+	streetOfficeCode string, cardNumber string, descMd5 string, needAmount float64) error {
+	_, err := call(ctx, "applicate", applicationNumber, name, id, hospitalCode, departmentCode,
+		streetOfficeCode, cardNumber, descMd5, formatFloat(needAmount))
+	return err
+}
+
+// 医院审核
+func (c *SxcContract) HVerify(ctx SxcContextInterface, applicationNumber string, operator string, agree bool, approveAmount float64, attachments []sxc.Attachment) error {
+	strAgree := sxc.Reject
+	if agree {
+		strAgree = sxc.Agree
+	}
+
+	strAttachments, err := toJSON(attachments)
+	if err != nil {
+		return err
+	}
+
+	_, err = call(ctx, "hVerify", applicationNumber, operator, strAgree, formatFloat(approveAmount), strAttachments)
+	return err
+}
+
+// 捐赠 返回捐赠回执编号
+// 非公开模式下 donator 与 platformID 传空字符串 真实身份通过 transient 的 donor 字段传入
+func (c *SxcContract) Donate(ctx SxcContextInterface, applicationNumber string, donator string, amount float64, serialNumber string, platformID string, privacy string) (string, error) {
+	if privacy == "" {
+		privacy = sxc.PrivacyPublic
+	}
+	return call(ctx, "donate", applicationNumber, donator, formatFloat(amount), serialNumber, platformID, privacy)
+}
+
+// 查询申请的总捐赠额度
+func (c *SxcContract) GetRaised(ctx SxcContextInterface, applicationNumber string) (float64, error) {
+	result, err := call(ctx, "getRaised", applicationNumber)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(result, 64)
+}
+
+// 贷款 bank 为空表示不指定放款银行
+func (c *SxcContract) Loan(ctx SxcContextInterface, applicationNumber string, amount float64, loanNumber string, firstRepayment string, totalMonth string, bank string) (*LoanResult, error) {
+	result := new(LoanResult)
+	err := callJSON(ctx, result, "loan", applicationNumber, formatFloat(amount), loanNumber, firstRepayment, totalMonth, bank)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 收到银行放款
+func (c *SxcContract) ReceivedLoan(ctx SxcContextInterface, applicationNumber string, loanNumber string, loanCounter int, serialNumber string) error {
+	_, err := call(ctx, "receivedLoan", applicationNumber, loanNumber, strconv.Itoa(loanCounter), serialNumber)
+	return err
+}
+
+// 偿还贷款的一期 返回已经还款的期数 还清时释放贷款占用的银行敞口
+func (c *SxcContract) Repay(ctx SxcContextInterface, applicationNumber string, loanNumber string, loanCounter int, serialNumber string) (int, error) {
+	result, err := call(ctx, "repay", applicationNumber, loanNumber, strconv.Itoa(loanCounter), serialNumber)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(result)
+}
+
+// 设置申请为欺诈申请 还没有放款的贷款从银行贷款敞口中释放
+func (c *SxcContract) SetCheat(ctx SxcContextInterface, applicationNumber string) error {
+	_, err := call(ctx, "setCheat", applicationNumber)
+	return err
+}
+
+// 为用户的就诊卡充值 金额需要是正数并且不超过可用资金
+func (c *SxcContract) Recharge(ctx SxcContextInterface, applicationNumber string, serialNumber string, amount float64) error {
+	_, err := call(ctx, "recharge", applicationNumber, serialNumber, formatFloat(amount))
+	return err
+}
+
+// 获取申请详情
+func (c *SxcContract) GetApplicationInfo(ctx SxcContextInterface, applicationNumber string) (*sxc.Application, error) {
+	application := new(sxc.Application)
+	err := callJSON(ctx, application, "getApplicationInfo", applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// 元数据校验不接受 null 未提交的资料返回空数组
+	if application.ApplicationAttachments == nil {
+		application.ApplicationAttachments = []sxc.Attachment{}
+	}
+	if application.HospitalAttachments == nil {
+		application.HospitalAttachments = []sxc.Attachment{}
+	}
+	return application, nil
+}
+
+// 分页查询全部申请的当前状态 以json字符串返回 格式参考 sxc.ApplicationPage
+func (c *SxcContract) GetApplications(ctx SxcContextInterface, pageSize int, bookmark string) (string, error) {
+	return call(ctx, "getApplications", strconv.Itoa(pageSize), bookmark)
+}
+
+// 查询捐赠回执
+func (c *SxcContract) GetDonationReceipt(ctx SxcContextInterface, receiptID string) (*sxc.DigestReceipt, error) {
+	receipt := new(sxc.DigestReceipt)
+	err := callJSON(ctx, receipt, "getDonationReceipt", receiptID)
+	if err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// 校验捐赠回执 platformID 为空时不校验平台ID的哈希
+func (c *SxcContract) VerifyDonationReceipt(ctx SxcContextInterface, receipt sxc.DigestReceipt, platformID string, salt string) (bool, error) {
+	strReceipt, err := toJSON(receipt)
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{strReceipt}
+	if platformID != "" {
+		args = append(args, platformID, salt)
+	}
+
+	result, err := call(ctx, "verifyDonationReceipt", args...)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(result)
+}
+
+// 查询申请的捐赠记录
+func (c *SxcContract) GetDonations(ctx SxcContextInterface, applicationNumber string) ([]sxc.DonationView, error) {
+	var views []sxc.DonationView
+	err := callJSON(ctx, &views, "getDonations", applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+// 设置角色配置
+func (c *SxcContract) SetRoles(ctx SxcContextInterface, roles sxc.RoleConfig) error {
+	strRoles, err := toJSON(roles)
+	if err != nil {
+		return err
+	}
+	_, err = call(ctx, "setRoles", strRoles)
+	return err
+}
+
+// 查询申请的资金使用报告
+func (c *SxcContract) GetFundFlowReport(ctx SxcContextInterface, applicationNumber string) (*sxc.FundFlowReport, error) {
+	report := new(sxc.FundFlowReport)
+	err := callJSON(ctx, report, "getFundFlowReport", applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// 查询申请的资金报告 csv格式 包含流水 汇总和不一致说明
+func (c *SxcContract) GetFundFlowCSV(ctx SxcContextInterface, applicationNumber string) (string, error) {
+	return call(ctx, "getFundFlowReport", applicationNumber, "csv")
+}
+
+// 审计申请的汇总字段
+func (c *SxcContract) AuditApplication(ctx SxcContextInterface, applicationNumber string) (*sxc.AuditReport, error) {
+	report := new(sxc.AuditReport)
+	err := callJSON(ctx, report, "auditApplication", applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// 修复申请的汇总字段 返回修复前的审计结果
+func (c *SxcContract) RepairApplication(ctx SxcContextInterface, applicationNumber string) (*sxc.AuditReport, error) {
+	report := new(sxc.AuditReport)
+	err := callJSON(ctx, report, "repairApplication", applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// 查询申请的修改历史 每个版本的内容结构不固定 以json字符串返回
+func (c *SxcContract) GetApplicationHistory(ctx SxcContextInterface, applicationNumber string) (string, error) {
+	return call(ctx, "getApplicationHistory", applicationNumber)
+}
+
+// 查询贷款的修改历史 以json字符串返回
+func (c *SxcContract) GetLoanHistory(ctx SxcContextInterface, applicationNumber string, loanCounter int) (string, error) {
+	return call(ctx, "getLoanHistory", applicationNumber, strconv.Itoa(loanCounter))
+}
+
+// 分页升级账本中的文档
+func (c *SxcContract) Migrate(ctx SxcContextInterface, pageSize int, bookmark string, dryRun bool) (*sxc.MigrationReport, error) {
+	report := new(sxc.MigrationReport)
+	err := callJSON(ctx, report, "migrate", strconv.Itoa(pageSize), bookmark, strconv.FormatBool(dryRun))
+	if err != nil {
+		return nil, err
+	}
+
+	// 无法迁移的文档没有修改说明 元数据校验不接受 null
+	for i := range report.Changes {
+		if report.Changes[i].Changes == nil {
+			report.Changes[i].Changes = []string{}
+		}
+	}
+	return report, nil
+}
+
+// 设置贷款覆盖策略
+func (c *SxcContract) SetCoveragePolicy(ctx SxcContextInterface, policy sxc.CoveragePolicy) error {
+	strPolicy, err := toJSON(policy)
+	if err != nil {
+		return err
+	}
+	_, err = call(ctx, "setCoveragePolicy", strPolicy)
+	return err
+}
+
+// 查询贷款覆盖策略
+func (c *SxcContract) GetCoveragePolicy(ctx SxcContextInterface) (*sxc.CoveragePolicy, error) {
+	policy := new(sxc.CoveragePolicy)
+	err := callJSON(ctx, policy, "getCoveragePolicy")
+	if err != nil {
+		return nil, err
+	}
+
+	// 元数据校验不接受 null 未配置银行上限时返回空对象
+	if policy.BankLimits == nil {
+		policy.BankLimits = map[string]float64{}
+	}
+	return policy, nil
+}
+
+// 查询申请剩余的可贷额度 bank 为空表示不指定放款银行
+func (c *SxcContract) GetLoanCapacity(ctx SxcContextInterface, applicationNumber string, bank string) (float64, error) {
+	result, err := call(ctx, "getLoanCapacity", applicationNumber, bank)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(result, 64)
+}
+
+// 执行投票通过的治理提案 返回参数修改记录
+func (c *SxcContract) ExecuteProposal(ctx SxcContextInterface, proposalID string) (*sxc.ParameterRecord, error) {
+	record := new(sxc.ParameterRecord)
+	err := callJSON(ctx, record, "executeProposal", proposalID)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// 查询参数的修改历史
+func (c *SxcContract) GetParameterHistory(ctx SxcContextInterface, parameter string) ([]sxc.ParameterRecord, error) {
+	records := []sxc.ParameterRecord{}
+	err := callJSON(ctx, &records, "getParameterHistory", parameter)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
@@ -0,0 +1,250 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/core/governance"
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 银行贷款敞口的复合键前缀 每笔贷款一个键 属性为 银行,申请编号,贷款计数器
+// 旧版本合约只有以银行为属性的一个汇总键 按银行查询敞口时也会计入
+const bankExposureObjectType = "bankExposure"
+
+// 贷款覆盖策略 参考 governance.CoveragePolicy
+type CoveragePolicy = governance.CoveragePolicy
+
+// 默认策略 与最初的规则一致 贷款总额不能超过可用的募集资金
+var defaultCoveragePolicy = CoveragePolicy{
+	MaxLoanRatio:    1,
+	CollateralRatio: 0,
+}
+
+// 覆盖规则 返回在此规则下剩余的可贷额度
+// 最终的可贷额度取所有规则中的最小值
+type coverageRule func(coverage CoverageRepo, policy CoveragePolicy, application Application, bank string) (float64, error)
+
+var coverageRules = []coverageRule{
+	raisedFundsRule,
+	bankLimitRule,
+}
+
+// 按募集资金计算可贷额度
+// 只有还没有充值到就诊卡的捐赠可以作为贷款的担保 充值先使用已经到账的贷款 参考 availableFunds
+// 捐赠在 donate 时立即计入募集金额 链码中没有待确认的捐赠 还没有上链的捐赠不计入可贷额度
+func raisedFundsRule(coverage CoverageRepo, policy CoveragePolicy, application Application, bank string) (float64, error) {
+	_, donated := availableFunds(application)
+	lendable := donated * (1 - policy.CollateralRatio) * policy.MaxLoanRatio
+	return math.Max(lendable-application.LoanTotal, 0), nil
+}
+
+// 按银行的贷款上限计算可贷额度
+// 配置了银行上限后必须指定放款银行 否则不指定银行就可以绕过上限
+// 每笔贷款在贷款时记录敞口 还清时释放 申请被设置为欺诈时释放还没有放款的贷款 参考 Repay MarkCheat
+// 只有配置了银行上限时才按范围读取敞口 不同申请的贷款写入不同的键
+func bankLimitRule(coverage CoverageRepo, policy CoveragePolicy, application Application, bank string) (float64, error) {
+	if len(policy.BankLimits) == 0 {
+		return math.Inf(1), nil
+	}
+	if bank == "" {
+		return 0, fmt.Errorf("贷款覆盖策略配置了银行贷款上限 需要指定放款银行")
+	}
+
+	limit, ok := policy.BankLimits[bank]
+	if !ok {
+		limit = policy.DefaultBankLimit
+	}
+
+	exposure, err := coverage.BankExposure(bank)
+	if err != nil {
+		return 0, err
+	}
+
+	return limit - exposure, nil
+}
+
+// 计算申请当前剩余的可贷额度
+func loanCapacity(coverage CoverageRepo, application Application, bank string) (float64, error) {
+	policy, err := coverage.Policy()
+	if err != nil {
+		return 0, err
+	}
+
+	capacity := math.Inf(1)
+	for _, rule := range coverageRules {
+		remaining, err := rule(coverage, policy, application, bank)
+		if err != nil {
+			return 0, err
+		}
+		capacity = math.Min(capacity, remaining)
+	}
+
+	return math.Max(capacity, 0), nil
+}
+
+// 设置贷款覆盖策略 只有治理组织可以调用 也可以通过治理提案修改 参考 executeProposal
+// 入参列表
+//
+//	policy 策略 json string
+//
+// 范例 ["invoke", "setCoveragePolicy", "{\"max_loan_ratio\":0.8,\"collateral_ratio\":0.1,\"bank_limits\":{\"icbc\":100000}}"]
+func setCoveragePolicy(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireGovernance(stub)
+	if err != nil {
+		return "", err
+	}
+
+	policy := CoveragePolicy{}
+	err = json.Unmarshal([]byte(args[0]), &policy)
+	if err != nil {
+		return "", fmt.Errorf("无法将策略转换为策略对象 %s", args[0])
+	}
+
+	_, err = applyParameterChange(stub, ParameterChange{Parameter: ParameterCoverage, Coverage: &policy}, "")
+	if err != nil {
+		return "", err
+	}
+
+	return "成功", nil
+}
+
+// 查询贷款覆盖策略
+// 范例 ["query", "getCoveragePolicy"]
+func getCoveragePolicy(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 0)
+	if err != nil {
+		return "", err
+	}
+
+	policy, err := getCoveragePolicyConfig(stub)
+	if err != nil {
+		return "", err
+	}
+
+	policyAsBytes, err := json.Marshal(policy)
+	if err != nil {
+		return "", fmt.Errorf("无法将策略转换为Json字符串")
+	}
+
+	return string(policyAsBytes), nil
+}
+
+// 查询申请剩余的可贷额度
+// 入参列表
+//
+//	application_number 合约编号
+//	bank 放款银行编号 可选 贷款覆盖策略配置了银行上限时必须指定
+//
+// 范例 ["query", "getLoanCapacity", "1", "icbc"]
+func getLoanCapacity(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 1, 2)
+	if err != nil {
+		return "", err
+	}
+
+	application, err := getApplication(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	bank := params.Optional(args, 1, "")
+
+	capacity, err := loanCapacity(stubCoverage{stub}, application, bank)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatFloat(capacity, 'f', -1, 64), nil
+}
+
+func getCoveragePolicyConfig(stub shim.ChaincodeStubInterface) (CoveragePolicy, error) {
+	policy := CoveragePolicy{}
+	found, err := getConfig(stub, "coverage", &policy)
+	if err != nil {
+		return policy, err
+	}
+	if !found {
+		return defaultCoveragePolicy, nil
+	}
+	return policy, nil
+}
+
+// 银行在所有申请上还没有释放的贷款总额
+func getBankExposure(stub shim.ChaincodeStubInterface, bank string) (float64, error) {
+	iterator, err := stub.GetStateByPartialCompositeKey(bankExposureObjectType, []string{bank})
+	if err != nil {
+		return 0, fmt.Errorf("获取银行贷款敞口失败 %s", bank)
+	}
+	defer iterator.Close()
+
+	exposure := 0.0
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("获取银行贷款敞口失败 %s", bank)
+		}
+
+		amount, err := strconv.ParseFloat(string(kv.Value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("无法将银行贷款敞口转换为float64类型 %s", bank)
+		}
+		exposure = exposure + amount
+	}
+
+	return exposure, nil
+}
+
+func loanExposureKey(stub shim.ChaincodeStubInterface, bank string, applicationNumber string, counter int) (string, error) {
+	exposureKey, err := stub.CreateCompositeKey(bankExposureObjectType, []string{bank, applicationNumber, strconv.Itoa(counter)})
+	if err != nil {
+		return "", fmt.Errorf("创建银行敞口键失败 %s", bank)
+	}
+	return exposureKey, nil
+}
+
+// 记录一笔贷款占用的银行敞口 bank 为空时忽略
+func putLoanExposure(stub shim.ChaincodeStubInterface, bank string, applicationNumber string, counter int, amount float64) error {
+	if bank == "" {
+		return nil
+	}
+
+	exposureKey, err := loanExposureKey(stub, bank, applicationNumber, counter)
+	if err != nil {
+		return err
+	}
+
+	err = stub.PutState(exposureKey, []byte(strconv.FormatFloat(amount, 'f', -1, 64)))
+	if err != nil {
+		return fmt.Errorf("银行贷款敞口写入账本失败 %s", bank)
+	}
+
+	return nil
+}
+
+// 释放一笔贷款占用的银行敞口 bank 为空或者没有记录时忽略
+func deleteLoanExposure(stub shim.ChaincodeStubInterface, bank string, applicationNumber string, counter int) error {
+	if bank == "" {
+		return nil
+	}
+
+	exposureKey, err := loanExposureKey(stub, bank, applicationNumber, counter)
+	if err != nil {
+		return err
+	}
+
+	err = stub.DelState(exposureKey)
+	if err != nil {
+		return fmt.Errorf("释放银行贷款敞口失败 %s", bank)
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 修改申请的交易发出的链码事件名称
+// Fabric 每笔交易只保留最后一个事件 所以一笔交易的全部修改放在同一个事件中
+// repairApplication 发出的是 ApplicationRepairedEvent
+const ChangeEventName = "sxc.change"
+
+// 一笔交易写入的申请与明细记录 链下的投影数据库按此事件更新
+// 申请与记录都是写入后的完整内容 重复处理同一个事件不会改变结果
+type ChangeEvent struct {
+	Function          string           `json:"function"`              // 链码函数名
+	TxID              string           `json:"tx_id"`                 // 交易ID
+	ApplicationNumber string           `json:"application_number"`    // 申请编号
+	Application       *Application     `json:"application,omitempty"` // 修改后的申请
+	Donations         []DonationView   `json:"donations,omitempty"`   // 新增的捐赠记录
+	Loans             []LoanChange     `json:"loans,omitempty"`       // 新增或修改的贷款记录
+	Recharges         []RechargeChange `json:"recharges,omitempty"`   // 新增的充值记录
+}
+
+// 事件中的贷款记录
+type LoanChange struct {
+	LoanCounter int `json:"loan_counter"` // 第几笔贷款
+	LoanInfo
+}
+
+// 事件中的充值记录
+type RechargeChange struct {
+	RechargeCounter int `json:"recharge_counter"` // 第几笔充值
+	RechargeHistory
+}
+
+// 返回记录写入数据的账本 业务函数通过它写入的数据在交易结束前由 emitChange 发出
+// 记录的是写入账本的内容 修改者和文档版本在写入之前设置
+// 同一笔交易中 GetState 读不到本交易的写入 不能在写入之后重新读取
+func recordChanges(stub shim.ChaincodeStubInterface) (Ledger, *ChangeEvent) {
+	ledger := NewStubLedger(stub)
+	change := &ChangeEvent{}
+	ledger.Applications = recordingApplications{ledger.Applications, stub, change}
+	ledger.Donations = recordingDonations{ledger.Donations, change}
+	ledger.Loans = recordingLoans{ledger.Loans, stub, change}
+	ledger.Recharges = recordingRecharges{ledger.Recharges, change}
+	return ledger, change
+}
+
+// 发出变更事件 没有写入任何数据时不发出
+func emitChange(stub shim.ChaincodeStubInterface, function string, change *ChangeEvent) error {
+	if change.Application == nil && len(change.Donations) == 0 && len(change.Loans) == 0 && len(change.Recharges) == 0 {
+		return nil
+	}
+
+	change.Function = function
+	change.TxID = stub.GetTxID()
+
+	changeAsBytes, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("无法将变更事件转换为Json字符串")
+	}
+
+	err = stub.SetEvent(ChangeEventName, changeAsBytes)
+	if err != nil {
+		return fmt.Errorf("发出链码事件失败 %s", err)
+	}
+	return nil
+}
+
+type recordingApplications struct {
+	ApplicationRepo
+	stub   shim.ChaincodeStubInterface
+	change *ChangeEvent
+}
+
+func (r recordingApplications) Put(application Application) error {
+	err := stampApplication(r.stub, &application)
+	if err != nil {
+		return err
+	}
+
+	err = r.ApplicationRepo.Put(application)
+	if err == nil {
+		r.change.ApplicationNumber = application.ApplicationNumber
+		r.change.Application = &application
+	}
+	return err
+}
+
+type recordingDonations struct {
+	DonationRepo
+	change *ChangeEvent
+}
+
+func (r recordingDonations) Put(applicationNumber string, counter int, donation Donation) error {
+	donation.SchemaVersion = schemaVersion(donationDocType)
+	err := r.DonationRepo.Put(applicationNumber, counter, donation)
+	if err == nil {
+		r.change.ApplicationNumber = applicationNumber
+		r.change.Donations = append(r.change.Donations, DonationView{DonateCounter: counter, Donation: donation})
+	}
+	return err
+}
+
+type recordingLoans struct {
+	LoanRepo
+	stub   shim.ChaincodeStubInterface
+	change *ChangeEvent
+}
+
+func (r recordingLoans) Put(applicationNumber string, counter int, loanInfo LoanInfo) error {
+	err := stampLoan(r.stub, &loanInfo)
+	if err != nil {
+		return err
+	}
+
+	err = r.LoanRepo.Put(applicationNumber, counter, loanInfo)
+	if err == nil {
+		r.change.ApplicationNumber = applicationNumber
+		r.change.Loans = append(r.change.Loans, LoanChange{LoanCounter: counter, LoanInfo: loanInfo})
+	}
+	return err
+}
+
+type recordingRecharges struct {
+	RechargeRepo
+	change *ChangeEvent
+}
+
+func (r recordingRecharges) Put(applicationNumber string, counter int, recharge RechargeHistory) error {
+	recharge.SchemaVersion = schemaVersion(rechargeDocType)
+	err := r.RechargeRepo.Put(applicationNumber, counter, recharge)
+	if err == nil {
+		r.change.ApplicationNumber = applicationNumber
+		r.change.Recharges = append(r.change.Recharges, RechargeChange{RechargeCounter: counter, RechargeHistory: recharge})
+	}
+	return err
+}
+
+// 一页申请的当前状态
+type ApplicationPage struct {
+	Applications []ChangeEvent `json:"applications"` // 每个申请一项 格式与变更事件相同 function 为 getApplications
+	Bookmark     string        `json:"bookmark"`     // 下一页的起始键 为空表示已经全部返回
+}
+
+// 以变更事件的格式分页返回全部申请及其明细记录的当前状态
+// 链码发出变更事件之前写入的申请没有事件 链下的投影需要先用此函数初始化 再从当时的区块开始处理事件
+// 旧格式的明细记录不会返回 需要先执行 migrate
+// 入参列表
+//
+//	page_size 每页返回的申请数量 0 表示不分页
+//	bookmark 起始键 第一页传空字符串 之后传上一页返回的 bookmark
+//
+// 范例 ["query", "getApplications", "100", ""]
+func getApplications(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	pageSize, err := strconv.Atoi(args[0])
+	if err != nil || pageSize < 0 {
+		return "", fmt.Errorf("无法将每页数量转换为非负整数 %s", args[0])
+	}
+
+	page := ApplicationPage{Applications: []ChangeEvent{}}
+
+	resultIterator, err := stub.GetStateByRange(args[1], "")
+	if err != nil {
+		return "", fmt.Errorf("获取账本状态失败")
+	}
+	defer resultIterator.Close()
+
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("获取账本状态失败")
+		}
+
+		// 普通键中还有配置和旧格式的明细记录 只返回申请
+		if strings.HasPrefix(queryResult.Key, compositeKeyNamespace) || !isApplicationDocument(queryResult.Key, queryResult.Value) {
+			continue
+		}
+
+		if pageSize > 0 && len(page.Applications) == pageSize {
+			page.Bookmark = queryResult.Key
+			break
+		}
+
+		change, err := applicationSnapshot(stub, queryResult.Key, queryResult.Value)
+		if err != nil {
+			return "", err
+		}
+		page.Applications = append(page.Applications, change)
+	}
+
+	pageAsBytes, err := json.Marshal(page)
+	if err != nil {
+		return "", fmt.Errorf("无法将申请列表转换为Json字符串")
+	}
+
+	return string(pageAsBytes), nil
+}
+
+// 读取申请和全部明细记录 组成一个变更事件
+func applicationSnapshot(stub shim.ChaincodeStubInterface, applicationNumber string, value []byte) (ChangeEvent, error) {
+	change := ChangeEvent{
+		Function:          "getApplications",
+		ApplicationNumber: applicationNumber,
+		Application:       &Application{},
+		Donations:         []DonationView{},
+		Loans:             []LoanChange{},
+		Recharges:         []RechargeChange{},
+	}
+
+	err := decodeDocument(applicationDocType, value, change.Application)
+	if err != nil {
+		return change, fmt.Errorf("将合约转换为json对象失败")
+	}
+
+	donations, err := getSubRecords(stub, donationObjectType, applicationNumber)
+	if err != nil {
+		return change, err
+	}
+	for _, record := range donations {
+		view := DonationView{DonateCounter: record.Counter}
+		err = decodeDocument(donationDocType, record.Value, &view.Donation)
+		if err != nil {
+			return change, fmt.Errorf("捐赠记录json串转换为捐赠记录对象失败")
+		}
+		change.Donations = append(change.Donations, view)
+	}
+
+	loans, err := getSubRecords(stub, loanObjectType, applicationNumber)
+	if err != nil {
+		return change, err
+	}
+	for _, record := range loans {
+		loanChange := LoanChange{LoanCounter: record.Counter}
+		err = decodeDocument(loanDocType, record.Value, &loanChange.LoanInfo)
+		if err != nil {
+			return change, fmt.Errorf("贷款信息json串转换为贷款信息对象失败")
+		}
+		change.Loans = append(change.Loans, loanChange)
+	}
+
+	recharges, err := getSubRecords(stub, rechargeObjectType, applicationNumber)
+	if err != nil {
+		return change, err
+	}
+	for _, record := range recharges {
+		rechargeChange := RechargeChange{RechargeCounter: record.Counter}
+		err = decodeDocument(rechargeDocType, record.Value, &rechargeChange.RechargeHistory)
+		if err != nil {
+			return change, fmt.Errorf("充值记录json串转换为充值记录对象失败")
+		}
+		change.Recharges = append(change.Recharges, rechargeChange)
+	}
+
+	return change, nil
+}
@@ -0,0 +1,287 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 配置类数据的复合键前缀 与申请编号所在的键空间隔离
+const configObjectType = "config"
+
+// 治理配置
+// 只有治理组织的成员才可以修改链上的策略参数
+type GovernanceConfig struct {
+	MSPs              []string            `json:"msps"`               // 治理组织的MSP ID列表
+	ProposalChaincode string              `json:"proposal_chaincode"` // 治理提案所在的投票链码名称 为空时为 DefaultProposalChaincode
+	Requirement       ProposalRequirement `json:"requirement"`        // 执行治理提案的最低要求
+}
+
+// 执行治理提案的最低要求
+// 提案的投票规则由提案者设置 Sxc 执行前按投票链码返回的参与量和得票比例再校验一次
+// 避免提案者降低法定人数后由一个组织单方面通过提案
+type ProposalRequirement struct {
+	Quorum    int     `json:"quorum"`    // 最少的投票组织数量 为0时需要全部治理组织投票
+	Threshold float64 `json:"threshold"` // 同意票需要超过的比例 为0时为0.5 即同意票过半
+	Inclusive bool    `json:"inclusive"` // 同意票达到 threshold 即可 而不是超过 例如 0.6667 表示至少三分之二
+}
+
+// 比较同意票比例时的容差 与投票链码一致 比例要求按四位小数书写 例如三分之二写作 0.6667
+const proposalThresholdTolerance = 1e-4
+
+// 同意票比例是否满足要求 按容差比较 避免 0.6667 这样的书写误差使三分之二的同意票不通过
+func (r ProposalRequirement) reached(share float64, threshold float64) bool {
+	if r.Inclusive {
+		return share >= threshold-proposalThresholdTolerance
+	}
+	return share > threshold+proposalThresholdTolerance
+}
+
+// 校验最低要求 msps 为治理组织列表
+func (r ProposalRequirement) validate(msps []string) error {
+	if r.Quorum < 0 || r.Quorum > len(msps) {
+		return fmt.Errorf("提案的最少投票组织数量需要在0到治理组织数量 %d 之间  %d", len(msps), r.Quorum)
+	}
+	if r.Threshold < 0 || r.Threshold > 1 || (r.Threshold == 1 && !r.Inclusive) {
+		return fmt.Errorf("提案的同意票比例需要在0到1之间 只有 inclusive 时可以为1  %v", r.Threshold)
+	}
+	return nil
+}
+
+// 最少的投票组织数量 没有设置时为全部治理组织
+func (c GovernanceConfig) proposalQuorum() int {
+	if c.Requirement.Quorum == 0 {
+		return len(c.MSPs)
+	}
+	return c.Requirement.Quorum
+}
+
+// 同意票需要超过的比例 没有设置时为0.5
+func (c GovernanceConfig) proposalThreshold() float64 {
+	if c.Requirement.Threshold == 0 {
+		return 0.5
+	}
+	return c.Requirement.Threshold
+}
+
+// 初始化治理配置
+// 实例化或升级合约时可以传入治理组织列表 投票链码名称和执行治理提案的最低要求 不传则保留原有配置
+// 范例 ["init", "[\"Org1MSP\",\"Org2MSP\"]"]
+// 范例 ["init", "[\"Org1MSP\",\"Org2MSP\"]", "vote"]
+// 范例 ["init", "[\"Org1MSP\",\"Org2MSP\",\"Org3MSP\"]", "vote", "{\"quorum\":2,\"threshold\":0.6}"]
+// 范例 ["init", "[\"Org1MSP\",\"Org2MSP\",\"Org3MSP\"]", "vote", "{\"threshold\":0.6667,\"inclusive\":true}"]
+func initGovernance(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	err := params.Between(args, 1, 3)
+	if err != nil {
+		return err
+	}
+
+	var msps []string
+	err = json.Unmarshal([]byte(args[0]), &msps)
+	if err != nil {
+		return fmt.Errorf("无法将治理组织列表转换为数组 %s", args[0])
+	}
+	if len(msps) == 0 {
+		return fmt.Errorf("治理组织列表不能为空")
+	}
+
+	config := GovernanceConfig{}
+	_, err = getConfig(stub, "governance", &config)
+	if err != nil {
+		return err
+	}
+	config.MSPs = msps
+	if len(args) > 1 {
+		config.ProposalChaincode = args[1]
+	}
+	if len(args) > 2 {
+		requirement := ProposalRequirement{}
+		err = json.Unmarshal([]byte(args[2]), &requirement)
+		if err != nil {
+			return fmt.Errorf("无法将提案的最低要求转换为对象 %s", args[2])
+		}
+		config.Requirement = requirement
+	}
+	err = config.Requirement.validate(config.MSPs)
+	if err != nil {
+		return err
+	}
+
+	return putConfig(stub, "governance", config)
+}
+
+// 合约实例化或升级时的初始化
+// 实例化只能设置一次治理组织列表 之后只有治理组织可以通过升级重新设置
+// 升级时将账本中的文档迁移到当前版本 只有治理组织或者管理员可以升级
+// 没有治理配置的账本 例如旧版本合约部署的账本 只能在实例化交易中设置治理组织列表 否则拒绝
+// 链码定义需要设置 --init-required 使实例化成为链码的第一笔交易 否则实例化之前可能被其他组织抢先调用
+// 入参列表
+//
+//	args 治理组织列表 投票链码名称和执行治理提案的最低要求 都是可选的
+//	upgrade 是否为升级
+//	initTx 是否为实例化交易 即通过 --isInit 调用 节点只接受一次
+func Setup(stub shim.ChaincodeStubInterface, args []string, upgrade bool, initTx bool) error {
+	found, err := getConfig(stub, "governance", &GovernanceConfig{})
+	if err != nil {
+		return err
+	}
+
+	if !found && !initTx {
+		return fmt.Errorf("治理配置尚未初始化 只能在实例化交易中设置治理组织列表")
+	}
+	if !found && len(args) == 0 {
+		return fmt.Errorf("治理配置尚未初始化 需要传入治理组织列表")
+	}
+	if !upgrade && found && len(args) > 0 {
+		return fmt.Errorf("治理配置已经初始化 请通过升级合约修改治理组织列表")
+	}
+	if upgrade && found && len(args) > 0 {
+		err = requireGovernance(stub)
+	} else if upgrade && found {
+		err = requireGovernanceOrAdmin(stub)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = initGovernance(stub, args)
+	if err != nil {
+		return err
+	}
+
+	if upgrade {
+		return migrateAll(stub)
+	}
+
+	return nil
+}
+
+// 交易是否为实例化交易 即提案中的 isInit 为真
+// 链码定义设置 --init-required 时节点只接受一次实例化交易 并且要求它是链码的第一笔交易
+func IsInitTransaction(stub shim.ChaincodeStubInterface) (bool, error) {
+	signedProposal, err := stub.GetSignedProposal()
+	if err != nil {
+		return false, fmt.Errorf("获取交易提案失败")
+	}
+	if signedProposal == nil {
+		return false, nil
+	}
+
+	proposal := &peer.Proposal{}
+	err = proto.Unmarshal(signedProposal.ProposalBytes, proposal)
+	if err != nil {
+		return false, fmt.Errorf("解析交易提案失败")
+	}
+	payload := &peer.ChaincodeProposalPayload{}
+	err = proto.Unmarshal(proposal.Payload, payload)
+	if err != nil {
+		return false, fmt.Errorf("解析交易提案失败")
+	}
+	spec := &peer.ChaincodeInvocationSpec{}
+	err = proto.Unmarshal(payload.Input, spec)
+	if err != nil {
+		return false, fmt.Errorf("解析交易提案失败")
+	}
+
+	return spec.GetChaincodeSpec().GetInput().GetIsInit(), nil
+}
+
+// 校验调用者是否属于治理组织
+func requireGovernance(stub shim.ChaincodeStubInterface) error {
+	config := GovernanceConfig{}
+	found, err := getConfig(stub, "governance", &config)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("治理配置尚未初始化")
+	}
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("获取调用者MSP ID失败")
+	}
+
+	for _, msp := range config.MSPs {
+		if msp == mspID {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("调用者 %s 不属于治理组织", mspID)
+}
+
+// 调用者组织拥有的角色
+type CallerRoles struct {
+	Initialized bool `json:"initialized"` // 治理配置已经初始化 旧版本合约部署的账本在升级之前没有治理配置
+	Governance  bool `json:"governance"`  // 属于治理组织
+	Admin       bool `json:"admin"`       // 管理员
+	Platform    bool `json:"platform"`    // 捐赠平台
+}
+
+// 查询组织拥有的角色 合约的交易前处理函数据此做权限校验
+func RolesOf(stub shim.ChaincodeStubInterface, mspID string) (CallerRoles, error) {
+	governance := GovernanceConfig{}
+	initialized, err := getConfig(stub, "governance", &governance)
+	if err != nil {
+		return CallerRoles{}, err
+	}
+
+	roles := RoleConfig{}
+	_, err = getConfig(stub, "roles", &roles)
+	if err != nil {
+		return CallerRoles{}, err
+	}
+
+	return CallerRoles{
+		Initialized: initialized,
+		Governance:  containsMSP(governance.MSPs, mspID),
+		Admin:       containsMSP(roles.AdminMSPs, mspID),
+		Platform:    containsMSP(roles.PlatformMSPs, mspID),
+	}, nil
+}
+
+// 校验调用者属于治理组织或者是管理员
+func requireGovernanceOrAdmin(stub shim.ChaincodeStubInterface) error {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return fmt.Errorf("获取调用者MSP ID失败")
+	}
+
+	roles, err := RolesOf(stub, mspID)
+	if err != nil {
+		return err
+	}
+	if !roles.Governance && !roles.Admin {
+		return fmt.Errorf("调用者 %s 不属于治理组织也不是管理员", mspID)
+	}
+	return nil
+}
+
+func containsMSP(msps []string, mspID string) bool {
+	for _, msp := range msps {
+		if msp == mspID {
+			return true
+		}
+	}
+	return false
+}
+
+// 读取配置 配置不存在时 found 为 false
+func getConfig(stub shim.ChaincodeStubInterface, name string, config interface{}) (bool, error) {
+	return state.GetCompositeJSON(stub, configObjectType, []string{name}, config)
+}
+
+// 写入配置
+func putConfig(stub shim.ChaincodeStubInterface, name string, config interface{}) error {
+	return state.PutCompositeJSON(stub, configObjectType, []string{name}, config)
+}
@@ -0,0 +1,175 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 不参与字段对比的字段 提交者已经单独列出
+var historyIgnoredFields = map[string]bool{
+	"updated_by": true,
+}
+
+// 一个字段的变化
+type FieldChange struct {
+	Field string      `json:"field"` // 字段名
+	Old   interface{} `json:"old"`   // 修改前的值 新增字段时为 null
+	New   interface{} `json:"new"`   // 修改后的值 删除字段时为 null
+}
+
+// 键的一个历史版本
+type HistoryEntry struct {
+	TxID         string          `json:"tx_id"`         // 写入此版本的交易ID
+	Timestamp    string          `json:"timestamp"`     // 交易时间 RFC3339 UTC
+	SubmitterMSP string          `json:"submitter_msp"` // 交易提交者的MSP ID 记录此字段之前写入的版本为空
+	IsDelete     bool            `json:"is_delete"`     // 此版本是否为删除
+	Value        json.RawMessage `json:"value"`         // 此版本的内容
+	Changes      []FieldChange   `json:"changes"`       // 与上一个版本相比的字段变化
+}
+
+// 交易提交者的MSP ID
+func submitterMSP(stub shim.ChaincodeStubInterface) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("获取调用者MSP ID失败")
+	}
+	return mspID, nil
+}
+
+// 查询申请的修改历史
+// 入参列表
+//
+//	application_number 合约编号
+//
+// 范例 ["query", "getApplicationHistory", "1"]
+func getApplicationHistory(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	return keyHistory(stub, args[0])
+}
+
+// 查询贷款的修改历史
+// 入参列表
+//
+//	application_number 合约编号
+//	loan_counter 贷款计数器
+//
+// 范例 ["query", "getLoanHistory", "1", "1"]
+func getLoanHistory(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := loanKey(stub, args[0], args[1])
+	if err != nil {
+		return "", err
+	}
+
+	return keyHistory(stub, key)
+}
+
+// 读取键的全部历史版本 按时间从早到晚排列 并计算相邻版本之间的字段变化
+func keyHistory(stub shim.ChaincodeStubInterface, key string) (string, error) {
+	resultIterator, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return "", fmt.Errorf("获取历史记录失败 %s", key)
+	}
+	defer resultIterator.Close()
+
+	entries := []HistoryEntry{}
+	for resultIterator.HasNext() {
+		modification, err := resultIterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("获取历史记录失败 %s", key)
+		}
+
+		entry := HistoryEntry{
+			TxID:     modification.TxId,
+			IsDelete: modification.IsDelete,
+			Value:    json.RawMessage("null"),
+		}
+		if modification.Timestamp != nil {
+			entry.Timestamp = time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).UTC().Format(time.RFC3339)
+		}
+		if !modification.IsDelete && json.Valid(modification.Value) {
+			entry.Value = json.RawMessage(modification.Value)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return "", fmt.Errorf("未找到此键的历史记录 %s", key)
+	}
+
+	// 历史记录的返回顺序没有保证 按时间排序后再计算变化
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+
+	previous := map[string]interface{}{}
+	for i := range entries {
+		current := map[string]interface{}{}
+		if !entries[i].IsDelete {
+			err = json.Unmarshal(entries[i].Value, &current)
+			if err != nil {
+				current = map[string]interface{}{}
+			}
+		}
+
+		if submitter, ok := current["updated_by"].(string); ok {
+			entries[i].SubmitterMSP = submitter
+		}
+		entries[i].Changes = diffFields(previous, current)
+		previous = current
+	}
+
+	entriesAsBytes, err := json.Marshal(entries)
+	if err != nil {
+		return "", fmt.Errorf("无法将历史记录转换为Json字符串")
+	}
+
+	return string(entriesAsBytes), nil
+}
+
+// 对比两个版本的顶层字段 按字段名排序
+func diffFields(previous map[string]interface{}, current map[string]interface{}) []FieldChange {
+	fields := map[string]bool{}
+	for field := range previous {
+		fields[field] = true
+	}
+	for field := range current {
+		fields[field] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if !historyIgnoredFields[field] {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []FieldChange{}
+	for _, field := range names {
+		oldValue, oldOk := previous[field]
+		newValue, newOk := current[field]
+		if oldOk == newOk && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+	}
+
+	return changes
+}
@@ -0,0 +1,83 @@
+package sxc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 申请下各类记录的复合键前缀
+// 复合键与申请编号不在同一个键空间 不同类型的记录之间也不会互相覆盖
+const (
+	donationObjectType = "donation"
+	loanObjectType     = "loan"
+	rechargeObjectType = "recharge"
+)
+
+// 申请下的一条记录
+type subRecord struct {
+	Counter int    // 计数器 从1开始
+	Key     string // 账本中的键
+	Value   []byte // 账本中的值
+}
+
+func subRecordKey(stub shim.ChaincodeStubInterface, objectType string, applicationNumber string, counter string) (string, error) {
+	key, err := stub.CreateCompositeKey(objectType, []string{applicationNumber, counter})
+	if err != nil {
+		return "", fmt.Errorf("创建记录键失败 %s,%s,%s", objectType, applicationNumber, counter)
+	}
+	return key, nil
+}
+
+// 捐赠记录的键
+func donationKey(stub shim.ChaincodeStubInterface, applicationNumber string, donateCounter string) (string, error) {
+	return subRecordKey(stub, donationObjectType, applicationNumber, donateCounter)
+}
+
+// 贷款记录的键
+func loanKey(stub shim.ChaincodeStubInterface, applicationNumber string, loanCounter string) (string, error) {
+	return subRecordKey(stub, loanObjectType, applicationNumber, loanCounter)
+}
+
+// 充值记录的键
+func rechargeKey(stub shim.ChaincodeStubInterface, applicationNumber string, rechargeCounter string) (string, error) {
+	return subRecordKey(stub, rechargeObjectType, applicationNumber, rechargeCounter)
+}
+
+// 读取申请下某一类的全部记录 按计数器排序
+func getSubRecords(stub shim.ChaincodeStubInterface, objectType string, applicationNumber string) ([]subRecord, error) {
+	resultIterator, err := stub.GetStateByPartialCompositeKey(objectType, []string{applicationNumber})
+	if err != nil {
+		return nil, fmt.Errorf("获取记录失败 %s,%s", objectType, applicationNumber)
+	}
+	defer resultIterator.Close()
+
+	records := []subRecord{}
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("获取记录失败 %s,%s", objectType, applicationNumber)
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(queryResult.Key)
+		if err != nil || len(attributes) != 2 {
+			return nil, fmt.Errorf("记录键格式错误 %s", queryResult.Key)
+		}
+
+		counter, err := strconv.Atoi(attributes[1])
+		if err != nil {
+			return nil, fmt.Errorf("记录键格式错误 %s", queryResult.Key)
+		}
+
+		records = append(records, subRecord{Counter: counter, Key: queryResult.Key, Value: queryResult.Value})
+	}
+
+	// 复合键按字符串排序 "10" 会排在 "2" 前面
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Counter < records[j].Counter
+	})
+
+	return records, nil
+}
@@ -0,0 +1,312 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// 以下业务函数只通过 Ledger 读写数据 不依赖链码 stub
+// 链码函数负责解析参数 调用者身份 私有数据 回执等与 Fabric 相关的部分
+
+// 发起申请 申请编号不能重复
+func Apply(ledger Ledger, application Application) error {
+	exists, err := ledger.Applications.Exists(application.ApplicationNumber)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("已经存在此合约编号 %s", application.ApplicationNumber)
+	}
+
+	application.State = HospitalVerify
+	return ledger.Applications.Put(application)
+}
+
+// 医院审核 同意后开始筹款
+func Verify(ledger Ledger, applicationNumber string, operator string, agree bool, approveAmount float64, attachments []Attachment) error {
+	application, err := ledger.Applications.Get(applicationNumber)
+	if err != nil {
+		return err
+	}
+
+	if application.State != HospitalVerify {
+		return fmt.Errorf("合约已经审核过啦")
+	}
+
+	if agree {
+		application.State = Raising // 开始筹款
+		application.HospitalApproveAmount = approveAmount
+	} else {
+		application.State = HospitalReject //审核不通过
+	}
+
+	application.HospitalAttachments = attachments
+	application.HospitalOperator = operator
+
+	return ledger.Applications.Put(application)
+}
+
+// 捐赠 返回捐赠计数器
+func Donate(ledger Ledger, applicationNumber string, donation Donation) (int, error) {
+	application, err := ledger.Applications.Get(applicationNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	if application.State != Raising {
+		return 0, fmt.Errorf("当前合约不能接受捐赠")
+	}
+
+	if donation.Amount <= 0 {
+		return 0, fmt.Errorf("捐赠金额需要是正数  %v", donation.Amount)
+	}
+
+	donateCounter := application.DonateCounter + 1
+	err = ledger.Donations.Put(applicationNumber, donateCounter, donation)
+	if err != nil {
+		return 0, err
+	}
+
+	// 更新捐赠次数计数器
+	application.DonateCounter = donateCounter
+
+	// 更新金额
+	application.AmountRaised = application.AmountRaised + donation.Amount
+
+	// 更新余额
+	application.Balance = application.Balance + donation.Amount
+
+	err = ledger.Applications.Put(application)
+	if err != nil {
+		return 0, err
+	}
+
+	return donateCounter, nil
+}
+
+// 贷款 返回贷款计数器与贷款后剩余的可贷额度
+func Lend(ledger Ledger, applicationNumber string, loanInfo LoanInfo) (int, float64, error) {
+	application, err := ledger.Applications.Get(applicationNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if application.State != Raising && application.State != Raised {
+		return 0, 0, fmt.Errorf("当前合约不能申请贷款")
+	}
+
+	if loanInfo.LoanAmount <= 0 {
+		return 0, 0, fmt.Errorf("贷款金额需要是正数  %v", loanInfo.LoanAmount)
+	}
+
+	capacity, err := loanCapacity(ledger.Coverage, application, loanInfo.Bank)
+	if err != nil {
+		return 0, 0, err
+	}
+	if loanInfo.LoanAmount > capacity {
+		return 0, 0, fmt.Errorf("贷款金额超过剩余可贷额度  %v, 剩余可贷额度 %v", loanInfo.LoanAmount, capacity)
+	}
+
+	// 新的贷款还没有放款和还款
+	loanInfo.MoneyReceived = false
+	loanInfo.ReceiveSerialNumber = ""
+	loanInfo.RepaymentHistory = "[]"
+
+	loanCounter := application.LoanCounter + 1
+	err = ledger.Loans.Put(applicationNumber, loanCounter, loanInfo)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 更新贷款次数计数器
+	application.LoanCounter = loanCounter
+	// 更新总贷款金额
+	application.LoanTotal = application.LoanTotal + loanInfo.LoanAmount
+
+	err = ledger.Applications.Put(application)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = ledger.Coverage.PutLoanExposure(loanInfo.Bank, applicationNumber, loanCounter, loanInfo.LoanAmount)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return loanCounter, capacity - loanInfo.LoanAmount, nil
+}
+
+// 收到银行放款
+func ReceiveLoan(ledger Ledger, applicationNumber string, loanNumber string, loanCounter int, serialNumber string) error {
+	application, err := ledger.Applications.Get(applicationNumber)
+	if err != nil {
+		return err
+	}
+
+	if application.State == Cheat {
+		return fmt.Errorf("涉嫌欺诈,不予放款")
+	}
+
+	loanInfo, err := ledger.Loans.Get(applicationNumber, loanCounter)
+	if err != nil {
+		return err
+	}
+
+	if loanInfo.LoanNumber != loanNumber {
+		return fmt.Errorf("贷款单号不匹配")
+	}
+
+	if loanInfo.MoneyReceived {
+		return fmt.Errorf("已经收到放款")
+	}
+
+	loanInfo.MoneyReceived = true
+	loanInfo.ReceiveSerialNumber = serialNumber
+
+	err = ledger.Loans.Put(applicationNumber, loanCounter, loanInfo)
+	if err != nil {
+		return err
+	}
+
+	application.ReceivedLoanTotal = application.ReceivedLoanTotal + loanInfo.LoanAmount
+	return ledger.Applications.Put(application)
+}
+
+// 偿还贷款的一期 返回已经还款的期数
+// 还款期数达到 total_month 时贷款还清 释放贷款占用的银行敞口 欺诈申请已经放款的贷款也需要还款
+func Repay(ledger Ledger, applicationNumber string, loanNumber string, loanCounter int, serialNumber string) (int, error) {
+	_, err := ledger.Applications.Get(applicationNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	loanInfo, err := ledger.Loans.Get(applicationNumber, loanCounter)
+	if err != nil {
+		return 0, err
+	}
+
+	if loanInfo.LoanNumber != loanNumber {
+		return 0, fmt.Errorf("贷款单号不匹配")
+	}
+
+	if !loanInfo.MoneyReceived {
+		return 0, fmt.Errorf("还没有收到放款")
+	}
+
+	totalMonth, err := strconv.Atoi(loanInfo.TotalMonth)
+	if err != nil {
+		return 0, fmt.Errorf("还款期数需要是整数 %s", loanInfo.TotalMonth)
+	}
+
+	repayments := []string{}
+	if loanInfo.RepaymentHistory != "" {
+		err = json.Unmarshal([]byte(loanInfo.RepaymentHistory), &repayments)
+		if err != nil {
+			return 0, fmt.Errorf("无法将还款历史转换为数组 %s", loanInfo.LoanNumber)
+		}
+	}
+	if len(repayments) >= totalMonth {
+		return 0, fmt.Errorf("贷款已经还清")
+	}
+
+	repayments = append(repayments, serialNumber)
+	repaymentsAsBytes, err := json.Marshal(repayments)
+	if err != nil {
+		return 0, fmt.Errorf("无法将还款历史转换为Json字符串")
+	}
+	loanInfo.RepaymentHistory = string(repaymentsAsBytes)
+
+	err = ledger.Loans.Put(applicationNumber, loanCounter, loanInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(repayments) == totalMonth {
+		err = ledger.Coverage.ReleaseLoanExposure(loanInfo.Bank, applicationNumber, loanCounter)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(repayments), nil
+}
+
+// 设置申请为欺诈申请
+// 欺诈申请不会再放款 还没有放款的贷款从银行贷款敞口中释放 已经放款的贷款在还清时释放
+// 重复设置时不会再次释放
+func MarkCheat(ledger Ledger, applicationNumber string) error {
+	application, err := ledger.Applications.Get(applicationNumber)
+	if err != nil {
+		return err
+	}
+
+	if application.State != Cheat {
+		loans, err := ledger.Loans.List(applicationNumber)
+		if err != nil {
+			return err
+		}
+		// 贷款按计数器顺序返回 计数器从1开始
+		for i, loanInfo := range loans {
+			if loanInfo.MoneyReceived {
+				continue
+			}
+			err = ledger.Coverage.ReleaseLoanExposure(loanInfo.Bank, applicationNumber, i+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	application.State = Cheat
+	return ledger.Applications.Put(application)
+}
+
+// 为用户的就诊卡充值 返回充值计数器
+// 充值金额需要是正数 并且不能超过可用资金 之前的版本没有这两项校验 参考 CHANGELOG.md
+func Recharge(ledger Ledger, applicationNumber string, serialNumber string, amount float64) (int, error) {
+	application, err := ledger.Applications.Get(applicationNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	if application.State == Cheat {
+		return 0, fmt.Errorf("涉嫌欺诈,不予充值")
+	}
+
+	if amount <= 0 {
+		return 0, fmt.Errorf("充值金额需要是正数  %v", amount)
+	}
+
+	available, _ := availableFunds(application)
+	if amount > available+amountTolerance {
+		return 0, fmt.Errorf("充值金额超过可用资金  %v, 可用资金 %v", amount, available)
+	}
+
+	newCounter := application.RechargeCounter + 1
+	err = ledger.Recharges.Put(applicationNumber, newCounter, RechargeHistory{
+		Amount:       amount,
+		SerialNumber: serialNumber,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	application.RechargeTotal = application.RechargeTotal + amount
+	application.RechargeCounter = newCounter
+	err = ledger.Applications.Put(application)
+	if err != nil {
+		return 0, err
+	}
+
+	return newCounter, nil
+}
+
+// 申请的可用资金 即捐赠加已经到账的贷款减去已经充值的金额
+// 充值先使用已经到账的贷款 再使用捐赠 donated 为可用资金中来自捐赠的部分 贷款的担保只能来自这部分 参考 raisedFundsRule
+func availableFunds(application Application) (total float64, donated float64) {
+	total = application.AmountRaised + application.ReceivedLoanTotal - application.RechargeTotal
+	donated = math.Max(math.Min(application.AmountRaised, total), 0)
+	return total, donated
+}
@@ -0,0 +1,477 @@
+package sxc
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 创建一个筹款中的申请 并按顺序捐赠
+func raisingLedger(t *testing.T, amounts ...float64) Ledger {
+	t.Helper()
+
+	ledger := NewMemoryLedger()
+	err := Apply(ledger, Application{ApplicationNumber: "1", NeedAmount: 1000})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	err = Verify(ledger, "1", "op", true, 800, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	for _, amount := range amounts {
+		_, err = Donate(ledger, "1", Donation{Amount: amount})
+		if err != nil {
+			t.Fatalf("Donate: %v", err)
+		}
+	}
+	return ledger
+}
+
+func getMemoryApplication(t *testing.T, ledger Ledger) Application {
+	t.Helper()
+
+	application, err := ledger.Applications.Get("1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return application
+}
+
+// 期望的错误 为空时不期望出错
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want %q", err, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	ledger := NewMemoryLedger()
+
+	err := Apply(ledger, Application{ApplicationNumber: "1", State: Raised})
+	checkError(t, err, "")
+
+	application := getMemoryApplication(t, ledger)
+	if application.State != HospitalVerify {
+		t.Errorf("State = %d, want %d", application.State, HospitalVerify)
+	}
+	if application.SchemaVersion != schemaVersion(applicationDocType) {
+		t.Errorf("SchemaVersion = %d, want %d", application.SchemaVersion, schemaVersion(applicationDocType))
+	}
+
+	err = Apply(ledger, Application{ApplicationNumber: "1"})
+	checkError(t, err, "已经存在此合约编号 1")
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		agree     bool
+		wantState int
+	}{
+		{"同意", true, Raising},
+		{"不同意", false, HospitalReject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := NewMemoryLedger()
+			checkError(t, Apply(ledger, Application{ApplicationNumber: "1"}), "")
+
+			err := Verify(ledger, "1", "op", tt.agree, 800, []Attachment{{ID: "a1"}})
+			checkError(t, err, "")
+
+			application := getMemoryApplication(t, ledger)
+			if application.State != tt.wantState {
+				t.Errorf("State = %d, want %d", application.State, tt.wantState)
+			}
+			if application.HospitalOperator != "op" || len(application.HospitalAttachments) != 1 {
+				t.Errorf("审核信息没有写入 %+v", application)
+			}
+
+			err = Verify(ledger, "1", "op", true, 800, nil)
+			checkError(t, err, "合约已经审核过啦")
+		})
+	}
+
+	err := Verify(NewMemoryLedger(), "2", "op", true, 800, nil)
+	checkError(t, err, "未找到此申请的信息 2")
+}
+
+func TestDonate(t *testing.T) {
+	tests := []struct {
+		name        string
+		cheat       bool
+		amount      float64
+		wantCounter int
+		wantErr     string
+	}{
+		{"捐赠", false, 100, 2, ""},
+		{"金额为0", false, 0, 0, "捐赠金额需要是正数"},
+		{"金额为负数", false, -1, 0, "捐赠金额需要是正数"},
+		{"欺诈申请不能捐赠", true, 100, 0, "当前合约不能接受捐赠"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := raisingLedger(t, 50)
+			if tt.cheat {
+				checkError(t, MarkCheat(ledger, "1"), "")
+			}
+
+			counter, err := Donate(ledger, "1", Donation{Amount: tt.amount})
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+
+			if counter != tt.wantCounter {
+				t.Errorf("counter = %d, want %d", counter, tt.wantCounter)
+			}
+			application := getMemoryApplication(t, ledger)
+			if application.AmountRaised != 150 || application.Balance != 150 || application.DonateCounter != 2 {
+				t.Errorf("汇总数据错误 raised %v balance %v counter %d", application.AmountRaised, application.Balance, application.DonateCounter)
+			}
+			donations, err := ledger.Donations.List("1")
+			checkError(t, err, "")
+			if len(donations) != 2 || donations[1].Amount != tt.amount {
+				t.Errorf("donations = %+v", donations)
+			}
+		})
+	}
+}
+
+func TestLend(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        *CoveragePolicy
+		loans         []LoanInfo
+		loan          LoanInfo
+		wantRemaining float64
+		wantErr       string
+	}{
+		{
+			name:          "默认策略按募集资金计算",
+			loan:          LoanInfo{LoanNumber: "L1", LoanAmount: 300},
+			wantRemaining: 100,
+		},
+		{
+			name:    "超过募集资金",
+			loan:    LoanInfo{LoanNumber: "L1", LoanAmount: 401},
+			wantErr: "贷款金额超过剩余可贷额度",
+		},
+		{
+			name:    "金额需要是正数",
+			loan:    LoanInfo{LoanNumber: "L1"},
+			wantErr: "贷款金额需要是正数",
+		},
+		{
+			name:          "已有贷款计入总额",
+			loans:         []LoanInfo{{LoanNumber: "L1", LoanAmount: 100}},
+			loan:          LoanInfo{LoanNumber: "L2", LoanAmount: 100},
+			wantRemaining: 200,
+		},
+		{
+			name:          "最大贷款比例和担保比例",
+			policy:        &CoveragePolicy{MaxLoanRatio: 0.5, CollateralRatio: 0.5},
+			loan:          LoanInfo{LoanNumber: "L1", LoanAmount: 60},
+			wantRemaining: 40,
+		},
+		{
+			name:    "配置了银行上限时需要指定银行",
+			policy:  &CoveragePolicy{MaxLoanRatio: 1, BankLimits: map[string]float64{"icbc": 100}},
+			loan:    LoanInfo{LoanNumber: "L1", LoanAmount: 10},
+			wantErr: "需要指定放款银行",
+		},
+		{
+			name:          "银行上限",
+			policy:        &CoveragePolicy{MaxLoanRatio: 1, BankLimits: map[string]float64{"icbc": 100}},
+			loans:         []LoanInfo{{LoanNumber: "L1", LoanAmount: 30, Bank: "icbc"}},
+			loan:          LoanInfo{LoanNumber: "L2", LoanAmount: 50, Bank: "icbc"},
+			wantRemaining: 20,
+		},
+		{
+			name:    "未列出的银行使用默认上限",
+			policy:  &CoveragePolicy{MaxLoanRatio: 1, BankLimits: map[string]float64{"icbc": 100}},
+			loan:    LoanInfo{LoanNumber: "L1", LoanAmount: 10, Bank: "boc"},
+			wantErr: "剩余可贷额度 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := raisingLedger(t, 400)
+			if tt.policy != nil {
+				checkError(t, SetMemoryCoveragePolicy(ledger, *tt.policy), "")
+			}
+			for _, loanInfo := range tt.loans {
+				_, _, err := Lend(ledger, "1", loanInfo)
+				checkError(t, err, "")
+			}
+
+			counter, remaining, err := Lend(ledger, "1", tt.loan)
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+
+			if counter != len(tt.loans)+1 {
+				t.Errorf("counter = %d, want %d", counter, len(tt.loans)+1)
+			}
+			if remaining != tt.wantRemaining {
+				t.Errorf("remaining = %v, want %v", remaining, tt.wantRemaining)
+			}
+			loanInfo, err := ledger.Loans.Get("1", counter)
+			checkError(t, err, "")
+			if loanInfo.MoneyReceived || loanInfo.RepaymentHistory != "[]" {
+				t.Errorf("新的贷款不应该有放款和还款 %+v", loanInfo)
+			}
+		})
+	}
+}
+
+func TestLendState(t *testing.T) {
+	ledger := NewMemoryLedger()
+	checkError(t, Apply(ledger, Application{ApplicationNumber: "1"}), "")
+
+	_, _, err := Lend(ledger, "1", LoanInfo{LoanNumber: "L1", LoanAmount: 1})
+	checkError(t, err, "当前合约不能申请贷款")
+}
+
+func TestSetMemoryCoveragePolicy(t *testing.T) {
+	err := SetMemoryCoveragePolicy(NewMemoryLedger(), CoveragePolicy{MaxLoanRatio: 2})
+	checkError(t, err, "最大贷款比例需要在 (0, 1] 之间")
+}
+
+func TestReceiveLoan(t *testing.T) {
+	tests := []struct {
+		name       string
+		cheat      bool
+		loanNumber string
+		counter    int
+		wantErr    string
+	}{
+		{"收到放款", false, "L1", 1, ""},
+		{"贷款单号不匹配", false, "L2", 1, "贷款单号不匹配"},
+		{"贷款不存在", false, "L1", 2, "未找到此贷款信息"},
+		{"欺诈申请不予放款", true, "L1", 1, "涉嫌欺诈,不予放款"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := raisingLedger(t, 400)
+			_, _, err := Lend(ledger, "1", LoanInfo{LoanNumber: "L1", LoanAmount: 100})
+			checkError(t, err, "")
+			if tt.cheat {
+				checkError(t, MarkCheat(ledger, "1"), "")
+			}
+
+			err = ReceiveLoan(ledger, "1", tt.loanNumber, tt.counter, "bsn1")
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+
+			application := getMemoryApplication(t, ledger)
+			if application.ReceivedLoanTotal != 100 {
+				t.Errorf("ReceivedLoanTotal = %v, want 100", application.ReceivedLoanTotal)
+			}
+
+			err = ReceiveLoan(ledger, "1", tt.loanNumber, tt.counter, "bsn2")
+			checkError(t, err, "已经收到放款")
+		})
+	}
+}
+
+func TestMarkCheatBankExposure(t *testing.T) {
+	tests := []struct {
+		name     string
+		received bool
+		marks    int
+		want     float64
+	}{
+		{"释放没有放款的贷款", false, 1, 30},
+		{"已经放款的贷款仍然占用敞口", true, 1, 130},
+		{"重复设置不会再次释放", false, 2, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := raisingLedger(t, 400)
+			checkError(t, SetMemoryCoveragePolicy(ledger, CoveragePolicy{MaxLoanRatio: 1, BankLimits: map[string]float64{"icbc": 200}}), "")
+			_, _, err := Lend(ledger, "1", LoanInfo{LoanNumber: "L1", LoanAmount: 30, Bank: "icbc"})
+			checkError(t, err, "")
+			_, _, err = Lend(ledger, "1", LoanInfo{LoanNumber: "L2", LoanAmount: 100, Bank: "icbc"})
+			checkError(t, err, "")
+			checkError(t, ReceiveLoan(ledger, "1", "L1", 1, "bsn1"), "")
+			if tt.received {
+				checkError(t, ReceiveLoan(ledger, "1", "L2", 2, "bsn2"), "")
+			}
+
+			for i := 0; i < tt.marks; i++ {
+				checkError(t, MarkCheat(ledger, "1"), "")
+			}
+
+			exposure, err := ledger.Coverage.BankExposure("icbc")
+			checkError(t, err, "")
+			if exposure != tt.want {
+				t.Errorf("exposure = %v, want %v", exposure, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepay(t *testing.T) {
+	tests := []struct {
+		name         string
+		received     bool
+		loanNumber   string
+		repayments   int
+		wantErr      string
+		wantExposure float64
+	}{
+		{"还款一期", true, "L1", 1, "", 100},
+		{"还清后释放敞口", true, "L1", 2, "", 0},
+		{"还清后不能再还款", true, "L1", 3, "贷款已经还清", 0},
+		{"还没有收到放款", false, "L1", 1, "还没有收到放款", 100},
+		{"贷款单号不匹配", true, "L2", 1, "贷款单号不匹配", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := raisingLedger(t, 400)
+			checkError(t, SetMemoryCoveragePolicy(ledger, CoveragePolicy{MaxLoanRatio: 1, BankLimits: map[string]float64{"icbc": 200}}), "")
+			_, _, err := Lend(ledger, "1", LoanInfo{LoanNumber: "L1", TotalMonth: "2", LoanAmount: 100, Bank: "icbc"})
+			checkError(t, err, "")
+			if tt.received {
+				checkError(t, ReceiveLoan(ledger, "1", "L1", 1, "bsn1"), "")
+			}
+
+			for i := 1; i <= tt.repayments; i++ {
+				repaid, err := Repay(ledger, "1", tt.loanNumber, 1, "psn"+strconv.Itoa(i))
+				if i == tt.repayments {
+					checkError(t, err, tt.wantErr)
+					break
+				}
+				checkError(t, err, "")
+				if repaid != i {
+					t.Errorf("repaid = %d, want %d", repaid, i)
+				}
+			}
+
+			exposure, err := ledger.Coverage.BankExposure("icbc")
+			checkError(t, err, "")
+			if exposure != tt.wantExposure {
+				t.Errorf("exposure = %v, want %v", exposure, tt.wantExposure)
+			}
+		})
+	}
+}
+
+// 充值先使用已经到账的贷款 只有用掉捐赠时可贷额度才减少
+func TestLoanCapacityAfterRecharge(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount float64
+		want   float64
+	}{
+		{"使用贷款充值", 100, 300},
+		{"贷款用完后使用捐赠充值", 150, 250},
+		{"可用资金全部充值", 500, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := raisingLedger(t, 400)
+			_, _, err := Lend(ledger, "1", LoanInfo{LoanNumber: "L1", LoanAmount: 100})
+			checkError(t, err, "")
+			checkError(t, ReceiveLoan(ledger, "1", "L1", 1, "bsn1"), "")
+
+			_, err = Recharge(ledger, "1", "rsn1", tt.amount)
+			checkError(t, err, "")
+
+			capacity, err := loanCapacity(ledger.Coverage, getMemoryApplication(t, ledger), "")
+			checkError(t, err, "")
+			if capacity != tt.want {
+				t.Errorf("capacity = %v, want %v", capacity, tt.want)
+			}
+		})
+	}
+}
+
+// 链码中没有待确认的捐赠 捐赠上链后立即计入可贷额度
+func TestLoanCapacityAfterDonate(t *testing.T) {
+	ledger := raisingLedger(t, 100)
+
+	capacity, err := loanCapacity(ledger.Coverage, getMemoryApplication(t, ledger), "")
+	checkError(t, err, "")
+	if capacity != 100 {
+		t.Fatalf("capacity = %v, want 100", capacity)
+	}
+
+	_, err = Donate(ledger, "1", Donation{Amount: 50})
+	checkError(t, err, "")
+	capacity, err = loanCapacity(ledger.Coverage, getMemoryApplication(t, ledger), "")
+	checkError(t, err, "")
+	if capacity != 150 {
+		t.Errorf("capacity = %v, want 150", capacity)
+	}
+}
+
+func TestRecharge(t *testing.T) {
+	tests := []struct {
+		name        string
+		cheat       bool
+		received    bool
+		amount      float64
+		wantCounter int
+		wantErr     string
+	}{
+		{"使用捐赠充值", false, false, 400, 1, ""},
+		{"超过可用资金", false, false, 401, 0, "充值金额超过可用资金"},
+		{"已经到账的贷款可以充值", false, true, 500, 1, ""},
+		{"金额需要是正数", false, false, 0, 0, "充值金额需要是正数"},
+		{"欺诈申请不予充值", true, false, 1, 0, "涉嫌欺诈,不予充值"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := raisingLedger(t, 400)
+			if tt.received {
+				_, _, err := Lend(ledger, "1", LoanInfo{LoanNumber: "L1", LoanAmount: 100})
+				checkError(t, err, "")
+				checkError(t, ReceiveLoan(ledger, "1", "L1", 1, "bsn1"), "")
+			}
+			if tt.cheat {
+				checkError(t, MarkCheat(ledger, "1"), "")
+			}
+
+			counter, err := Recharge(ledger, "1", "rsn1", tt.amount)
+			checkError(t, err, tt.wantErr)
+			if tt.wantErr != "" {
+				return
+			}
+
+			if counter != tt.wantCounter {
+				t.Errorf("counter = %d, want %d", counter, tt.wantCounter)
+			}
+			application := getMemoryApplication(t, ledger)
+			if application.RechargeTotal != tt.amount {
+				t.Errorf("RechargeTotal = %v, want %v", application.RechargeTotal, tt.amount)
+			}
+			recharges, err := ledger.Recharges.List("1")
+			checkError(t, err, "")
+			if len(recharges) != 1 || recharges[0].SerialNumber != "rsn1" {
+				t.Errorf("recharges = %+v", recharges)
+			}
+		})
+	}
+}
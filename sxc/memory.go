@@ -0,0 +1,188 @@
+package sxc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 基于内存的存储 不依赖 Fabric 节点 用于在本地验证业务函数
+// 文档版本的处理与链上存储一致 不记录修改者的MSP ID
+func NewMemoryLedger() Ledger {
+	return Ledger{
+		Applications: &memoryApplications{applications: map[string]Application{}},
+		Donations:    &memoryDonations{donations: map[string]map[int]Donation{}},
+		Loans:        &memoryLoans{loans: map[string]map[int]LoanInfo{}},
+		Recharges:    &memoryRecharges{recharges: map[string]map[int]RechargeHistory{}},
+		Coverage:     &memoryCoverage{policy: defaultCoveragePolicy, exposures: map[loanExposure]float64{}},
+	}
+}
+
+// 内存中的覆盖策略 测试时可以直接替换
+func SetMemoryCoveragePolicy(ledger Ledger, policy CoveragePolicy) error {
+	coverage, ok := ledger.Coverage.(*memoryCoverage)
+	if !ok {
+		return fmt.Errorf("不是内存存储")
+	}
+
+	err := policy.Validate()
+	if err != nil {
+		return err
+	}
+
+	coverage.policy = policy
+	return nil
+}
+
+// 按计数器排序
+func sortedCounters(counters []int) []int {
+	sort.Ints(counters)
+	return counters
+}
+
+type memoryApplications struct {
+	applications map[string]Application
+}
+
+func (r *memoryApplications) Get(applicationNumber string) (Application, error) {
+	application, ok := r.applications[applicationNumber]
+	if !ok {
+		return application, fmt.Errorf("未找到此申请的信息 %s", applicationNumber)
+	}
+	return application, nil
+}
+
+func (r *memoryApplications) Exists(applicationNumber string) (bool, error) {
+	_, ok := r.applications[applicationNumber]
+	return ok, nil
+}
+
+func (r *memoryApplications) Put(application Application) error {
+	application.SchemaVersion = schemaVersion(applicationDocType)
+	r.applications[application.ApplicationNumber] = application
+	return nil
+}
+
+type memoryDonations struct {
+	donations map[string]map[int]Donation
+}
+
+func (r *memoryDonations) Put(applicationNumber string, counter int, donation Donation) error {
+	if r.donations[applicationNumber] == nil {
+		r.donations[applicationNumber] = map[int]Donation{}
+	}
+	donation.SchemaVersion = schemaVersion(donationDocType)
+	r.donations[applicationNumber][counter] = donation
+	return nil
+}
+
+func (r *memoryDonations) List(applicationNumber string) ([]Donation, error) {
+	counters := []int{}
+	for counter := range r.donations[applicationNumber] {
+		counters = append(counters, counter)
+	}
+
+	donations := []Donation{}
+	for _, counter := range sortedCounters(counters) {
+		donations = append(donations, r.donations[applicationNumber][counter])
+	}
+	return donations, nil
+}
+
+type memoryLoans struct {
+	loans map[string]map[int]LoanInfo
+}
+
+func (r *memoryLoans) Get(applicationNumber string, counter int) (LoanInfo, error) {
+	loanInfo, ok := r.loans[applicationNumber][counter]
+	if !ok {
+		return loanInfo, fmt.Errorf("未找到此贷款信息 %s,%d", applicationNumber, counter)
+	}
+	return loanInfo, nil
+}
+
+func (r *memoryLoans) Put(applicationNumber string, counter int, loanInfo LoanInfo) error {
+	if r.loans[applicationNumber] == nil {
+		r.loans[applicationNumber] = map[int]LoanInfo{}
+	}
+	loanInfo.SchemaVersion = schemaVersion(loanDocType)
+	r.loans[applicationNumber][counter] = loanInfo
+	return nil
+}
+
+func (r *memoryLoans) List(applicationNumber string) ([]LoanInfo, error) {
+	counters := []int{}
+	for counter := range r.loans[applicationNumber] {
+		counters = append(counters, counter)
+	}
+
+	loans := []LoanInfo{}
+	for _, counter := range sortedCounters(counters) {
+		loans = append(loans, r.loans[applicationNumber][counter])
+	}
+	return loans, nil
+}
+
+type memoryRecharges struct {
+	recharges map[string]map[int]RechargeHistory
+}
+
+func (r *memoryRecharges) Put(applicationNumber string, counter int, recharge RechargeHistory) error {
+	if r.recharges[applicationNumber] == nil {
+		r.recharges[applicationNumber] = map[int]RechargeHistory{}
+	}
+	recharge.SchemaVersion = schemaVersion(rechargeDocType)
+	r.recharges[applicationNumber][counter] = recharge
+	return nil
+}
+
+func (r *memoryRecharges) List(applicationNumber string) ([]RechargeHistory, error) {
+	counters := []int{}
+	for counter := range r.recharges[applicationNumber] {
+		counters = append(counters, counter)
+	}
+
+	recharges := []RechargeHistory{}
+	for _, counter := range sortedCounters(counters) {
+		recharges = append(recharges, r.recharges[applicationNumber][counter])
+	}
+	return recharges, nil
+}
+
+// 一笔贷款占用的银行敞口
+type loanExposure struct {
+	bank              string
+	applicationNumber string
+	counter           int
+}
+
+type memoryCoverage struct {
+	policy    CoveragePolicy
+	exposures map[loanExposure]float64
+}
+
+func (r *memoryCoverage) Policy() (CoveragePolicy, error) {
+	return r.policy, nil
+}
+
+func (r *memoryCoverage) BankExposure(bank string) (float64, error) {
+	exposure := 0.0
+	for loan, amount := range r.exposures {
+		if loan.bank == bank {
+			exposure = exposure + amount
+		}
+	}
+	return exposure, nil
+}
+
+func (r *memoryCoverage) PutLoanExposure(bank string, applicationNumber string, counter int, amount float64) error {
+	if bank == "" {
+		return nil
+	}
+	r.exposures[loanExposure{bank, applicationNumber, counter}] = amount
+	return nil
+}
+
+func (r *memoryCoverage) ReleaseLoanExposure(bank string, applicationNumber string, counter int) error {
+	delete(r.exposures, loanExposure{bank, applicationNumber, counter})
+	return nil
+}
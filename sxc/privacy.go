@@ -0,0 +1,255 @@
+package sxc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/core/governance"
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 捐赠者的隐私模式
+const (
+	PrivacyPublic       = "public"       // 公开 姓名与平台ID明文上链
+	PrivacyPseudonymous = "pseudonymous" // 化名 平台ID加盐哈希后上链 同一捐赠者的多笔捐赠可以关联
+	PrivacyAnonymous    = "anonymous"    // 匿名 不上链任何身份信息
+)
+
+// 非公开模式下公开账本中展示的捐赠者姓名
+const anonymousDonator = "匿名"
+
+// 真实身份所在的私有数据集合 只有捐赠平台持有
+const donorIdentityCollection = "donorIdentity"
+
+// 非公开模式下 真实身份通过 transient 的 donor 字段传入 不会出现在交易参数中
+const donorTransientKey = "donor"
+
+// 捐赠者的真实身份 存储在私有数据集合中
+type DonorIdentity struct {
+	Donator    string `json:"donator"`     // 捐赠者姓名
+	PlatformID string `json:"platform_id"` // 捐赠者在平台的ID
+	Salt       string `json:"salt"`        // 化名哈希使用的盐 由捐赠者自行保管
+	Privacy    string `json:"privacy"`     // 隐私模式
+}
+
+// 角色配置 由治理组织维护 参考 governance.RoleConfig
+type RoleConfig = governance.RoleConfig
+
+// 查询返回的捐赠记录
+type DonationView struct {
+	DonateCounter int `json:"donate_counter"` // 第几笔捐赠
+	Donation
+}
+
+// 加盐哈希 公开模式下盐为空
+func saltedHash(salt string, platformID string) string {
+	sum := sha256.Sum256([]byte(salt + platformID))
+	return hex.EncodeToString(sum[:])
+}
+
+// 根据隐私模式确定捐赠者身份
+// 公开模式直接使用交易参数 非公开模式要求交易参数中的身份为空 真实身份从 transient 中读取
+func resolveDonor(stub shim.ChaincodeStubInterface, privacy string, donator string, platformID string) (DonorIdentity, error) {
+	identity := DonorIdentity{Privacy: privacy}
+
+	switch privacy {
+	case PrivacyPublic:
+		identity.Donator = donator
+		identity.PlatformID = platformID
+		return identity, nil
+	case PrivacyPseudonymous, PrivacyAnonymous:
+	default:
+		return identity, fmt.Errorf("隐私模式参数错误 %s", privacy)
+	}
+
+	if donator != "" || platformID != "" {
+		return identity, fmt.Errorf("非公开模式下捐赠者身份需要通过 transient 传入 交易参数中的姓名和平台ID需要为空")
+	}
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return identity, fmt.Errorf("获取 transient 数据失败")
+	}
+
+	identityAsBytes, ok := transient[donorTransientKey]
+	if !ok {
+		return identity, fmt.Errorf("transient 中缺少捐赠者身份 %s", donorTransientKey)
+	}
+
+	err = json.Unmarshal(identityAsBytes, &identity)
+	if err != nil {
+		return identity, fmt.Errorf("无法将 transient 数据转换为捐赠者身份")
+	}
+	identity.Privacy = privacy
+
+	if identity.PlatformID == "" {
+		return identity, fmt.Errorf("捐赠者平台ID不能为空")
+	}
+	if identity.Salt == "" {
+		return identity, fmt.Errorf("非公开模式下盐不能为空")
+	}
+
+	return identity, nil
+}
+
+// 生成写入公开账本的捐赠者字段
+func maskDonor(identity DonorIdentity) (string, string) {
+	switch identity.Privacy {
+	case PrivacyPseudonymous:
+		return anonymousDonator, saltedHash(identity.Salt, identity.PlatformID)
+	case PrivacyAnonymous:
+		return anonymousDonator, ""
+	default:
+		return identity.Donator, identity.PlatformID
+	}
+}
+
+// 非公开模式下将真实身份写入私有数据集合
+func putDonorIdentity(stub shim.ChaincodeStubInterface, donateKey string, identity DonorIdentity) error {
+	if identity.Privacy == PrivacyPublic {
+		return nil
+	}
+
+	identityAsBytes, err := json.Marshal(identity)
+	if err != nil {
+		return fmt.Errorf("无法将捐赠者身份转换为Json字符串")
+	}
+
+	err = stub.PutPrivateData(donorIdentityCollection, donateKey, identityAsBytes)
+	if err != nil {
+		return fmt.Errorf("捐赠者身份写入私有数据失败")
+	}
+
+	return nil
+}
+
+// 判断调用者是否拥有某个角色
+func hasRole(stub shim.ChaincodeStubInterface, role func(RoleConfig) []string) (bool, error) {
+	roles := RoleConfig{}
+	_, err := getConfig(stub, "roles", &roles)
+	if err != nil {
+		return false, err
+	}
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return false, fmt.Errorf("获取调用者MSP ID失败")
+	}
+
+	for _, msp := range role(roles) {
+		if msp == mspID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// 判断调用者是否为捐赠平台
+func isDonationPlatform(stub shim.ChaincodeStubInterface) (bool, error) {
+	return hasRole(stub, func(roles RoleConfig) []string { return roles.PlatformMSPs })
+}
+
+// 判断调用者是否为管理员
+func isAdmin(stub shim.ChaincodeStubInterface) (bool, error) {
+	return hasRole(stub, func(roles RoleConfig) []string { return roles.AdminMSPs })
+}
+
+// 设置角色配置 只有治理组织可以调用 也可以通过治理提案修改 参考 executeProposal
+// 入参列表
+//
+//	roles 角色配置 json string
+//
+// 范例 ["invoke", "setRoles", "{\"platform_msps\":[\"PlatformMSP\"],\"admin_msps\":[\"Org1MSP\"]}"]
+func setRoles(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	err = requireGovernance(stub)
+	if err != nil {
+		return "", err
+	}
+
+	roles := RoleConfig{}
+	err = json.Unmarshal([]byte(args[0]), &roles)
+	if err != nil {
+		return "", fmt.Errorf("无法将角色配置转换为角色配置对象 %s", args[0])
+	}
+
+	_, err = applyParameterChange(stub, ParameterChange{Parameter: ParameterRoles, Roles: &roles}, "")
+	if err != nil {
+		return "", err
+	}
+
+	return "成功", nil
+}
+
+// 查询申请的捐赠记录
+// 捐赠平台可以看到非公开捐赠者的真实身份 其他调用者只能看到公开账本中的字段
+// 入参列表
+//
+//	application_number 合约编号
+//
+// 范例 ["query", "getDonations", "1"]
+func getDonations(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	applicationNumber := args[0]
+	_, err = getApplication(stub, applicationNumber)
+	if err != nil {
+		return "", err
+	}
+
+	platform, err := isDonationPlatform(stub)
+	if err != nil {
+		return "", err
+	}
+
+	records, err := getSubRecords(stub, donationObjectType, applicationNumber)
+	if err != nil {
+		return "", err
+	}
+
+	views := []DonationView{}
+	for _, record := range records {
+		view := DonationView{DonateCounter: record.Counter}
+		err = decodeDocument(donationDocType, record.Value, &view.Donation)
+		if err != nil {
+			return "", fmt.Errorf("捐赠记录json串转换为捐赠记录对象失败")
+		}
+
+		if platform && view.Privacy != "" && view.Privacy != PrivacyPublic {
+			identityAsBytes, err := stub.GetPrivateData(donorIdentityCollection, record.Key)
+			if err != nil {
+				return "", fmt.Errorf("获取捐赠者身份失败")
+			}
+			if identityAsBytes != nil {
+				identity := DonorIdentity{}
+				err = json.Unmarshal(identityAsBytes, &identity)
+				if err != nil {
+					return "", fmt.Errorf("捐赠者身份json串转换为捐赠者身份对象失败")
+				}
+				view.Donator = identity.Donator
+				view.PlatformID = identity.PlatformID
+			}
+		}
+
+		views = append(views, view)
+	}
+
+	viewsAsBytes, err := json.Marshal(views)
+	if err != nil {
+		return "", fmt.Errorf("无法将捐赠记录转换为Json字符串")
+	}
+
+	return string(viewsAsBytes), nil
+}
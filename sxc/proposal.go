@@ -0,0 +1,255 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/governance"
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 参数修改历史和已执行提案的复合键前缀
+const (
+	parameterHistoryObjectType = "parameterHistory" // parameterHistory~参数名~修改序号
+	parameterCounterObjectType = "parameterCounter" // parameterCounter~参数名 最后一次修改的序号
+	executedProposalObjectType = "executedProposal" // executedProposal~提案ID
+)
+
+// 没有在治理配置中指定时 治理提案所在的投票链码名称
+const DefaultProposalChaincode = "vote"
+
+// 可以修改的策略参数 参考 governance.ParameterCoverage
+// 募捐时间窗口目前没有对应的链上规则 不能通过治理提案修改
+const (
+	ParameterCoverage = governance.ParameterCoverage
+	ParameterRoles    = governance.ParameterRoles
+)
+
+// 一次参数修改 参考 governance.ParameterChange
+type ParameterChange = governance.ParameterChange
+
+// 参数修改历史中的一条记录
+type ParameterRecord struct {
+	ParameterChange
+	Sequence     int    `json:"sequence"`      // 修改序号 从1开始 与交易提交的顺序一致
+	ProposalID   string `json:"proposal_id"`   // 通过治理提案修改时的提案ID 治理组织直接修改时为空
+	SubmitterMSP string `json:"submitter_msp"` // 交易提交者的MSP ID
+	TxID         string `json:"tx_id"`         // 修改参数的交易ID
+	Timestamp    string `json:"timestamp"`     // 交易时间 RFC3339 UTC
+}
+
+// 投票链码 getProposal 的返回值 参考 governance.Proposal
+type GovernanceProposal = governance.Proposal
+
+// 写入参数并记录修改历史 proposalID 为空表示治理组织直接修改
+func applyParameterChange(stub shim.ChaincodeStubInterface, change ParameterChange, proposalID string) (ParameterRecord, error) {
+	err := change.Validate()
+	if err != nil {
+		return ParameterRecord{}, err
+	}
+
+	switch change.Parameter {
+	case ParameterCoverage:
+		err = putConfig(stub, ParameterCoverage, *change.Coverage)
+	case ParameterRoles:
+		err = putConfig(stub, ParameterRoles, *change.Roles)
+	}
+	if err != nil {
+		return ParameterRecord{}, err
+	}
+
+	mspID, err := submitterMSP(stub)
+	if err != nil {
+		return ParameterRecord{}, err
+	}
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return ParameterRecord{}, fmt.Errorf("获取交易时间失败")
+	}
+
+	// 序号计数器与参数在同一笔交易中修改 并发的修改只有一笔能提交 序号的顺序就是区块和交易的顺序
+	var sequence int
+	_, err = state.GetCompositeJSON(stub, parameterCounterObjectType, []string{change.Parameter}, &sequence)
+	if err != nil {
+		return ParameterRecord{}, err
+	}
+	sequence++
+	err = state.PutCompositeJSON(stub, parameterCounterObjectType, []string{change.Parameter}, sequence)
+	if err != nil {
+		return ParameterRecord{}, err
+	}
+
+	record := ParameterRecord{
+		ParameterChange: change,
+		Sequence:        sequence,
+		ProposalID:      proposalID,
+		SubmitterMSP:    mspID,
+		TxID:            stub.GetTxID(),
+		Timestamp:       time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC().Format(time.RFC3339),
+	}
+	err = state.PutCompositeJSON(stub, parameterHistoryObjectType, []string{change.Parameter, parameterSequenceKey(sequence)}, record)
+	if err != nil {
+		return ParameterRecord{}, err
+	}
+
+	return record, nil
+}
+
+// 投票链码的名称
+func proposalChaincode(stub shim.ChaincodeStubInterface) (string, error) {
+	config := GovernanceConfig{}
+	_, err := getConfig(stub, "governance", &config)
+	if err != nil {
+		return "", err
+	}
+	if config.ProposalChaincode == "" {
+		return DefaultProposalChaincode, nil
+	}
+	return config.ProposalChaincode, nil
+}
+
+// 执行投票通过的治理提案
+// 通过 InvokeChaincode 从投票链码读取提案和投票结论 投票本身就是授权 任何组织都可以调用
+// 每个提案只能执行一次 修改记录在参数历史中 带有提案ID
+// 入参列表
+//
+//	proposal_id 提案ID
+//
+// 范例 ["invoke", "executeProposal", "2024-coverage"]
+func executeProposal(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	found, err := state.GetCompositeJSON(stub, executedProposalObjectType, []string{args[0]}, &ParameterRecord{})
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return "", fmt.Errorf("提案已经执行过 %s", args[0])
+	}
+
+	chaincode, err := proposalChaincode(stub)
+	if err != nil {
+		return "", err
+	}
+
+	response := stub.InvokeChaincode(chaincode, [][]byte{[]byte("getProposal"), []byte(args[0])}, "")
+	if response.Status != shim.OK {
+		return "", fmt.Errorf("从投票链码 %s 读取提案失败 %s", chaincode, response.Message)
+	}
+
+	proposal := GovernanceProposal{}
+	err = json.Unmarshal(response.Payload, &proposal)
+	if err != nil {
+		return "", fmt.Errorf("无法将投票链码返回的提案转换为提案对象 %s", response.Payload)
+	}
+	if proposal.ProposalID != args[0] {
+		return "", fmt.Errorf("投票链码返回的提案ID不一致 %s", proposal.ProposalID)
+	}
+	if !proposal.Approved {
+		return "", fmt.Errorf("提案没有通过 %s 投票结论 %s", args[0], proposal.Status)
+	}
+
+	// 提案的表决范围和投票规则由提案者设置 只执行由全部治理组织表决并且满足治理配置最低要求的提案
+	config := GovernanceConfig{}
+	_, err = getConfig(stub, "governance", &config)
+	if err != nil {
+		return "", err
+	}
+	if !sameMSPs(proposal.VoterMSPs, config.MSPs) {
+		return "", fmt.Errorf("提案的投票组织 %v 与治理组织 %v 不一致", proposal.VoterMSPs, config.MSPs)
+	}
+	if proposal.Turnout < float64(config.proposalQuorum()) {
+		return "", fmt.Errorf("提案的投票组织数量 %v 少于治理要求的 %d", proposal.Turnout, config.proposalQuorum())
+	}
+	if !config.Requirement.reached(proposal.Share, config.proposalThreshold()) {
+		if config.Requirement.Inclusive {
+			return "", fmt.Errorf("提案的同意票比例 %v 低于治理要求的 %v", proposal.Share, config.proposalThreshold())
+		}
+		return "", fmt.Errorf("提案的同意票比例 %v 没有超过治理要求的 %v", proposal.Share, config.proposalThreshold())
+	}
+
+	record, err := applyParameterChange(stub, proposal.Change, proposal.ProposalID)
+	if err != nil {
+		return "", err
+	}
+
+	err = state.PutCompositeJSON(stub, executedProposalObjectType, []string{proposal.ProposalID}, record)
+	if err != nil {
+		return "", err
+	}
+
+	recordAsBytes, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("无法将参数修改记录转换为Json字符串")
+	}
+	return string(recordAsBytes), nil
+}
+
+// 两个MSP ID列表包含的组织是否相同 与顺序无关
+func sameMSPs(a []string, b []string) bool {
+	set := map[string]bool{}
+	for _, msp := range a {
+		set[msp] = true
+	}
+	for _, msp := range b {
+		if !set[msp] {
+			return false
+		}
+		delete(set, msp)
+	}
+	return len(set) == 0
+}
+
+// 修改序号补齐到相同的长度 复合键按字符串排序时与序号的顺序一致
+func parameterSequenceKey(sequence int) string {
+	return fmt.Sprintf("%010d", sequence)
+}
+
+// 查询参数的修改历史 按修改序号从早到晚排列 同一秒内的修改也按交易提交的顺序
+// 入参列表
+//
+//	parameter 参数名 coverage/roles
+//
+// 范例 ["query", "getParameterHistory", "coverage"]
+func getParameterHistory(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+	if args[0] != ParameterCoverage && args[0] != ParameterRoles {
+		return "", fmt.Errorf("不支持修改的参数 %s", args[0])
+	}
+
+	resultIterator, err := stub.GetStateByPartialCompositeKey(parameterHistoryObjectType, []string{args[0]})
+	if err != nil {
+		return "", fmt.Errorf("获取参数修改历史失败 %s", args[0])
+	}
+	defer resultIterator.Close()
+
+	records := []ParameterRecord{}
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("获取参数修改历史失败 %s", args[0])
+		}
+
+		record := ParameterRecord{}
+		err = json.Unmarshal(queryResult.Value, &record)
+		if err != nil {
+			return "", fmt.Errorf("json串转换为对象失败 %s", queryResult.Key)
+		}
+		records = append(records, record)
+	}
+
+	recordsAsBytes, err := json.Marshal(records)
+	if err != nil {
+		return "", fmt.Errorf("无法将参数修改历史转换为Json字符串")
+	}
+	return string(recordsAsBytes), nil
+}
@@ -0,0 +1,415 @@
+package sxc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 捐赠回执的复合键前缀
+const receiptObjectType = "receipt"
+
+// 捐赠回执
+// 字段顺序固定 json序列化的结果即为规范化的回执内容
+type DonationReceipt struct {
+	ReceiptID         string  `json:"receipt_id"`         // 回执编号
+	ApplicationNumber string  `json:"application_number"` // 申请编号
+	DonateCounter     int     `json:"donate_counter"`     // 第几笔捐赠
+	Amount            float64 `json:"amount"`             // 捐赠金额
+	Time              string  `json:"time"`               // 交易时间 RFC3339 UTC
+	TxID              string  `json:"tx_id"`              // 交易ID
+	PlatformIDHash    string  `json:"platform_id_hash"`   // 捐赠者平台ID的sha256 化名模式下先加盐 匿名模式下为空
+	SubmitterMSP      string  `json:"submitter_msp"`      // 提交交易的捐赠平台MSP ID
+}
+
+// 账本中记录的摘要回执 包含规范化内容的摘要
+// 摘要本身没有签名 捐赠者出示的凭证是 SignedReceipt
+// 能访问节点的校验方也可以调用 verifyDonationReceipt 将回执与账本中的记录比对
+type DigestReceipt struct {
+	Receipt DonationReceipt `json:"receipt"`
+	Digest  string          `json:"digest"` // 规范化回执内容的sha256
+}
+
+// 回执编号由交易ID和捐赠记录的复合键派生
+func receiptID(txID string, donateKey string) string {
+	sum := sha256.Sum256([]byte(txID + donateKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// 交易时间 所有背书节点看到的值一致
+func txTime(stub shim.ChaincodeStubInterface) (string, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("获取交易时间失败")
+	}
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC().Format(time.RFC3339), nil
+}
+
+// 生成并写入捐赠回执 返回回执编号
+func putDonationReceipt(stub shim.ChaincodeStubInterface, applicationNumber string, donateCounter int, donateKey string, donation Donation, identity DonorIdentity) (string, error) {
+	mspID, err := submitterMSP(stub)
+	if err != nil {
+		return "", err
+	}
+
+	receipt := DonationReceipt{
+		ReceiptID:         receiptID(donation.TxID, donateKey),
+		ApplicationNumber: applicationNumber,
+		DonateCounter:     donateCounter,
+		Amount:            donation.Amount,
+		Time:              donation.Time,
+		TxID:              donation.TxID,
+		SubmitterMSP:      mspID,
+	}
+	// 匿名捐赠的回执不包含平台ID的哈希 否则同一捐赠者的匿名捐赠可以通过回执关联
+	if identity.Privacy != PrivacyAnonymous {
+		receipt.PlatformIDHash = saltedHash(identity.Salt, identity.PlatformID)
+	}
+
+	digested, err := digestReceipt(receipt)
+	if err != nil {
+		return "", err
+	}
+
+	receiptKey, err := stub.CreateCompositeKey(receiptObjectType, []string{receipt.ReceiptID})
+	if err != nil {
+		return "", fmt.Errorf("创建回执键失败 %s", receipt.ReceiptID)
+	}
+
+	digestedAsBytes, err := json.Marshal(digested)
+	if err != nil {
+		return "", fmt.Errorf("无法将回执转换为Json字符串")
+	}
+
+	err = stub.PutState(receiptKey, digestedAsBytes)
+	if err != nil {
+		return "", fmt.Errorf("回执写入账本失败")
+	}
+
+	return receipt.ReceiptID, nil
+}
+
+func digestReceipt(receipt DonationReceipt) (DigestReceipt, error) {
+	canonical, err := json.Marshal(receipt)
+	if err != nil {
+		return DigestReceipt{}, fmt.Errorf("无法将回执转换为Json字符串")
+	}
+
+	sum := sha256.Sum256(canonical)
+	return DigestReceipt{Receipt: receipt, Digest: hex.EncodeToString(sum[:])}, nil
+}
+
+func getDigestReceipt(stub shim.ChaincodeStubInterface, id string) (DigestReceipt, error) {
+	digested := DigestReceipt{}
+
+	receiptKey, err := stub.CreateCompositeKey(receiptObjectType, []string{id})
+	if err != nil {
+		return digested, fmt.Errorf("创建回执键失败 %s", id)
+	}
+
+	digestedAsBytes, err := stub.GetState(receiptKey)
+	if err != nil {
+		return digested, fmt.Errorf("获取回执失败 %s", id)
+	}
+	if digestedAsBytes == nil {
+		return digested, fmt.Errorf("未找到此回执 %s", id)
+	}
+
+	err = json.Unmarshal(digestedAsBytes, &digested)
+	if err != nil {
+		return digested, fmt.Errorf("回执json串转换为回执对象失败")
+	}
+
+	return digested, nil
+}
+
+// 查询捐赠回执
+// 入参列表
+//
+//	receipt_id 回执编号 捐赠成功时返回
+//
+// 范例 ["query", "getDonationReceipt", "5f2b...e1"]
+func getDonationReceipt(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	digested, err := getDigestReceipt(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	digestedAsBytes, err := json.Marshal(digested)
+	if err != nil {
+		return "", fmt.Errorf("无法将回执转换为Json字符串")
+	}
+
+	return string(digestedAsBytes), nil
+}
+
+// 校验捐赠回执 任何人都可以调用
+// 重新计算回执内容的摘要 并与账本中记录的摘要比对 结果只在查询的节点可信时可信
+// 入参列表
+//
+//	receipt 回执 json string 即 getDonationReceipt 的返回值
+//	platform_id 捐赠者平台ID 可选 传入时同时校验其哈希 匿名捐赠的回执没有哈希 传入时校验不通过
+//	salt 捐赠时使用的盐 可选 非公开模式的捐赠需要传入
+//
+// 范例 ["query", "verifyDonationReceipt", "{\"receipt\":{...},\"digest\":\"...\"}", "platformid008"]
+// 返回 true 或 false
+func verifyDonationReceipt(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 1, 3)
+	if err != nil {
+		return "", err
+	}
+
+	presented := DigestReceipt{}
+	err = json.Unmarshal([]byte(args[0]), &presented)
+	if err != nil {
+		return "", fmt.Errorf("无法将回执转换为回执对象 %s", args[0])
+	}
+
+	recorded, err := getDigestReceipt(stub, presented.Receipt.ReceiptID)
+	if err != nil {
+		return "", err
+	}
+
+	recomputed, err := digestReceipt(presented.Receipt)
+	if err != nil {
+		return "", err
+	}
+
+	valid := recomputed.Digest == presented.Digest && recomputed.Digest == recorded.Digest
+	if valid && len(args) >= 2 {
+		valid = saltedHash(params.Optional(args, 2, ""), args[1]) == recorded.Receipt.PlatformIDHash
+	}
+
+	if valid {
+		return "true", nil
+	}
+	return "false", nil
+}
+
+// 签名回执 捐赠者可以离线出示 校验方不需要访问节点
+// 链码背书时还不知道区块号和背书签名 捐赠交易提交之后由网关从区块中取出交易信封生成
+// 信封中背书节点的签名覆盖交易的写集 写集中包含账本记录的摘要回执 参考 VerifySignedReceipt
+type SignedReceipt struct {
+	DigestReceipt
+	BlockNumber uint64 `json:"block_number"` // 捐赠交易所在的区块号
+	Envelope    []byte `json:"envelope"`     // 捐赠交易的信封 protobuf 编码 json中为base64
+}
+
+// 生成签名回执 envelope 为区块中捐赠交易的信封 chaincode 为 Sxc 部署时的链码名称
+// 生成时只校验信封中的交易写入了此回执 背书者的身份由校验方用信任的根证书确认 参考 VerifySignedReceipt
+func NewSignedReceipt(digested DigestReceipt, blockNumber uint64, envelope []byte, chaincode string) (SignedReceipt, error) {
+	signed := SignedReceipt{DigestReceipt: digested, BlockNumber: blockNumber, Envelope: envelope}
+	_, err := endorsedAction(signed, chaincode)
+	if err != nil {
+		return SignedReceipt{}, err
+	}
+	return signed, nil
+}
+
+// 校验签名回执 返回为回执背书的组织 校验方需要确认这些组织满足链码的背书策略
+// 入参列表
+//
+//	signed 签名回执
+//	chaincode Sxc 部署时的链码名称 只接受此链码写入的回执
+//	roots 背书组织的根证书 不能为空 否则任何人都可以用自签名证书冒充背书组织
+//
+// 校验的内容
+//
+//	回执内容的摘要与回执中的摘要一致
+//	信封是回执中 tx_id 的背书交易
+//	每个背书者的证书都由信任的根证书签发 背书签名由证书中的公钥签署
+//	背书签名覆盖的写集中 链码命名空间下回执键的值就是此回执
+//
+// 区块号只用于查找交易 交易是否在该区块中有效需要向任一节点或者排序节点签名的区块确认
+func VerifySignedReceipt(signed SignedReceipt, chaincode string, roots *x509.CertPool) ([]string, error) {
+	if roots == nil {
+		return nil, fmt.Errorf("需要背书组织的根证书才能校验签名回执")
+	}
+
+	action, err := endorsedAction(signed, chaincode)
+	if err != nil {
+		return nil, err
+	}
+	if len(action.Endorsements) == 0 {
+		return nil, fmt.Errorf("交易没有背书签名")
+	}
+
+	endorsers := []string{}
+	for _, endorsement := range action.Endorsements {
+		mspID, err := verifyEndorsement(action.ProposalResponsePayload, endorsement, roots)
+		if err != nil {
+			return nil, err
+		}
+		endorsers = append(endorsers, mspID)
+	}
+
+	return endorsers, nil
+}
+
+// 取出签名回执中的背书交易 并校验交易在链码的写集中写入了此回执 不校验背书签名
+func endorsedAction(signed SignedReceipt, chaincode string) (*peer.ChaincodeEndorsedAction, error) {
+	if chaincode == "" {
+		return nil, fmt.Errorf("需要指定链码名称")
+	}
+
+	recomputed, err := digestReceipt(signed.Receipt)
+	if err != nil {
+		return nil, err
+	}
+	if recomputed.Digest != signed.Digest {
+		return nil, fmt.Errorf("回执内容与摘要不一致")
+	}
+
+	envelope := &common.Envelope{}
+	err = proto.Unmarshal(signed.Envelope, envelope)
+	if err != nil {
+		return nil, fmt.Errorf("交易信封格式错误")
+	}
+	payload := &common.Payload{}
+	err = proto.Unmarshal(envelope.Payload, payload)
+	if err != nil || payload.Header == nil {
+		return nil, fmt.Errorf("交易信封格式错误")
+	}
+	channelHeader := &common.ChannelHeader{}
+	err = proto.Unmarshal(payload.Header.ChannelHeader, channelHeader)
+	if err != nil {
+		return nil, fmt.Errorf("交易信封格式错误")
+	}
+	if channelHeader.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		return nil, fmt.Errorf("信封不是背书交易")
+	}
+	if channelHeader.TxId != signed.Receipt.TxID {
+		return nil, fmt.Errorf("信封的交易ID %s 与回执不一致 %s", channelHeader.TxId, signed.Receipt.TxID)
+	}
+
+	transaction := &peer.Transaction{}
+	err = proto.Unmarshal(payload.Data, transaction)
+	if err != nil || len(transaction.Actions) == 0 {
+		return nil, fmt.Errorf("交易格式错误")
+	}
+	actionPayload := &peer.ChaincodeActionPayload{}
+	err = proto.Unmarshal(transaction.Actions[0].Payload, actionPayload)
+	if err != nil || actionPayload.Action == nil {
+		return nil, fmt.Errorf("交易格式错误")
+	}
+	action := actionPayload.Action
+
+	recorded, err := receiptInProposalResponse(action.ProposalResponsePayload, chaincode, signed.Receipt.ReceiptID)
+	if err != nil {
+		return nil, err
+	}
+	if recorded.Digest != signed.Digest {
+		return nil, fmt.Errorf("交易写入的回执与出示的回执不一致")
+	}
+
+	return action, nil
+}
+
+// 校验一个背书签名 返回背书者的MSP ID
+// 背书者对 ProposalResponsePayload 与自己的身份拼接后的内容签名
+func verifyEndorsement(responsePayload []byte, endorsement *peer.Endorsement, roots *x509.CertPool) (string, error) {
+	identity := &msp.SerializedIdentity{}
+	err := proto.Unmarshal(endorsement.Endorser, identity)
+	if err != nil {
+		return "", fmt.Errorf("背书者身份格式错误")
+	}
+
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return "", fmt.Errorf("背书者证书格式错误 %s", identity.Mspid)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("背书者证书格式错误 %s", identity.Mspid)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	if err != nil {
+		return "", fmt.Errorf("背书者证书不是由信任的根证书签发 %s", identity.Mspid)
+	}
+
+	signed := append(append([]byte{}, responsePayload...), endorsement.Endorser...)
+	digest := sha256.Sum256(signed)
+
+	valid := false
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], endorsement.Signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, signed, endorsement.Signature)
+	default:
+		return "", fmt.Errorf("不支持的背书者公钥类型 %s", identity.Mspid)
+	}
+	if !valid {
+		return "", fmt.Errorf("背书签名校验失败 %s", identity.Mspid)
+	}
+
+	return identity.Mspid, nil
+}
+
+// 从背书结果中链码命名空间的写集中取出回执 其他链码写入的同名键不算
+func receiptInProposalResponse(responsePayload []byte, chaincode string, id string) (DigestReceipt, error) {
+	digested := DigestReceipt{}
+
+	response := &peer.ProposalResponsePayload{}
+	err := proto.Unmarshal(responsePayload, response)
+	if err != nil {
+		return digested, fmt.Errorf("背书结果格式错误")
+	}
+	chaincodeAction := &peer.ChaincodeAction{}
+	err = proto.Unmarshal(response.Extension, chaincodeAction)
+	if err != nil {
+		return digested, fmt.Errorf("背书结果格式错误")
+	}
+	readWriteSet := &rwset.TxReadWriteSet{}
+	err = proto.Unmarshal(chaincodeAction.Results, readWriteSet)
+	if err != nil {
+		return digested, fmt.Errorf("交易读写集格式错误")
+	}
+
+	// 与 CreateCompositeKey 的结果一致
+	receiptKey := compositeKeyNamespace + receiptObjectType + compositeKeyNamespace + id + compositeKeyNamespace
+	for _, namespace := range readWriteSet.NsRwset {
+		if namespace.Namespace != chaincode {
+			continue
+		}
+		kvSet := &kvrwset.KVRWSet{}
+		err = proto.Unmarshal(namespace.Rwset, kvSet)
+		if err != nil {
+			return digested, fmt.Errorf("交易读写集格式错误")
+		}
+
+		for _, write := range kvSet.Writes {
+			if write.Key != receiptKey || write.IsDelete {
+				continue
+			}
+			err = json.Unmarshal(write.Value, &digested)
+			if err != nil {
+				return digested, fmt.Errorf("回执json串转换为回执对象失败")
+			}
+			return digested, nil
+		}
+	}
+
+	return digested, fmt.Errorf("交易没有写入此回执 %s", id)
+}
@@ -0,0 +1,304 @@
+package sxc_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ForLina/sxc_contract/scenario"
+	"github.com/ForLina/sxc_contract/sxc"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// 背书节点 证书由 ca 签发
+type endorser struct {
+	key      *ecdsa.PrivateKey
+	identity []byte
+	ca       *x509.Certificate
+}
+
+func newEndorser(t *testing.T, mspID string) endorser {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca." + mspID},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caAsBytes, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caAsBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "peer0." + mspID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certAsBytes, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certAsBytes}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return endorser{key: key, identity: identity, ca: ca}
+}
+
+func (e endorser) endorse(t *testing.T, responsePayload []byte) *peer.Endorsement {
+	t.Helper()
+
+	digest := sha256.Sum256(append(append([]byte{}, responsePayload...), e.identity...))
+	signature, err := ecdsa.SignASN1(rand.Reader, e.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &peer.Endorsement{Endorser: e.identity, Signature: signature}
+}
+
+// 在模拟账本上捐赠 返回账本中记录的回执
+func donationReceipt(t *testing.T) sxc.DigestReceipt {
+	t.Helper()
+
+	creator, err := scenario.NewIdentity("Org1MSP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := shimtest.NewMockStub("sxc", new(sxc.Sxc))
+	stub.Creator = creator
+
+	stub.MockInit("tx1", [][]byte{[]byte("init"), []byte(`["Org1MSP"]`)})
+	calls := [][]string{
+		{"applicate", "1", "lyx", "500222199009214433", "995", "3", "8876", "9988123519", "abcdabcdabcdabcdabcdabcdabcdabcd", "1000"},
+		{"hVerify", "1", "op", "1", "800", "[]"},
+		{"donate", "1", "zhangsan", "100", "sn1", "platform1"},
+	}
+	var receiptID string
+	for i, call := range calls {
+		args := [][]byte{}
+		for _, arg := range call {
+			args = append(args, []byte(arg))
+		}
+		response := stub.MockInvoke(fmt.Sprintf("tx%d", i+2), args)
+		if response.Status != 200 {
+			t.Fatalf("%s: %s", call[0], response.Message)
+		}
+		scenario.DrainEvents(stub)
+		receiptID = string(response.Payload)
+	}
+
+	response := stub.MockInvoke("tx5", [][]byte{[]byte("getDonationReceipt"), []byte(receiptID)})
+	if response.Status != 200 {
+		t.Fatal(response.Message)
+	}
+	digested := sxc.DigestReceipt{}
+	err = json.Unmarshal(response.Payload, &digested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digested
+}
+
+// 生成写入回执的捐赠交易信封 namespace 为写集所属的链码 value 为回执键写入的值
+func receiptEnvelope(t *testing.T, namespace string, txID string, receiptID string, value []byte, endorsers ...endorser) []byte {
+	t.Helper()
+
+	kvSet, err := proto.Marshal(&kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{
+		{Key: "\x00receipt\x00" + receiptID + "\x00", Value: value},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := proto.Marshal(&rwset.TxReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsRwset:   []*rwset.NsReadWriteSet{{Namespace: namespace, Rwset: kvSet}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extension, err := proto.Marshal(&peer.ChaincodeAction{Results: results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responsePayload, err := proto.Marshal(&peer.ProposalResponsePayload{Extension: extension})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endorsements := []*peer.Endorsement{}
+	for _, e := range endorsers {
+		endorsements = append(endorsements, e.endorse(t, responsePayload))
+	}
+	actionPayload, err := proto.Marshal(&peer.ChaincodeActionPayload{Action: &peer.ChaincodeEndorsedAction{
+		ProposalResponsePayload: responsePayload,
+		Endorsements:            endorsements,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction, err := proto.Marshal(&peer.Transaction{Actions: []*peer.TransactionAction{{Payload: actionPayload}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_ENDORSER_TRANSACTION), TxId: txID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}, Data: transaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := proto.Marshal(&common.Envelope{Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func TestVerifySignedReceipt(t *testing.T) {
+	digested := donationReceipt(t)
+	recorded, err := json.Marshal(digested)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	org1 := newEndorser(t, "Org1MSP")
+	org2 := newEndorser(t, "Org2MSP")
+	roots := x509.NewCertPool()
+	roots.AddCert(org1.ca)
+	roots.AddCert(org2.ca)
+
+	envelope := receiptEnvelope(t, "sxc", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded, org1, org2)
+
+	tampered := digested
+	tampered.Receipt.Amount = 1000
+	// 使用 Org1MSP 的私钥 冒充 Org2MSP 背书
+	impostor := org1
+	impostor.identity = org2.identity
+
+	tests := []struct {
+		name     string
+		receipt  sxc.DigestReceipt
+		envelope []byte
+		roots    *x509.CertPool
+		want     []string
+		error    string
+	}{
+		{"校验签名和证书链", digested, envelope, roots, []string{"Org1MSP", "Org2MSP"}, ""},
+		{"没有根证书", digested, envelope, nil, nil, "需要背书组织的根证书才能校验签名回执"},
+		{"证书不是由信任的根证书签发", digested, envelope, x509.NewCertPool(), nil, "背书者证书不是由信任的根证书签发 Org1MSP"},
+		{"自签名证书冒充背书组织", digested, receiptEnvelope(t, "sxc", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded, newEndorser(t, "Org1MSP")), roots, nil, "背书者证书不是由信任的根证书签发 Org1MSP"},
+		{"回执内容被修改", tampered, envelope, roots, nil, "回执内容与摘要不一致"},
+		{"信封属于其他交易", digested, receiptEnvelope(t, "sxc", "other", digested.Receipt.ReceiptID, recorded, org1), roots, nil, "与回执不一致"},
+		{"交易没有背书", digested, receiptEnvelope(t, "sxc", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded), roots, nil, "交易没有背书签名"},
+		{"背书者与签名不匹配", digested, receiptEnvelope(t, "sxc", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded, impostor), roots, nil, "背书签名校验失败 Org2MSP"},
+		{"交易没有写入回执", digested, receiptEnvelope(t, "sxc", digested.Receipt.TxID, "other", recorded, org1), roots, nil, "交易没有写入此回执"},
+		{"回执由其他链码写入", digested, receiptEnvelope(t, "other", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded, org1), roots, nil, "交易没有写入此回执"},
+		{"交易写入的回执不同", digested, receiptEnvelope(t, "sxc", digested.Receipt.TxID, digested.Receipt.ReceiptID, []byte(`{"digest":"x"}`), org1), roots, nil, "交易写入的回执与出示的回执不一致"},
+		{"信封格式错误", digested, []byte("x"), roots, nil, "交易信封格式错误"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := sxc.SignedReceipt{DigestReceipt: tt.receipt, BlockNumber: 7, Envelope: tt.envelope}
+
+			// 经过json传递之后仍然可以校验
+			signedAsBytes, err := json.Marshal(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			presented := sxc.SignedReceipt{}
+			err = json.Unmarshal(signedAsBytes, &presented)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			endorsers, err := sxc.VerifySignedReceipt(presented, "sxc", tt.roots)
+			if tt.error != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.error) {
+					t.Fatalf("err = %v, want %q", err, tt.error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(endorsers, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("endorsers = %v, want %v", endorsers, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSignedReceipt(t *testing.T) {
+	digested := donationReceipt(t)
+	recorded, err := json.Marshal(digested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	org1 := newEndorser(t, "Org1MSP")
+
+	tests := []struct {
+		name      string
+		envelope  []byte
+		chaincode string
+		error     string
+	}{
+		{"写入回执的交易", receiptEnvelope(t, "sxc", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded, org1), "sxc", ""},
+		{"回执由其他链码写入", receiptEnvelope(t, "other", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded, org1), "sxc", "交易没有写入此回执"},
+		{"没有指定链码名称", receiptEnvelope(t, "sxc", digested.Receipt.TxID, digested.Receipt.ReceiptID, recorded, org1), "", "需要指定链码名称"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sxc.NewSignedReceipt(digested, 7, tt.envelope, tt.chaincode)
+			if tt.error == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.error != "" && (err == nil || !strings.Contains(err.Error(), tt.error)) {
+				t.Fatalf("err = %v, want %q", err, tt.error)
+			}
+		})
+	}
+}
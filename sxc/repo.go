@@ -0,0 +1,217 @@
+package sxc
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 申请的存取
+type ApplicationRepo interface {
+	// 读取申请 不存在时返回错误
+	Get(applicationNumber string) (Application, error)
+	// 申请是否存在
+	Exists(applicationNumber string) (bool, error)
+	// 写入申请 同时设置文档版本
+	Put(application Application) error
+}
+
+// 捐赠记录的存取 计数器从1开始
+type DonationRepo interface {
+	Put(applicationNumber string, counter int, donation Donation) error
+	// 按计数器顺序返回申请下的全部捐赠记录
+	List(applicationNumber string) ([]Donation, error)
+}
+
+// 贷款记录的存取 计数器从1开始
+type LoanRepo interface {
+	// 读取贷款 不存在时返回错误
+	Get(applicationNumber string, counter int) (LoanInfo, error)
+	Put(applicationNumber string, counter int, loanInfo LoanInfo) error
+	// 按计数器顺序返回申请下的全部贷款记录
+	List(applicationNumber string) ([]LoanInfo, error)
+}
+
+// 充值记录的存取 计数器从1开始
+type RechargeRepo interface {
+	Put(applicationNumber string, counter int, recharge RechargeHistory) error
+	// 按计数器顺序返回申请下的全部充值记录
+	List(applicationNumber string) ([]RechargeHistory, error)
+}
+
+// 贷款覆盖策略与银行贷款敞口的存取
+type CoverageRepo interface {
+	// 读取覆盖策略 未配置时返回默认策略
+	Policy() (CoveragePolicy, error)
+	// 银行在所有申请上还没有释放的贷款总额
+	BankExposure(bank string) (float64, error)
+	// 记录一笔贷款占用的银行敞口 bank 为空时忽略
+	PutLoanExposure(bank string, applicationNumber string, counter int, amount float64) error
+	// 释放一笔贷款占用的银行敞口 bank 为空或者没有记录时忽略
+	ReleaseLoanExposure(bank string, applicationNumber string, counter int) error
+}
+
+// 业务函数依赖的全部存储
+type Ledger struct {
+	Applications ApplicationRepo
+	Donations    DonationRepo
+	Loans        LoanRepo
+	Recharges    RechargeRepo
+	Coverage     CoverageRepo
+}
+
+// 基于链码 stub 的存储 与账本中已有的键和文档格式一致
+func NewStubLedger(stub shim.ChaincodeStubInterface) Ledger {
+	return Ledger{
+		Applications: stubApplications{stub},
+		Donations:    stubDonations{stub},
+		Loans:        stubLoans{stub},
+		Recharges:    stubRecharges{stub},
+		Coverage:     stubCoverage{stub},
+	}
+}
+
+type stubApplications struct {
+	stub shim.ChaincodeStubInterface
+}
+
+func (r stubApplications) Get(applicationNumber string) (Application, error) {
+	return getApplication(r.stub, applicationNumber)
+}
+
+func (r stubApplications) Exists(applicationNumber string) (bool, error) {
+	applicationAsBytes, err := r.stub.GetState(applicationNumber)
+	if err != nil {
+		return false, fmt.Errorf("获取账本状态失败 %s", applicationNumber)
+	}
+	return applicationAsBytes != nil, nil
+}
+
+func (r stubApplications) Put(application Application) error {
+	_, err := write(r.stub, application)
+	return err
+}
+
+type stubDonations struct {
+	stub shim.ChaincodeStubInterface
+}
+
+func (r stubDonations) Put(applicationNumber string, counter int, donation Donation) error {
+	key, err := donationKey(r.stub, applicationNumber, strconv.Itoa(counter))
+	if err != nil {
+		return err
+	}
+
+	donation.SchemaVersion = schemaVersion(donationDocType)
+	err = state.PutJSON(r.stub, key, donation)
+	if err != nil {
+		return fmt.Errorf("捐赠历史写入账本失败")
+	}
+	return nil
+}
+
+func (r stubDonations) List(applicationNumber string) ([]Donation, error) {
+	records, err := getSubRecords(r.stub, donationObjectType, applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	donations := []Donation{}
+	for _, record := range records {
+		donation := Donation{}
+		err = decodeDocument(donationDocType, record.Value, &donation)
+		if err != nil {
+			return nil, fmt.Errorf("捐赠记录json串转换为捐赠记录对象失败")
+		}
+		donations = append(donations, donation)
+	}
+	return donations, nil
+}
+
+type stubLoans struct {
+	stub shim.ChaincodeStubInterface
+}
+
+func (r stubLoans) Get(applicationNumber string, counter int) (LoanInfo, error) {
+	return getLoanInfo(r.stub, applicationNumber, strconv.Itoa(counter))
+}
+
+func (r stubLoans) Put(applicationNumber string, counter int, loanInfo LoanInfo) error {
+	return setLoanInfo(r.stub, applicationNumber, strconv.Itoa(counter), loanInfo)
+}
+
+func (r stubLoans) List(applicationNumber string) ([]LoanInfo, error) {
+	records, err := getSubRecords(r.stub, loanObjectType, applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	loans := []LoanInfo{}
+	for _, record := range records {
+		loanInfo := LoanInfo{}
+		err = decodeDocument(loanDocType, record.Value, &loanInfo)
+		if err != nil {
+			return nil, fmt.Errorf("贷款信息json串转换为贷款信息对象失败")
+		}
+		loans = append(loans, loanInfo)
+	}
+	return loans, nil
+}
+
+type stubRecharges struct {
+	stub shim.ChaincodeStubInterface
+}
+
+func (r stubRecharges) Put(applicationNumber string, counter int, recharge RechargeHistory) error {
+	key, err := rechargeKey(r.stub, applicationNumber, strconv.Itoa(counter))
+	if err != nil {
+		return err
+	}
+
+	recharge.SchemaVersion = schemaVersion(rechargeDocType)
+	err = state.PutJSON(r.stub, key, recharge)
+	if err != nil {
+		return fmt.Errorf("充值历史写入账本失败")
+	}
+	return nil
+}
+
+func (r stubRecharges) List(applicationNumber string) ([]RechargeHistory, error) {
+	records, err := getSubRecords(r.stub, rechargeObjectType, applicationNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	recharges := []RechargeHistory{}
+	for _, record := range records {
+		recharge := RechargeHistory{}
+		err = decodeDocument(rechargeDocType, record.Value, &recharge)
+		if err != nil {
+			return nil, fmt.Errorf("充值记录json串转换为充值记录对象失败")
+		}
+		recharges = append(recharges, recharge)
+	}
+	return recharges, nil
+}
+
+type stubCoverage struct {
+	stub shim.ChaincodeStubInterface
+}
+
+func (r stubCoverage) Policy() (CoveragePolicy, error) {
+	return getCoveragePolicyConfig(r.stub)
+}
+
+func (r stubCoverage) BankExposure(bank string) (float64, error) {
+	return getBankExposure(r.stub, bank)
+}
+
+func (r stubCoverage) PutLoanExposure(bank string, applicationNumber string, counter int, amount float64) error {
+	return putLoanExposure(r.stub, bank, applicationNumber, counter, amount)
+}
+
+func (r stubCoverage) ReleaseLoanExposure(bank string, applicationNumber string, counter int) error {
+	return deleteLoanExposure(r.stub, bank, applicationNumber, counter)
+}
@@ -0,0 +1,282 @@
+package sxc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 资金流水的类型
+const (
+	FlowDonation     = "donation"     // 捐赠
+	FlowLoan         = "loan"         // 签订贷款
+	FlowDisbursement = "disbursement" // 银行放款
+	FlowRecharge     = "recharge"     // 充值到就诊卡
+	FlowRepayment    = "repayment"    // 为用户偿还贷款
+)
+
+// 金额比较的容差
+const amountTolerance = 1e-6
+
+// 一条资金流水 字段都是标量 可以直接转换为csv的一行
+type FundFlowRow struct {
+	Type         string  `json:"type"`          // 流水类型
+	Counter      int     `json:"counter"`       // 对应记录的计数器
+	Amount       float64 `json:"amount"`        // 金额 还款记录只有流水号时为0
+	SerialNumber string  `json:"serial_number"` // 业务流水号
+	Reference    string  `json:"reference"`     // 关联信息 捐赠者/贷款单号
+	Time         string  `json:"time"`          // 交易时间 只有捐赠记录有
+}
+
+// 资金汇总
+type FundFlowSummary struct {
+	DonationCount    int     `json:"donation_count"`    // 捐赠记录数
+	DonationSum      float64 `json:"donation_sum"`      // 捐赠记录金额合计
+	AmountRaised     float64 `json:"amount_raised"`     // 申请中记录的募集金额
+	LoanCount        int     `json:"loan_count"`        // 贷款记录数
+	LoanSum          float64 `json:"loan_sum"`          // 贷款记录金额合计
+	DisbursedSum     float64 `json:"disbursed_sum"`     // 已放款的贷款金额合计
+	RechargeCount    int     `json:"recharge_count"`    // 充值记录数
+	RechargeSum      float64 `json:"recharge_sum"`      // 充值记录金额合计
+	RechargeTotal    float64 `json:"recharge_total"`    // 申请中记录的累计充值金额
+	RepaymentCount   int     `json:"repayment_count"`   // 还款次数
+	Balance          float64 `json:"balance"`           // 申请中记录的合约余额
+	AvailableBalance float64 `json:"available_balance"` // 按记录计算的可用资金 捐赠+放款-充值
+}
+
+// 资金使用报告
+type FundFlowReport struct {
+	ApplicationNumber string          `json:"application_number"`
+	State             int             `json:"state"`
+	Summary           FundFlowSummary `json:"summary"`
+	Discrepancies     []string        `json:"discrepancies"` // 汇总字段与明细记录不一致的说明
+	Rows              []FundFlowRow   `json:"rows"`
+}
+
+// 查询申请的资金使用报告
+// 入参列表
+//
+//	application_number 合约编号
+//	format 输出格式 可选 json/csv 默认 json
+//
+// 范例 ["query", "getFundFlowReport", "1"]
+// 范例 ["query", "getFundFlowReport", "1", "csv"] csv在流水之后有 summary 和 discrepancy 行
+func getFundFlowReport(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 1, 2)
+	if err != nil {
+		return "", err
+	}
+
+	format := params.Optional(args, 1, "json")
+	if format != "json" && format != "csv" {
+		return "", fmt.Errorf("输出格式参数错误 %s", format)
+	}
+
+	report, err := buildFundFlowReport(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	if format == "csv" {
+		return fundFlowCSV(report)
+	}
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("无法将资金报告转换为Json字符串")
+	}
+
+	return string(reportAsBytes), nil
+}
+
+func buildFundFlowReport(stub shim.ChaincodeStubInterface, applicationNumber string) (FundFlowReport, error) {
+	report := FundFlowReport{ApplicationNumber: applicationNumber, Discrepancies: []string{}, Rows: []FundFlowRow{}}
+
+	application, err := getApplication(stub, applicationNumber)
+	if err != nil {
+		return report, err
+	}
+	report.State = application.State
+
+	summary := FundFlowSummary{
+		AmountRaised:  application.AmountRaised,
+		RechargeTotal: application.RechargeTotal,
+		Balance:       application.Balance,
+	}
+
+	donations, err := getSubRecords(stub, donationObjectType, applicationNumber)
+	if err != nil {
+		return report, err
+	}
+	for _, record := range donations {
+		donation := Donation{}
+		err = decodeDocument(donationDocType, record.Value, &donation)
+		if err != nil {
+			return report, fmt.Errorf("捐赠记录json串转换为捐赠记录对象失败")
+		}
+
+		summary.DonationCount++
+		summary.DonationSum += donation.Amount
+		report.Rows = append(report.Rows, FundFlowRow{
+			Type:         FlowDonation,
+			Counter:      record.Counter,
+			Amount:       donation.Amount,
+			SerialNumber: donation.SerialNumber,
+			Reference:    donation.Donator,
+			Time:         donation.Time,
+		})
+	}
+
+	loans, err := getSubRecords(stub, loanObjectType, applicationNumber)
+	if err != nil {
+		return report, err
+	}
+	for _, record := range loans {
+		loanInfo := LoanInfo{}
+		err = decodeDocument(loanDocType, record.Value, &loanInfo)
+		if err != nil {
+			return report, fmt.Errorf("贷款信息json串转换为贷款信息对象失败")
+		}
+
+		summary.LoanCount++
+		summary.LoanSum += loanInfo.LoanAmount
+		report.Rows = append(report.Rows, FundFlowRow{
+			Type:      FlowLoan,
+			Counter:   record.Counter,
+			Amount:    loanInfo.LoanAmount,
+			Reference: loanInfo.LoanNumber,
+		})
+
+		if loanInfo.MoneyReceived {
+			summary.DisbursedSum += loanInfo.LoanAmount
+			report.Rows = append(report.Rows, FundFlowRow{
+				Type:         FlowDisbursement,
+				Counter:      record.Counter,
+				Amount:       loanInfo.LoanAmount,
+				SerialNumber: loanInfo.ReceiveSerialNumber,
+				Reference:    loanInfo.LoanNumber,
+			})
+		}
+
+		var repayments []string
+		if loanInfo.RepaymentHistory != "" {
+			err = json.Unmarshal([]byte(loanInfo.RepaymentHistory), &repayments)
+			if err != nil {
+				return report, fmt.Errorf("无法将还款历史转换为数组 %s", loanInfo.LoanNumber)
+			}
+		}
+		for _, serialNumber := range repayments {
+			summary.RepaymentCount++
+			report.Rows = append(report.Rows, FundFlowRow{
+				Type:         FlowRepayment,
+				Counter:      record.Counter,
+				SerialNumber: serialNumber,
+				Reference:    loanInfo.LoanNumber,
+			})
+		}
+	}
+
+	recharges, err := getSubRecords(stub, rechargeObjectType, applicationNumber)
+	if err != nil {
+		return report, err
+	}
+	for _, record := range recharges {
+		rechargeHistory := RechargeHistory{}
+		err = decodeDocument(rechargeDocType, record.Value, &rechargeHistory)
+		if err != nil {
+			return report, fmt.Errorf("充值记录json串转换为充值记录对象失败")
+		}
+
+		summary.RechargeCount++
+		summary.RechargeSum += rechargeHistory.Amount
+		report.Rows = append(report.Rows, FundFlowRow{
+			Type:         FlowRecharge,
+			Counter:      record.Counter,
+			Amount:       rechargeHistory.Amount,
+			SerialNumber: rechargeHistory.SerialNumber,
+		})
+	}
+
+	summary.AvailableBalance = summary.DonationSum + summary.DisbursedSum - summary.RechargeSum
+	report.Summary = summary
+
+	if math.Abs(summary.AmountRaised-summary.DonationSum) > amountTolerance {
+		report.Discrepancies = append(report.Discrepancies,
+			fmt.Sprintf("募集金额 %v 与捐赠记录合计 %v 不一致", summary.AmountRaised, summary.DonationSum))
+	}
+	if math.Abs(summary.RechargeTotal-summary.RechargeSum) > amountTolerance {
+		report.Discrepancies = append(report.Discrepancies,
+			fmt.Sprintf("累计充值金额 %v 与充值记录合计 %v 不一致", summary.RechargeTotal, summary.RechargeSum))
+	}
+
+	return report, nil
+}
+
+// csv中流水之外的行的类型 summary 行的 reference 为汇总字段名 amount 为字段值
+// discrepancy 行的 reference 为不一致的说明 使csv与json报告包含相同的信息
+const (
+	csvSummary     = "summary"
+	csvDiscrepancy = "discrepancy"
+)
+
+// 将资金报告转换为csv 第一行为表头 之后依次为流水 汇总和不一致说明
+func fundFlowCSV(report FundFlowReport) (string, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	amount := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	records := [][]string{{"application_number", "type", "counter", "amount", "serial_number", "reference", "time"}}
+	for _, row := range report.Rows {
+		records = append(records, []string{
+			report.ApplicationNumber,
+			row.Type,
+			strconv.Itoa(row.Counter),
+			amount(row.Amount),
+			row.SerialNumber,
+			row.Reference,
+			row.Time,
+		})
+	}
+
+	summary := report.Summary
+	fields := []struct {
+		name  string
+		value float64
+	}{
+		{"state", float64(report.State)},
+		{"donation_count", float64(summary.DonationCount)},
+		{"donation_sum", summary.DonationSum},
+		{"amount_raised", summary.AmountRaised},
+		{"loan_count", float64(summary.LoanCount)},
+		{"loan_sum", summary.LoanSum},
+		{"disbursed_sum", summary.DisbursedSum},
+		{"recharge_count", float64(summary.RechargeCount)},
+		{"recharge_sum", summary.RechargeSum},
+		{"recharge_total", summary.RechargeTotal},
+		{"repayment_count", float64(summary.RepaymentCount)},
+		{"balance", summary.Balance},
+		{"available_balance", summary.AvailableBalance},
+	}
+	for _, field := range fields {
+		records = append(records, []string{report.ApplicationNumber, csvSummary, "0", amount(field.value), "", field.name, ""})
+	}
+	for _, discrepancy := range report.Discrepancies {
+		records = append(records, []string{report.ApplicationNumber, csvDiscrepancy, "0", "0", "", discrepancy, ""})
+	}
+
+	err := writer.WriteAll(records)
+	if err != nil {
+		return "", fmt.Errorf("无法将资金流水转换为csv")
+	}
+
+	return buffer.String(), nil
+}
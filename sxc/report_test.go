@@ -0,0 +1,71 @@
+package sxc
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestFundFlowCSV(t *testing.T) {
+	report := FundFlowReport{
+		ApplicationNumber: "1",
+		State:             3,
+		Summary: FundFlowSummary{
+			DonationCount:    1,
+			DonationSum:      100,
+			AmountRaised:     150,
+			Balance:          150,
+			AvailableBalance: 100,
+		},
+		Discrepancies: []string{"募集金额 150 与捐赠记录合计 100 不一致"},
+		Rows: []FundFlowRow{
+			{Type: FlowDonation, Counter: 1, Amount: 100, SerialNumber: "sn1", Reference: "zhangsan", Time: "2024-03-01T00:00:00Z"},
+		},
+	}
+
+	csvAsString, err := fundFlowCSV(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(csvAsString)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 按 type 和 reference 索引 amount
+	amounts := map[string]string{}
+	for _, record := range records[1:] {
+		if len(record) != len(records[0]) {
+			t.Fatalf("列数 %d 与表头不一致 %v", len(record), record)
+		}
+		amounts[record[1]+"/"+record[5]] = record[3]
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{FlowDonation + "/zhangsan", "100"},
+		{csvSummary + "/state", "3"},
+		{csvSummary + "/donation_count", "1"},
+		{csvSummary + "/donation_sum", "100"},
+		{csvSummary + "/amount_raised", "150"},
+		{csvSummary + "/balance", "150"},
+		{csvSummary + "/available_balance", "100"},
+		{csvDiscrepancy + "/募集金额 150 与捐赠记录合计 100 不一致", "0"},
+	}
+	for _, tt := range tests {
+		got, ok := amounts[tt.key]
+		if !ok {
+			t.Errorf("csv中没有 %s", tt.key)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+
+	if len(records) != 1+len(report.Rows)+13+len(report.Discrepancies) {
+		t.Errorf("csv行数 %d", len(records))
+	}
+}
@@ -0,0 +1,404 @@
+package sxc
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 账本中存储的文档类型
+const (
+	applicationDocType = "application"
+	donationDocType    = "donation"
+	loanDocType        = "loan"
+	rechargeDocType    = "recharge"
+)
+
+// 复合键的前缀
+const compositeKeyNamespace = "\x00"
+
+// 明细记录的文档类型对应的复合键前缀
+var subRecordObjectTypes = map[string]string{
+	donationDocType: donationObjectType,
+	loanDocType:     loanObjectType,
+	rechargeDocType: rechargeObjectType,
+}
+
+// 文档中记录版本号的字段 没有此字段的文档为 0 版本
+const schemaVersionField = "schema_version"
+
+// 一次升级 将文档从 From 版本升级到 From+1 版本
+// Upgrade 直接修改文档 返回修改内容的说明 没有修改时返回空
+type schemaMigration struct {
+	From        int
+	Description string
+	Upgrade     func(doc map[string]interface{}) []string
+}
+
+// 升级注册表 每个文档类型的升级按版本顺序排列
+// 新增字段需要默认值 或者字段含义发生变化时 在对应类型的末尾追加一次升级
+var schemaMigrations = map[string][]schemaMigration{
+	applicationDocType: {
+		{From: 0, Description: "记录版本号 附件列表为空时使用空数组", Upgrade: func(doc map[string]interface{}) []string {
+			var changes []string
+			for _, field := range []string{"application_attachments", "hospital_attachments"} {
+				if doc[field] == nil {
+					doc[field] = []interface{}{}
+					changes = append(changes, field+" 设置为 []")
+				}
+			}
+			return changes
+		}},
+	},
+	donationDocType: {
+		{From: 0, Description: "记录版本号 补充隐私模式", Upgrade: func(doc map[string]interface{}) []string {
+			if _, ok := doc["privacy"]; !ok {
+				doc["privacy"] = PrivacyPublic
+				return []string{"privacy 设置为 " + PrivacyPublic}
+			}
+			return nil
+		}},
+	},
+	loanDocType: {
+		{From: 0, Description: "记录版本号 补充放款银行 还款历史为空时使用空数组", Upgrade: func(doc map[string]interface{}) []string {
+			var changes []string
+			if _, ok := doc["bank"]; !ok {
+				doc["bank"] = ""
+				changes = append(changes, "bank 设置为空")
+			}
+			if history, _ := doc["repayment_history"].(string); history == "" {
+				doc["repayment_history"] = "[]"
+				changes = append(changes, "repayment_history 设置为 []")
+			}
+			return changes
+		}},
+	},
+	rechargeDocType: {
+		{From: 0, Description: "记录版本号", Upgrade: func(doc map[string]interface{}) []string {
+			return nil
+		}},
+	},
+}
+
+// 文档类型的当前版本
+func schemaVersion(docType string) int {
+	return len(schemaMigrations[docType])
+}
+
+// 在内存中将文档升级到当前版本 返回原版本与修改说明
+func upgradeDocument(docType string, doc map[string]interface{}) (int, []string, error) {
+	from := 0
+	if version, ok := doc[schemaVersionField].(float64); ok {
+		from = int(version)
+	}
+
+	current := schemaVersion(docType)
+	if from > current {
+		return from, nil, fmt.Errorf("文档版本 %d 高于合约支持的版本 %d %s", from, current, docType)
+	}
+
+	changes := []string{}
+	for _, migration := range schemaMigrations[docType][from:] {
+		changes = append(changes, migration.Upgrade(doc)...)
+	}
+	if from != current {
+		doc[schemaVersionField] = current
+		changes = append(changes, fmt.Sprintf("%s %d -> %d", schemaVersionField, from, current))
+	}
+
+	return from, changes, nil
+}
+
+// 读取文档 旧版本的文档在内存中升级后再转换为对象
+func decodeDocument(docType string, value []byte, v interface{}) error {
+	doc := map[string]interface{}{}
+	err := json.Unmarshal(value, &doc)
+	if err != nil {
+		return fmt.Errorf("%s json串转换为对象失败", docType)
+	}
+
+	_, _, err = upgradeDocument(docType, doc)
+	if err != nil {
+		return err
+	}
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("无法将 %s 转换为Json字符串", docType)
+	}
+
+	err = json.Unmarshal(upgraded, v)
+	if err != nil {
+		return fmt.Errorf("%s json串转换为对象失败", docType)
+	}
+
+	return nil
+}
+
+// 升级报告中的一条记录
+type MigrationChange struct {
+	Key     string   `json:"key"`                                    // 文档所在的键 复合键中的分隔符保持原样
+	DocType string   `json:"doc_type"`                               // 文档类型
+	From    int      `json:"from"`                                   // 升级前的版本
+	To      int      `json:"to"`                                     // 升级后的版本
+	NewKey  string   `json:"new_key,omitempty" metadata:",optional"` // 旧格式的键迁移后的新键
+	Changes []string `json:"changes"`                                // 修改说明
+	Error   string   `json:"error,omitempty" metadata:",optional"`   // 无法迁移的原因
+}
+
+// 升级报告
+type MigrationReport struct {
+	DryRun    bool              `json:"dry_run"`   // 是否只报告不写入
+	Processed int               `json:"processed"` // 本页处理的键数量
+	Changes   []MigrationChange `json:"changes"`   // 需要修改或已经修改的文档
+	Bookmark  string            `json:"bookmark"`  // 下一页的起始键 为空表示已经全部处理完
+}
+
+// 旧格式的明细记录键 申请编号,计数器
+// 捐赠 贷款 充值记录曾经共用这个键 后写入的记录会覆盖先写入的记录
+var legacySubRecordKey = regexp.MustCompile(`^(.+),([0-9]+)$`)
+
+// 分页升级账本中的文档
+// 升级是普通交易 不能使用只读查询才支持的分页接口 这里按键的范围逐个处理
+// 入参列表
+//
+//	page_size 每页处理的申请数量 0 表示不分页
+//	bookmark 起始键 第一页传空字符串 之后传上一页返回的 bookmark
+//	dry_run 是否只报告不写入 true/false
+//
+// 范例 ["invoke", "migrate", "100", "", "true"]
+func migrate(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 3)
+	if err != nil {
+		return "", err
+	}
+
+	pageSize, err := strconv.Atoi(args[0])
+	if err != nil || pageSize < 0 {
+		return "", fmt.Errorf("无法将每页数量转换为非负整数 %s", args[0])
+	}
+
+	dryRun, err := strconv.ParseBool(args[2])
+	if err != nil {
+		return "", fmt.Errorf("无法将 dry_run 转换为bool类型 %s", args[2])
+	}
+
+	if !dryRun {
+		admin, err := isAdmin(stub)
+		if err != nil {
+			return "", err
+		}
+		if !admin {
+			return "", fmt.Errorf("只有管理员可以升级账本中的文档")
+		}
+	}
+
+	report, err := migratePage(stub, args[1], pageSize, dryRun)
+	if err != nil {
+		return "", err
+	}
+
+	reportAsBytes, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("无法将升级报告转换为Json字符串")
+	}
+
+	return string(reportAsBytes), nil
+}
+
+// 升级合约时在 Init 中一次性升级全部文档
+func migrateAll(stub shim.ChaincodeStubInterface) error {
+	_, err := migratePage(stub, "", 0, false)
+	return err
+}
+
+// 处理一页 范围查询只返回普通键 也就是申请和旧格式的明细记录
+func migratePage(stub shim.ChaincodeStubInterface, bookmark string, pageSize int, dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{DryRun: dryRun, Changes: []MigrationChange{}}
+
+	resultIterator, err := stub.GetStateByRange(bookmark, "")
+	if err != nil {
+		return report, fmt.Errorf("获取账本状态失败")
+	}
+	defer resultIterator.Close()
+
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return report, fmt.Errorf("获取账本状态失败")
+		}
+
+		// 真实的节点不会在范围查询中返回复合键 模拟的 stub 会返回 这里跳过
+		if strings.HasPrefix(queryResult.Key, compositeKeyNamespace) {
+			continue
+		}
+
+		if pageSize > 0 && report.Processed == pageSize {
+			report.Bookmark = queryResult.Key
+			break
+		}
+		report.Processed++
+
+		var changes []MigrationChange
+		matches := legacySubRecordKey.FindStringSubmatch(queryResult.Key)
+		if matches != nil && !isApplicationDocument(queryResult.Key, queryResult.Value) {
+			changes, err = migrateLegacySubRecord(stub, queryResult.Key, queryResult.Value, matches[1], matches[2], dryRun)
+		} else {
+			changes, err = migrateApplication(stub, queryResult.Key, queryResult.Value, dryRun)
+		}
+		if err != nil {
+			return report, err
+		}
+		report.Changes = append(report.Changes, changes...)
+	}
+
+	return report, nil
+}
+
+// 升级申请以及申请下的明细记录
+func migrateApplication(stub shim.ChaincodeStubInterface, key string, value []byte, dryRun bool) ([]MigrationChange, error) {
+	changes := []MigrationChange{}
+
+	change, err := migrateDocument(stub, applicationDocType, key, value, dryRun)
+	if err != nil {
+		return changes, err
+	}
+	if change != nil {
+		changes = append(changes, *change)
+	}
+
+	for _, docType := range []string{donationDocType, loanDocType, rechargeDocType} {
+		records, err := getSubRecords(stub, subRecordObjectTypes[docType], key)
+		if err != nil {
+			return changes, err
+		}
+
+		for _, record := range records {
+			change, err := migrateDocument(stub, docType, record.Key, record.Value, dryRun)
+			if err != nil {
+				return changes, err
+			}
+			if change != nil {
+				changes = append(changes, *change)
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// 将文档升级到当前版本后写回原来的键 已经是当前版本时返回 nil
+func migrateDocument(stub shim.ChaincodeStubInterface, docType string, key string, value []byte, dryRun bool) (*MigrationChange, error) {
+	doc := map[string]interface{}{}
+	err := json.Unmarshal(value, &doc)
+	if err != nil {
+		return &MigrationChange{Key: key, DocType: docType, Error: "无法解析json"}, nil
+	}
+
+	from, changes, err := upgradeDocument(docType, doc)
+	if err != nil {
+		return &MigrationChange{Key: key, DocType: docType, From: from, Error: err.Error()}, nil
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	change := &MigrationChange{Key: key, DocType: docType, From: from, To: schemaVersion(docType), Changes: changes}
+	if dryRun {
+		return change, nil
+	}
+
+	docAsBytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("无法将 %s 转换为Json字符串", docType)
+	}
+
+	err = stub.PutState(key, docAsBytes)
+	if err != nil {
+		return nil, fmt.Errorf("升级后的文档写入账本失败 %s", key)
+	}
+
+	return change, nil
+}
+
+// 将旧格式键下的明细记录迁移到对应类型的复合键下
+// 旧格式的键上只会留下最后写入的记录 根据字段判断记录类型
+func migrateLegacySubRecord(stub shim.ChaincodeStubInterface, key string, value []byte, applicationNumber string, counter string, dryRun bool) ([]MigrationChange, error) {
+	doc := map[string]interface{}{}
+	err := json.Unmarshal(value, &doc)
+	if err != nil {
+		return []MigrationChange{{Key: key, Error: "无法解析json"}}, nil
+	}
+
+	docType := legacyDocType(doc)
+	if docType == "" {
+		return []MigrationChange{{Key: key, Error: "无法判断记录类型"}}, nil
+	}
+
+	newKey, err := subRecordKey(stub, subRecordObjectTypes[docType], applicationNumber, counter)
+	if err != nil {
+		return nil, err
+	}
+
+	from, changes, err := upgradeDocument(docType, doc)
+	change := MigrationChange{Key: key, DocType: docType, From: from, To: schemaVersion(docType), NewKey: newKey, Changes: changes}
+	if err != nil {
+		change.Error = err.Error()
+		return []MigrationChange{change}, nil
+	}
+
+	existing, err := stub.GetState(newKey)
+	if err != nil {
+		return nil, fmt.Errorf("获取账本状态失败 %s", newKey)
+	}
+	if existing != nil {
+		change.Error = "新键下已经存在记录"
+		return []MigrationChange{change}, nil
+	}
+
+	if dryRun {
+		return []MigrationChange{change}, nil
+	}
+
+	docAsBytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("无法将 %s 转换为Json字符串", docType)
+	}
+
+	err = stub.PutState(newKey, docAsBytes)
+	if err != nil {
+		return nil, fmt.Errorf("迁移后的记录写入账本失败 %s", newKey)
+	}
+
+	err = stub.DelState(key)
+	if err != nil {
+		return nil, fmt.Errorf("删除旧格式的记录失败 %s", key)
+	}
+
+	return []MigrationChange{change}, nil
+}
+
+// 申请编号本身也可能是 xxx,1 的形式 以文档内容为准
+func isApplicationDocument(key string, value []byte) bool {
+	application := Application{}
+	err := json.Unmarshal(value, &application)
+	return err == nil && application.ApplicationNumber == key
+}
+
+func legacyDocType(doc map[string]interface{}) string {
+	if _, ok := doc["loan_number"]; ok {
+		return loanDocType
+	}
+	if _, ok := doc["platform_id"]; ok {
+		return donationDocType
+	}
+	if _, ok := doc["serial_number"]; ok {
+		return rechargeDocType
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package sxc
+
+import (
+	"fmt"
+
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 将Application 对象作为字符串写入合约
+func write(stub shim.ChaincodeStubInterface, application Application) (string, error) {
+	err := stampApplication(stub, &application)
+	if err != nil {
+		return "", err
+	}
+
+	err = state.PutJSON(stub, application.ApplicationNumber, application)
+	if err != nil {
+		return "", fmt.Errorf("申请写入账本失败")
+	}
+
+	return "", nil
+}
+
+func getApplication(stub shim.ChaincodeStubInterface, applicationNumber string) (Application, error) {
+	application := Application{}
+
+	applicationAsBytes, err := stub.GetState(applicationNumber)
+
+	if err != nil {
+		return application, fmt.Errorf("获取账本状态失败 %s", applicationNumber)
+	}
+
+	if applicationAsBytes == nil {
+		return application, fmt.Errorf("未找到此申请的信息 %s", applicationNumber)
+	}
+
+	err = decodeDocument(applicationDocType, applicationAsBytes, &application)
+	if err != nil {
+		return application, fmt.Errorf("将合约转换为json对象失败")
+	}
+
+	return application, nil
+}
+
+func getLoanInfo(stub shim.ChaincodeStubInterface, applicationNumber string, loanCounter string) (LoanInfo, error) {
+	loanInfo := LoanInfo{}
+	key, err := loanKey(stub, applicationNumber, loanCounter)
+	if err != nil {
+		return loanInfo, err
+	}
+	loanInfoAsBytes, err := stub.GetState(key)
+	if err != nil {
+		return loanInfo, fmt.Errorf("获取贷款信息失败 %s,%s", applicationNumber, loanCounter)
+	}
+	if loanInfoAsBytes == nil {
+		return loanInfo, fmt.Errorf("未找到此贷款信息 %s,%s", applicationNumber, loanCounter)
+	}
+	err = decodeDocument(loanDocType, loanInfoAsBytes, &loanInfo)
+	if err != nil {
+		return loanInfo, fmt.Errorf("贷款信息json串转换为贷款信息对象失败")
+	}
+	return loanInfo, nil
+}
+
+func setLoanInfo(stub shim.ChaincodeStubInterface, applicationNumber string, loanCounter string, loanInfo LoanInfo) error {
+	key, err := loanKey(stub, applicationNumber, loanCounter)
+	if err != nil {
+		return err
+	}
+
+	err = stampLoan(stub, &loanInfo)
+	if err != nil {
+		return err
+	}
+
+	err = state.PutJSON(stub, key, loanInfo)
+	if err != nil {
+		return fmt.Errorf("贷款信心写入账本失败")
+	}
+	return nil
+}
+
+// 写入申请之前设置修改者和文档版本
+func stampApplication(stub shim.ChaincodeStubInterface, application *Application) error {
+	updatedBy, err := submitterMSP(stub)
+	if err != nil {
+		return err
+	}
+	application.UpdatedBy = updatedBy
+	application.SchemaVersion = schemaVersion(applicationDocType)
+	return nil
+}
+
+// 写入贷款信息之前设置修改者和文档版本
+func stampLoan(stub shim.ChaincodeStubInterface, loanInfo *LoanInfo) error {
+	updatedBy, err := submitterMSP(stub)
+	if err != nil {
+		return err
+	}
+	loanInfo.UpdatedBy = updatedBy
+	loanInfo.SchemaVersion = schemaVersion(loanDocType)
+	return nil
+}
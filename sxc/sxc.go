@@ -0,0 +1,560 @@
+// Package sxc 医疗筹款申请合约的业务逻辑
+// 链码入口在 cmd/sxc 其他链码可以通过 Functions 复用这里的业务函数
+package sxc
+
+// 业务说明
+// 1.填写申请
+// 2.医院审核
+// 3.开始筹款
+// 4.签订贷款协议
+// 5.放款
+// 6.欺诈判定 提交欺诈材料 停止为用户偿还贷款
+// 7.为用户偿还贷款
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/response"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"strconv"
+)
+
+// 业务流程状态
+const (
+	HospitalVerify     = 1 // 等待医院审核
+	HospitalReject     = 2 // 医院审核不通过
+	Raising            = 3 // 筹款中
+	Raised             = 4 // 筹款完成 筹集到了指定金额
+	Cheat              = 5 // 涉及合约欺诈
+	RepaymentCompleted = 6 // 还款完成
+)
+
+const (
+	Agree  = "1"
+	Reject = "0"
+)
+
+type Sxc struct {
+}
+
+// 附件信息
+type Attachment struct {
+	ID  string `json:"id"`  // 附件的唯一ID
+	Md5 string `json:"md5"` // 附件的MD5
+}
+
+// 捐赠信息
+type Donation struct {
+	Donator       string  `json:"donator"`        //捐赠者姓名 匿名/机构名称/姓名 非公开模式下为 匿名
+	Amount        float64 `json:"amount"`         //捐赠金额
+	SerialNumber  string  `json:"serial_number"`  // 业务流水号 此流水号可以在用户对应的充值系统中查询 例如 支付宝 微信中查询
+	SchemaVersion int     `json:"schema_version"` // 文档版本
+	PlatformID    string  `json:"platform_id"`    //捐赠者在平台的ID 化名模式下为加盐哈希 匿名模式下为空
+	Privacy       string  `json:"privacy"`        // 隐私模式 public/pseudonymous/anonymous
+	Time          string  `json:"time"`           // 交易时间
+	TxID          string  `json:"tx_id"`          // 交易ID
+}
+
+// 贷款信息
+// 还款方式默认等额本息
+type LoanInfo struct {
+	LoanNumber          string  `json:"loan_number"`           // 贷款单号
+	FirstRepayment      string  `json:"first_repayment"`       // 第一次还款的月份
+	TotalMonth          string  `json:"total_month"`           // 总共需要还款多少期
+	MoneyReceived       bool    `json:"money_received"`        // 是否已经收到放款
+	ReceiveSerialNumber string  `json:"receive_serial_number"` // 收款流水号
+	RepaymentHistory    string  `json:"repayment_history"`     // 还款历史列表 存储还款流水号即可
+	LoanAmount          float64 `json:"loan_amount"`           // 贷款金额
+	Bank                string  `json:"bank"`                  // 放款银行编号
+	UpdatedBy           string  `json:"updated_by"`            // 最后一次修改此贷款的交易提交者MSP ID
+	SchemaVersion       int     `json:"schema_version"`        // 文档版本
+}
+
+// 充值信息
+type RechargeHistory struct {
+	Amount        float64 `json:"amount"`         // 充值金额
+	SerialNumber  string  `json:"serial_number"`  // 业务流水号 此流水号可以对应在医院的系统中查询到
+	SchemaVersion int     `json:"schema_version"` // 文档版本
+}
+
+// 筹款申请合约
+type Application struct {
+
+	// 以下9个参数申请初始化的时候需要使用
+	ApplicationNumber string `json:"application_number"` // 申请编号
+	Name              string `json:"name"`               //申请者姓名
+	ID                string `json:"id"`                 //申请者身份证号
+	HospitalCode      string `json:"hospital_code"`      // 医院的编号
+	DepartmentCode    string `json:"department_code"`    //科室的编号
+
+	StreetOfficeCode string  `json:"street_office_code"` // 街道办的编号
+	CardNumber       string  `json:"card_number"`        // 就诊卡号
+	DescMd5          string  `json:"desc_md5"`           // 病情描述的md5
+	NeedAmount       float64 `json:"need_amount"`        // 用户申请的资金数量
+
+	// 此项可以单独补充
+	ApplicationAttachments []Attachment `json:"application_attachments"` // 用户申请的时候提交的资料
+
+	State int // 参考常量定义 业务流程状态
+
+	HospitalApproveAmount float64      `json:"hospital_approve_amount"` // 医院审核同意金额
+	HospitalOperator      string       `json:"hospital_operator"`       // 医院的审核员
+	HospitalAttachments   []Attachment `json:"hospital_attachments"`    // 医院审核的相关资料
+
+	DonateCounter int     `json:"donate_counter"` // 捐赠计数器
+	AmountRaised  float64 `json:"amount_raised"`  //已经募集到的金额
+
+	// 贷款信息
+	LoanCounter       int     `json:"loan_counter"`        //贷款计数器 可以多次贷款
+	LoanTotal         float64 `json:"loan_total"`          //总共已经贷款多少
+	ReceivedLoanTotal float64 `json:"received_loan_total"` // 总共已经收到银行放款的总额度
+
+	// 充值到就诊卡的信息
+	RechargeCounter int     `json:"recharge_counter"` // 充值计数器
+	RechargeTotal   float64 `json:"recharge_total"`   // 累计充值金额
+
+	Balance float64 `json:"balance"` //合约余额
+
+	UpdatedBy     string `json:"updated_by"`     // 最后一次修改此申请的交易提交者MSP ID
+	SchemaVersion int    `json:"schema_version"` // 文档版本 旧版本的文档读取时会先升级
+}
+
+// 实例化时 ["init", 治理组织列表, 投票链码名称(可选)]
+// 升级合约时 ["upgrade", 治理组织列表(可选)] 会将账本中的旧版本文档全部升级
+// 账本较大时可以不在 Init 中升级 而是之后分页调用 migrate
+// 节点只在实例化交易中调用 Init
+func (t *Sxc) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	fn, args := stub.GetFunctionAndParameters()
+
+	err := Setup(stub, args, fn == "upgrade", true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// 按函数名注册的业务函数
+// 其他链码可以直接复用这些函数 或者组合到自己的 Invoke 中
+var Functions = map[string]response.Function{
+	"applicate":             applicate,
+	"hVerify":               hVerify,
+	"donate":                donate,
+	"getRaised":             getRaised,
+	"loan":                  loan,
+	"receivedLoan":          receivedLoan,
+	"repay":                 repay,
+	"setCheat":              setCheat,
+	"recharge":              recharge,
+	"getApplicationInfo":    getApplicationInfo,
+	"getApplications":       getApplications,
+	"getDonationReceipt":    getDonationReceipt,
+	"verifyDonationReceipt": verifyDonationReceipt,
+	"getDonations":          getDonations,
+	"setRoles":              setRoles,
+	"getFundFlowReport":     getFundFlowReport,
+	"auditApplication":      auditApplication,
+	"repairApplication":     repairApplication,
+	"getApplicationHistory": getApplicationHistory,
+	"getLoanHistory":        getLoanHistory,
+	"migrate":               migrate,
+	"setCoveragePolicy":     setCoveragePolicy,
+	"getCoveragePolicy":     getCoveragePolicy,
+	"getLoanCapacity":       getLoanCapacity,
+	"executeProposal":       executeProposal,
+	"getParameterHistory":   getParameterHistory,
+}
+
+func (t *Sxc) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return response.Dispatch(stub, Functions, "暂时不支持此函数")
+}
+
+// 发起申请
+// 入参列表
+//		   applicationNumber 申请编号
+//         name 申请者姓名
+//         id 申请者身份证号
+//         hospitalCode 医院编号
+//         departmentCode 科室编号
+
+//         streetOfficeCode 街道办编号
+//         cardNumber 就诊卡号
+//         descMd5 病情描述的md5
+//         needAmount 资金需求
+
+//请求示例 ["invoke", "applicate", "1", "lyx", "500222199009214433", "995", "3", "8876", "9988123519", "abcdabcdabcdabcdabcdabcdabcdabcd", "4000.32"]
+
+func applicate(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 9)
+	if err != nil {
+		return "", err
+	}
+
+	needAmount, err := params.Float(args[8], "需求资金")
+	if err != nil {
+		return "", err
+	}
+
+	application := Application{
+		ApplicationNumber: args[0],
+		Name:              args[1],
+		ID:                args[2],
+		HospitalCode:      args[3],
+		DepartmentCode:    args[4],
+
+		StreetOfficeCode: args[5],
+		CardNumber:       args[6],
+		DescMd5:          args[7],
+		NeedAmount:       needAmount,
+	}
+
+	ledger, change := recordChanges(stub)
+	err = Apply(ledger, application)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "applicate", change)
+	if err != nil {
+		return "", err
+	}
+
+	return "成功", nil
+}
+
+// 医院审核
+// 入参列表
+//          application_number 合约编号
+//			operator 审核人员姓名
+// 		    agree 是否同意 0不同意 1同意
+//          approveAmount 同意的金额
+//          attachments 附件列表 json string [{"id":string}, {"md5":string}]
+
+// 范例 ["invoke", "hVerify", "1", "lengtingxue", "1", "3500", "[{\"id\":\"attachment_id1\", \"md5\":\"md123456md123456md123456md123456\"}]"]
+func hVerify(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 5)
+	if err != nil {
+		return "", err
+	}
+
+	approveAmount, err := params.Float(args[3], "同意金额")
+	if err != nil {
+		return "", err
+	}
+
+	var attachments []Attachment
+	err = json.Unmarshal([]byte(args[4]), &attachments)
+	if err != nil {
+		return "", fmt.Errorf("无法将附件列表转换为附件对象 %s", args[4])
+	}
+
+	if args[2] != Agree && args[2] != Reject {
+		return "", fmt.Errorf("同意与否参数错误 %s", args[2])
+	}
+
+	ledger, change := recordChanges(stub)
+	err = Verify(ledger, args[0], args[1], args[2] == Agree, approveAmount, attachments)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "hVerify", change)
+	if err != nil {
+		return "", err
+	}
+
+	return "成功", nil
+}
+
+// 捐赠
+// 入参列表
+//          application_number 合约编号
+//			donator 赠者姓名 匿名/机构名称/姓名
+// 		    amount 捐赠金额
+//          serialNumber 业务流水号
+//          platformID 捐赠者的平台ID
+//          privacy 隐私模式 可选 public/pseudonymous/anonymous 默认 public
+//                  非公开模式下 donator 与 platformID 传空字符串
+//                  真实身份通过 transient 的 donor 字段传入 {"donator":string, "platform_id":string, "salt":string}
+
+// 范例 ["invoke", "donate", "1", "zhangsan", "300", "sxc202008161449", "platformid008"]
+// 范例 ["invoke", "donate", "1", "", "300", "sxc202008161449", "", "pseudonymous"]
+// 返回 捐赠回执编号 可以通过 getDonationReceipt 查询回执
+func donate(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 5, 6)
+	if err != nil {
+		return "", err
+	}
+
+	privacy := params.Optional(args, 5, PrivacyPublic)
+	applicationNumber := args[0]
+
+	// 捐赠金额
+	donateAmount, err := params.PositiveFloat(args[2], "捐赠金额")
+	if err != nil {
+		return "", err
+	}
+
+	identity, err := resolveDonor(stub, privacy, args[1], args[4])
+	if err != nil {
+		return "", err
+	}
+	donator, platformID := maskDonor(identity)
+
+	donateTime, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	donateHistory := Donation{
+		Donator:      donator,
+		Amount:       donateAmount,
+		SerialNumber: args[3],
+		PlatformID:   platformID,
+		Privacy:      privacy,
+		Time:         donateTime,
+		TxID:         stub.GetTxID()}
+
+	ledger, change := recordChanges(stub)
+	donateCounter, err := Donate(ledger, applicationNumber, donateHistory)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "donate", change)
+	if err != nil {
+		return "", err
+	}
+
+	donateKey, err := donationKey(stub, applicationNumber, strconv.Itoa(donateCounter))
+	if err != nil {
+		return "", err
+	}
+
+	err = putDonorIdentity(stub, donateKey, identity)
+	if err != nil {
+		return "", err
+	}
+
+	return putDonationReceipt(stub, applicationNumber, donateCounter, donateKey, donateHistory, identity)
+}
+
+// 查询申请合约的总捐赠额度
+// 入参
+//
+//	application_number 合约编号
+//
+// 范例 ["invoke", "getRaised", "1"]
+func getRaised(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	application, err := getApplication(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	strAmount := strconv.FormatFloat(application.AmountRaised, 'E', -1, 64)
+	return strAmount, nil
+
+}
+
+// 贷款
+// 入参列表
+//          application_number 合约编号
+// 		    amount 贷款金额
+//          loan_number 贷款单号
+//          first_repayment 第一次还款的月份
+//  		total_month 总共需要还款多少期
+//          bank 放款银行编号 可选 贷款覆盖策略配置了银行上限时必须指定
+
+// 范例 ["invoke", "loan", "1", "200", "sxc202008161449", "2020-09", "24", "icbc"]
+// 返回 {"counter":1,"remaining_capacity":100}
+func loan(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 5, 6)
+	if err != nil {
+		return "", err
+	}
+
+	// 贷款金额
+	loanAmount, err := params.PositiveFloat(args[1], "贷款金额")
+	if err != nil {
+		return "", err
+	}
+
+	loanInfo := LoanInfo{
+		LoanNumber:     args[2],
+		FirstRepayment: args[3],
+		TotalMonth:     args[4],
+		LoanAmount:     loanAmount,
+		Bank:           params.Optional(args, 5, "")}
+
+	ledger, change := recordChanges(stub)
+	loanCounter, remaining, err := Lend(ledger, args[0], loanInfo)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "loan", change)
+	if err != nil {
+		return "", err
+	}
+
+	strRemaining := strconv.FormatFloat(remaining, 'f', -1, 64)
+	returnStr := "{\"counter\":" + strconv.Itoa(loanCounter) + ",\"remaining_capacity\":" + strRemaining + "}"
+	return returnStr, nil
+}
+
+// 收到银行放款
+// 入参列表
+//          application_number 合约编号
+// 		    loan_number 贷款单号
+//          load_counter 计数器
+//          serial_number 放款入账流水号
+
+// 范例 ["invoke", "receivedLoan", "1", "sxc202008161449", "1", "serial_number2020-08-22 20:31:06"]
+func receivedLoan(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 4)
+	if err != nil {
+		return "", err
+	}
+
+	loanCounter, err := strconv.Atoi(args[2])
+	if err != nil {
+		return "", fmt.Errorf("贷款计数器需要是整数 %s", args[2])
+	}
+
+	ledger, change := recordChanges(stub)
+	err = ReceiveLoan(ledger, args[0], args[1], loanCounter, args[3])
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "receivedLoan", change)
+	if err != nil {
+		return "", err
+	}
+
+	return "成功", nil
+}
+
+// 偿还贷款的一期 还款期数达到 total_month 时贷款还清 释放贷款占用的银行敞口
+// 入参列表
+//
+//	application_number 合约编号
+//	loan_number 贷款单号
+//	loan_counter 贷款计数器
+//	serial_number 还款流水号
+//
+// 范例 ["invoke", "repay", "1", "sxc202008161449", "1", "repay2020-09"]
+// 返回 已经还款的期数
+func repay(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 4)
+	if err != nil {
+		return "", err
+	}
+
+	loanCounter, err := strconv.Atoi(args[2])
+	if err != nil {
+		return "", fmt.Errorf("贷款计数器需要是整数 %s", args[2])
+	}
+
+	ledger, change := recordChanges(stub)
+	repaid, err := Repay(ledger, args[0], args[1], loanCounter, args[3])
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "repay", change)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.Itoa(repaid), nil
+}
+
+// 设置此申请为欺诈申请 还没有放款的贷款从银行贷款敞口中释放
+// 入参列表
+//
+//	application_number 合约编号
+func setCheat(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	ledger, change := recordChanges(stub)
+	err = MarkCheat(ledger, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "setCheat", change)
+	if err != nil {
+		return "", err
+	}
+
+	return "成功", nil
+}
+
+// 为用户的就诊卡充值
+// 充值金额需要是正数 并且不能超过可用资金 即捐赠加已到账的贷款减去已经充值的金额 参考 CHANGELOG.md
+// 入参列表
+//          application_number 合约编号
+//          serial_number 充值流水号
+//          amount 充值金额
+
+// 范例 ["invoke", "recharge", "1", "sxc202008161449", "100"]
+func recharge(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 3)
+	if err != nil {
+		return "", err
+	}
+
+	amount, err := params.PositiveFloat(args[2], "充值金额")
+	if err != nil {
+		return "", err
+	}
+
+	ledger, change := recordChanges(stub)
+	_, err = Recharge(ledger, args[0], args[1], amount)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitChange(stub, "recharge", change)
+	if err != nil {
+		return "", err
+	}
+
+	return "成功", nil
+}
+
+// 获取合约详情
+// 入参列表
+//          application_number 合约编号
+
+// 范例 ["invoke", "getApplicationInfo", "1"]
+func getApplicationInfo(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	application, err := getApplication(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	// 旧版本的文档按升级后的格式返回
+	applicationAsBytes, err := json.Marshal(application)
+	if err != nil {
+		return "", fmt.Errorf("无法将申请对象转换为Json对象")
+	}
+
+	return string(applicationAsBytes), nil
+}
@@ -0,0 +1,289 @@
+package sxc_test
+
+import (
+	"testing"
+
+	"github.com/ForLina/sxc_contract/scenario"
+)
+
+type obj = map[string]interface{}
+
+func text(s string) *string {
+	return &s
+}
+
+// 执行场景 每个失败的步骤记录一个错误
+func runScenario(t *testing.T, s scenario.Scenario) {
+	t.Helper()
+
+	result := scenario.Run(s)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	for _, step := range result.Steps {
+		if step.Err != nil {
+			t.Errorf("%s: %v", step.Name, step.Err)
+		}
+	}
+}
+
+func TestSxcInit(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		error string
+	}{
+		{"不传治理组织", []string{"init"}, "治理配置尚未初始化 需要传入治理组织列表"},
+		{"治理组织列表格式", []string{"init", "Org1MSP"}, "无法将治理组织列表转换为数组"},
+		{"治理组织列表为空", []string{"init", "[]"}, "治理组织列表不能为空"},
+		{"参数数目", []string{"init", "[\"Org1MSP\"]", "vote", "{}", "x"}, "需要 1 到 3 个参数"},
+		{"提案最低要求格式", []string{"init", "[\"Org1MSP\"]", "vote", "x"}, "无法将提案的最低要求转换为对象"},
+		{"提案投票组织数量超过治理组织", []string{"init", "[\"Org1MSP\"]", "vote", "{\"quorum\":2}"}, "提案的最少投票组织数量需要在0到治理组织数量 1 之间"},
+		{"提案同意票比例", []string{"init", "[\"Org1MSP\"]", "vote", "{\"threshold\":1}"}, "提案的同意票比例需要在0到1之间"},
+		{"实例化", []string{"init", "[\"Org1MSP\"]", "vote"}, ""},
+		{"设置提案最低要求", []string{"init", "[\"Org1MSP\",\"Org2MSP\"]", "vote", "{\"quorum\":1,\"threshold\":0.6}"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runScenario(t, scenario.Scenario{
+				Chaincode: "sxc",
+				Creator:   "Org1MSP",
+				Steps:     []scenario.Step{{Init: true, Args: tt.args, Error: tt.error}},
+			})
+		})
+	}
+}
+
+func TestSxcUpgrade(t *testing.T) {
+	runScenario(t, scenario.Scenario{
+		Chaincode: "sxc",
+		Creator:   "Org1MSP",
+		Init:      []string{"init", "[\"Org1MSP\"]"},
+		Steps: []scenario.Step{
+			{Name: "不能再次实例化", Init: true, Creator: "Org2MSP", Args: []string{"init", "[\"Org2MSP\"]"}, Error: "治理配置已经初始化"},
+			{Name: "非治理组织也不是管理员不能升级", Init: true, Creator: "Org2MSP", Args: []string{"upgrade"}, Error: "不属于治理组织也不是管理员"},
+			{Name: "非治理组织不能设置治理组织", Init: true, Creator: "Org2MSP", Args: []string{"upgrade", "[\"Org2MSP\"]"}, Error: "不属于治理组织"},
+			{Name: "管理员可以升级", Args: []string{"setRoles", "{\"platform_msps\":[\"Org1MSP\"],\"admin_msps\":[\"Org2MSP\"]}"}, Payload: text("成功")},
+			{Init: true, Creator: "Org2MSP", Args: []string{"upgrade"}},
+			{Name: "治理组织重新设置治理组织", Init: true, Args: []string{"upgrade", "[\"Org1MSP\",\"Org2MSP\"]"},
+				State: []scenario.StateExpectation{{ObjectType: "config", Attributes: []string{"governance"}, Value: obj{"msps": []interface{}{"Org1MSP", "Org2MSP"}}}}},
+		},
+	})
+}
+
+// 按顺序调用每个函数 先校验参数和权限错误 再完成一次正常流程
+// MockStub 没有实现历史查询 依赖历史的函数只校验参数
+func TestSxcFunctions(t *testing.T) {
+	application := []string{"applicate", "1", "lyx", "500222199009214433", "995", "3", "8876", "9988123519", "abcdabcdabcdabcdabcdabcdabcdabcd", "1000"}
+
+	runScenario(t, scenario.Scenario{
+		Chaincode: "sxc",
+		Creator:   "Org1MSP",
+		Init:      []string{"init", "[\"Org1MSP\"]"},
+		// executeProposal 通过 InvokeChaincode 读取投票链码
+		Peers: map[string][]string{"vote": {"init"}},
+		Steps: []scenario.Step{
+			{Name: "未注册的函数", Args: []string{"transfer"}, Error: "暂时不支持此函数"},
+
+			{Name: "applicate 参数数目", Args: []string{"applicate", "1"}, Error: "需要 9 个参数"},
+			{Name: "applicate 金额格式", Args: []string{"applicate", "1", "a", "b", "c", "d", "e", "f", "g", "abc"}, Error: "无法将需求资金转换为float64类型"},
+			{Name: "applicate", Args: application, Payload: text("成功")},
+			{Name: "applicate 编号重复", Args: application, Error: "已经存在此合约编号 1"},
+
+			{Name: "hVerify 参数数目", Args: []string{"hVerify", "1"}, Error: "需要 5 个参数"},
+			{Name: "hVerify 申请不存在", Args: []string{"hVerify", "9", "op", "1", "800", "[]"}, Error: "未找到此申请的信息 9"},
+			{Name: "hVerify 同意参数", Args: []string{"hVerify", "1", "op", "2", "800", "[]"}, Error: "同意与否参数错误 2"},
+			{Name: "hVerify", Args: []string{"hVerify", "1", "op", "1", "800", "[]"}, Payload: text("成功")},
+
+			{Name: "setRoles 参数数目", Args: []string{"setRoles"}, Error: "需要 1 个参数"},
+			{Name: "setRoles 非治理组织", Creator: "Org2MSP", Args: []string{"setRoles", "{}"}, Error: "不属于治理组织"},
+			{Name: "setRoles 平台组织为空", Args: []string{"setRoles", "{\"admin_msps\":[\"Org1MSP\"]}"}, Error: "角色配置的 platform_msps 不能为空"},
+			{Name: "setRoles 管理员组织为空", Args: []string{"setRoles", "{\"platform_msps\":[\"PlatformMSP\"],\"admin_msps\":[]}"}, Error: "角色配置的 admin_msps 不能为空"},
+			{Name: "setRoles 空的MSP ID", Args: []string{"setRoles", "{\"platform_msps\":[\" \"],\"admin_msps\":[\"Org1MSP\"]}"}, Error: "角色配置的 platform_msps 中有空的MSP ID"},
+			{Name: "setRoles 重复的MSP ID", Args: []string{"setRoles", "{\"platform_msps\":[\"PlatformMSP\"],\"admin_msps\":[\"Org1MSP\",\"Org1MSP\"]}"}, Error: "角色配置的 admin_msps 中有重复的MSP ID Org1MSP"},
+			{Name: "setRoles", Args: []string{"setRoles", "{\"platform_msps\":[\"PlatformMSP\"],\"admin_msps\":[\"Org1MSP\"]}"}, Payload: text("成功")},
+
+			{Name: "donate 参数数目", Args: []string{"donate", "1"}, Error: "需要 5 或 6 个参数"},
+			{Name: "donate 隐私模式", Args: []string{"donate", "1", "zhangsan", "100", "sn1", "platform1", "secret"}, Error: "隐私模式参数错误 secret"},
+			{Name: "donate 金额", Args: []string{"donate", "1", "zhangsan", "-1", "sn1", "platform1"}, Error: "捐赠金额需要是正数"},
+			{Name: "donate", Creator: "PlatformMSP", Args: []string{"donate", "1", "zhangsan", "600", "sn1", "platform1"}},
+
+			{Name: "getRaised 参数数目", Args: []string{"getRaised"}, Error: "需要 1 个参数"},
+			{Name: "getRaised", Args: []string{"getRaised", "1"}, Payload: text("6E+02")},
+
+			{Name: "getDonations 参数数目", Args: []string{"getDonations"}, Error: "需要 1 个参数"},
+			{Name: "getDonations", Args: []string{"getDonations", "1"}, JSON: []interface{}{obj{"donator": "zhangsan"}}},
+
+			{Name: "getDonationReceipt 参数数目", Args: []string{"getDonationReceipt"}, Error: "需要 1 个参数"},
+			{Name: "getDonationReceipt 回执不存在", Args: []string{"getDonationReceipt", "nothing"}, Error: "未找到此回执 nothing"},
+			{Name: "verifyDonationReceipt 参数数目", Args: []string{"verifyDonationReceipt"}, Error: "需要 1 到 3 个参数"},
+			{Name: "verifyDonationReceipt 格式", Args: []string{"verifyDonationReceipt", "{"}, Error: "无法将回执转换为回执对象"},
+
+			{Name: "setCoveragePolicy 非治理组织", Creator: "Org2MSP", Args: []string{"setCoveragePolicy", "{\"max_loan_ratio\":0.5}"}, Error: "不属于治理组织"},
+			{Name: "setCoveragePolicy 比例范围", Args: []string{"setCoveragePolicy", "{\"max_loan_ratio\":2}"}, Error: "最大贷款比例需要在 (0, 1] 之间"},
+			{Name: "setCoveragePolicy", Args: []string{"setCoveragePolicy", "{\"max_loan_ratio\":0.5}"}, Payload: text("成功")},
+			{Name: "getCoveragePolicy", Args: []string{"getCoveragePolicy"}, JSON: obj{"max_loan_ratio": 0.5}},
+			{Name: "getLoanCapacity 参数数目", Args: []string{"getLoanCapacity"}, Error: "需要 1 或 2 个参数"},
+			{Name: "getLoanCapacity", Args: []string{"getLoanCapacity", "1"}, Payload: text("300")},
+
+			{Name: "loan 参数数目", Args: []string{"loan", "1"}, Error: "需要 5 或 6 个参数"},
+			{Name: "loan 超过可贷额度", Args: []string{"loan", "1", "301", "L1", "2020-09", "24"}, Error: "贷款金额超过剩余可贷额度"},
+			{Name: "loan", Args: []string{"loan", "1", "200", "L1", "2020-09", "24"}, JSON: obj{"counter": 1, "remaining_capacity": 100}},
+
+			{Name: "receivedLoan 参数数目", Args: []string{"receivedLoan", "1"}, Error: "需要 4 个参数"},
+			{Name: "receivedLoan 计数器格式", Args: []string{"receivedLoan", "1", "L1", "a", "bsn1"}, Error: "贷款计数器需要是整数 a"},
+			{Name: "receivedLoan", Args: []string{"receivedLoan", "1", "L1", "1", "bsn1"}, Payload: text("成功")},
+
+			{Name: "recharge 参数数目", Args: []string{"recharge", "1"}, Error: "需要 3 个参数"},
+			{Name: "recharge 超过可用资金", Args: []string{"recharge", "1", "rsn1", "900"}, Error: "充值金额超过可用资金"},
+			{Name: "recharge", Args: []string{"recharge", "1", "rsn1", "120"}, Payload: text("成功")},
+
+			{Name: "getApplicationInfo 参数数目", Args: []string{"getApplicationInfo"}, Error: "需要 1 个参数"},
+			{Name: "getApplicationInfo", Args: []string{"getApplicationInfo", "1"}, JSON: obj{"amount_raised": 600, "loan_total": 200, "received_loan_total": 200, "recharge_total": 120}},
+			{Name: "getApplications 参数数目", Args: []string{"getApplications", "1"}, Error: "需要 2 个参数"},
+			{Name: "getApplications 每页数量", Args: []string{"getApplications", "-1", ""}, Error: "无法将每页数量转换为非负整数 -1"},
+			{Name: "getApplications", Args: []string{"getApplications", "1", ""}, JSON: obj{"bookmark": "", "applications": []interface{}{obj{
+				"function": "getApplications", "application_number": "1", "application": obj{"amount_raised": 600},
+				"donations": []interface{}{obj{"donate_counter": 1}}, "loans": []interface{}{obj{"loan_counter": 1}}, "recharges": []interface{}{obj{"recharge_counter": 1}},
+			}}}},
+
+			{Name: "getFundFlowReport 输出格式", Args: []string{"getFundFlowReport", "1", "xml"}, Error: "输出格式参数错误 xml"},
+			{Name: "getFundFlowReport", Args: []string{"getFundFlowReport", "1"}, JSON: obj{"discrepancies": []interface{}{}}},
+
+			{Name: "auditApplication 参数数目", Args: []string{"auditApplication"}, Error: "需要 1 个参数"},
+			{Name: "auditApplication", Args: []string{"auditApplication", "1"}, JSON: obj{"consistent": true}},
+			{Name: "repairApplication 非管理员", Creator: "Org2MSP", Args: []string{"repairApplication", "1"}, Error: "只有管理员可以修复申请"},
+			{Name: "repairApplication", Args: []string{"repairApplication", "1"}, JSON: obj{"consistent": true}},
+
+			{Name: "getApplicationHistory 参数数目", Args: []string{"getApplicationHistory"}, Error: "需要 1 个参数"},
+			{Name: "getLoanHistory 参数数目", Args: []string{"getLoanHistory", "1"}, Error: "需要 2 个参数"},
+
+			{Name: "migrate 非管理员", Creator: "Org2MSP", Args: []string{"migrate", "10", "", "false"}, Error: "只有管理员可以升级账本中的文档"},
+			{Name: "migrate 试运行", Creator: "Org2MSP", Args: []string{"migrate", "10", "", "true"}, JSON: obj{"dry_run": true}},
+			{Name: "migrate", Args: []string{"migrate", "10", "", "false"}, JSON: obj{"dry_run": false, "changes": []interface{}{}}},
+
+			{Name: "executeProposal 参数数目", Args: []string{"executeProposal"}, Error: "需要 1 个参数"},
+			{Name: "executeProposal 提案不存在", Args: []string{"executeProposal", "p1"}, Error: "从投票链码 vote 读取提案失败 提案不存在 p1"},
+			{Name: "getParameterHistory 参数", Args: []string{"getParameterHistory", "governance"}, Error: "不支持修改的参数 governance"},
+			{Name: "getParameterHistory", Args: []string{"getParameterHistory", "coverage"}, JSON: []interface{}{obj{"parameter": "coverage", "coverage": obj{"max_loan_ratio": 0.5}, "proposal_id": ""}}},
+
+			{Name: "setCheat 参数数目", Args: []string{"setCheat"}, Error: "需要 1 个参数"},
+			{Name: "setCheat", Args: []string{"setCheat", "1"}, Payload: text("成功")},
+			{Name: "欺诈申请不予充值", Args: []string{"recharge", "1", "rsn2", "1"}, Error: "涉嫌欺诈,不予充值"},
+			{Name: "欺诈申请不予放款", Args: []string{"receivedLoan", "1", "L1", "1", "bsn2"}, Error: "涉嫌欺诈,不予放款"},
+		},
+	})
+}
+
+// 提案者设置的投票规则低于治理配置的最低要求时 投票链码中通过的提案也不能执行
+func TestExecuteProposalRequirement(t *testing.T) {
+	poll := func(id string, rules string) string {
+		return `{"poll_id":"` + id + `","title":"治理提案","start_time":"2100-01-01T00:00:00Z","end_time":"2100-01-10T00:00:00Z",` +
+			`"eligibility":{"msps":["Org1MSP","Org2MSP","Org3MSP"]},"rules":` + rules + `}`
+	}
+	change := `{"parameter":"coverage","coverage":{"max_loan_ratio":0.5}}`
+	vote := func(creator string, id string, option string) scenario.Step {
+		return scenario.Step{Creator: creator, Chaincode: "vote", Time: "2100-01-05T00:00:00Z", Args: []string{"voteUser", id, option}}
+	}
+	finalize := func(id string) scenario.Step {
+		return scenario.Step{Chaincode: "vote", Time: "2100-01-11T00:00:00Z", Args: []string{"finalizePoll", id}, JSON: obj{"outcome": obj{"status": "passed", "winner": "approve"}}}
+	}
+
+	runScenario(t, scenario.Scenario{
+		Chaincode: "sxc",
+		Creator:   "Org1MSP",
+		Init:      []string{"init", "[\"Org1MSP\",\"Org2MSP\",\"Org3MSP\"]", "vote", "{\"quorum\":3,\"threshold\":0.7}"},
+		Peers:     map[string][]string{"vote": {"init"}},
+		Steps: []scenario.Step{
+			{Name: "提案不允许改票", Chaincode: "vote", Args: []string{"createProposal", poll("p0", `{"quorum":3},"allow_change":true`), change}, Error: "治理提案不允许改票"},
+
+			{Name: "法定人数低于治理要求", Chaincode: "vote", Args: []string{"createProposal", poll("p1", `{"quorum":1}`), change}, Payload: text("p1")},
+			vote("Org1MSP", "p1", "approve"),
+			finalize("p1"),
+			{Chaincode: "vote", Args: []string{"getProposal", "p1"}, JSON: obj{"approved": true, "turnout": 1, "share": 1}},
+			{Name: "一个组织单方面通过的提案不能执行", Args: []string{"executeProposal", "p1"}, Error: "提案的投票组织数量 1 少于治理要求的 3"},
+
+			{Name: "得票比例低于治理要求", Chaincode: "vote", Args: []string{"createProposal", poll("p2", `{"quorum":3}`), change}, Payload: text("p2")},
+			vote("Org1MSP", "p2", "approve"),
+			vote("Org2MSP", "p2", "approve"),
+			vote("Org3MSP", "p2", "reject"),
+			finalize("p2"),
+			{Name: "同意票没有超过治理要求的比例", Args: []string{"executeProposal", "p2"}, Error: "提案的同意票比例 0.6666666666666666 没有超过治理要求的 0.7"},
+
+			{Name: "满足治理要求", Chaincode: "vote", Args: []string{"createProposal", poll("p3", `{"quorum":3}`), change}, Payload: text("p3")},
+			vote("Org1MSP", "p3", "approve"),
+			vote("Org2MSP", "p3", "approve"),
+			vote("Org3MSP", "p3", "approve"),
+			finalize("p3"),
+			{Name: "executeProposal", Args: []string{"executeProposal", "p3"}, JSON: obj{"proposal_id": "p3"}},
+		},
+	})
+}
+
+func TestExecuteProposalInclusiveThreshold(t *testing.T) {
+	poll := func(id string) string {
+		return `{"poll_id":"` + id + `","title":"治理提案","start_time":"2100-01-01T00:00:00Z","end_time":"2100-01-10T00:00:00Z",` +
+			`"eligibility":{"msps":["Org1MSP","Org2MSP","Org3MSP"]},"rules":{"quorum":3}}`
+	}
+	vote := func(creator string, id string, option string) scenario.Step {
+		return scenario.Step{Creator: creator, Chaincode: "vote", Time: "2100-01-05T00:00:00Z", Args: []string{"voteUser", id, option}}
+	}
+	finalize := func(id string) scenario.Step {
+		return scenario.Step{Chaincode: "vote", Time: "2100-01-11T00:00:00Z", Args: []string{"finalizePoll", id}, JSON: obj{"outcome": obj{"status": "passed", "winner": "approve"}}}
+	}
+	twoOfThree := func(id string, change string) []scenario.Step {
+		return []scenario.Step{
+			{Chaincode: "vote", Args: []string{"createProposal", poll(id), change}, Payload: text(id)},
+			vote("Org1MSP", id, "approve"),
+			vote("Org2MSP", id, "approve"),
+			vote("Org3MSP", id, "reject"),
+			finalize(id),
+		}
+	}
+
+	steps := []scenario.Step{
+		{Name: "同意票比例不能超过1", Init: true, Args: []string{"upgrade", "[\"Org1MSP\",\"Org2MSP\",\"Org3MSP\"]", "vote", "{\"threshold\":1}"}, Error: "只有 inclusive 时可以为1"},
+	}
+	steps = append(steps, scenario.Step{Name: "提案不能清空管理员组织", Chaincode: "vote",
+		Args: []string{"createProposal", poll("p1"), `{"parameter":"roles","roles":{"platform_msps":["Org1MSP"],"admin_msps":[]}}`}, Error: "角色配置的 admin_msps 不能为空"})
+	// 三分之二写作 0.6667 两票同意一票反对时达到要求
+	steps = append(steps, twoOfThree("p2", `{"parameter":"coverage","coverage":{"max_loan_ratio":0.5}}`)...)
+	steps = append(steps, scenario.Step{Name: "达到三分之二", Args: []string{"executeProposal", "p2"}, JSON: obj{"proposal_id": "p2"}})
+
+	runScenario(t, scenario.Scenario{
+		Chaincode: "sxc",
+		Creator:   "Org1MSP",
+		Init:      []string{"init", "[\"Org1MSP\",\"Org2MSP\",\"Org3MSP\"]", "vote", "{\"quorum\":3,\"threshold\":0.6667,\"inclusive\":true}"},
+		Peers:     map[string][]string{"vote": {"init"}},
+		Steps:     steps,
+	})
+}
+
+// 同一秒内的参数修改按交易提交的顺序排列 交易ID tx10 按字符串排在 tx9 之前
+func TestParameterHistoryOrder(t *testing.T) {
+	setCoverage := func(ratio string) scenario.Step {
+		return scenario.Step{Time: "2100-01-01T00:00:00Z", Args: []string{"setCoveragePolicy", `{"max_loan_ratio":` + ratio + `}`}, Payload: text("成功")}
+	}
+
+	steps := []scenario.Step{}
+	for len(steps) < 7 {
+		steps = append(steps, scenario.Step{Args: []string{"getCoveragePolicy"}})
+	}
+	steps = append(steps,
+		setCoverage("0.9"),
+		setCoverage("0.8"),
+		scenario.Step{Args: []string{"getParameterHistory", "coverage"}, JSON: []interface{}{
+			obj{"sequence": 1, "tx_id": "tx9", "coverage": obj{"max_loan_ratio": 0.9}},
+			obj{"sequence": 2, "tx_id": "tx10", "coverage": obj{"max_loan_ratio": 0.8}},
+		}},
+		scenario.Step{Args: []string{"getCoveragePolicy"}, JSON: obj{"max_loan_ratio": 0.8}},
+	)
+
+	runScenario(t, scenario.Scenario{
+		Chaincode: "sxc",
+		Creator:   "Org1MSP",
+		Init:      []string{"init", "[\"Org1MSP\"]"},
+		Steps:     steps,
+	})
+}
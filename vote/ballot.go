@@ -0,0 +1,214 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 投票者在一次投票中的选票 每个投票者只有一张
+type Ballot struct {
+	PollID    string   `json:"poll_id"`   // 投票ID
+	Voter     string   `json:"voter"`     // 投票者 参考 voterID
+	MSPID     string   `json:"msp_id"`    // 投票者的MSP ID
+	Candidate string   `json:"candidate"` // 投给的候选人 ranked 和 approval 为第一个候选人
+	Choices   []string `json:"choices"`   // 选票内容 ranked 按偏好排序 其他计票方式只有一个候选人
+	Weight    float64  `json:"weight"`    // 选票的权重 只有 weighted 计票方式不为1
+	TxID      string   `json:"tx_id"`     // 最后一次投票的交易ID
+	Time      string   `json:"time"`      // 最后一次投票的时间
+	Changes   int      `json:"changes"`   // 改票次数
+}
+
+// 投票者的标识 MSP ID/证书ID
+// 投票设置了 voter_attribute 时使用证书属性代替证书ID 同一个人换了证书也只能投一次 例如学号 工号
+// 治理提案每个组织只有一票 标识为 MSP ID
+func voterID(stub shim.ChaincodeStubInterface, poll Poll) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("获取调用者MSP ID失败")
+	}
+
+	if poll.Proposal {
+		return mspID, nil
+	}
+
+	if poll.VoterAttribute != "" {
+		value, found, err := cid.GetAttributeValue(stub, poll.VoterAttribute)
+		if err != nil {
+			return "", fmt.Errorf("获取调用者证书属性失败 %s", poll.VoterAttribute)
+		}
+		if !found || value == "" {
+			return "", fmt.Errorf("调用者证书没有属性 %s 无法确定投票者", poll.VoterAttribute)
+		}
+		return mspID + "/" + value, nil
+	}
+
+	id, err := cid.GetID(stub)
+	if err != nil {
+		return "", fmt.Errorf("获取调用者证书ID失败")
+	}
+	return mspID + "/" + id, nil
+}
+
+// 写入调用者的选票 返回选票和改票之前的选票 第一次投票时之前的选票为 nil
+// 已经投过票时 只有投票允许改票才可以改投
+func castBallot(stub shim.ChaincodeStubInterface, poll Poll, choices []string) (Ballot, *Ballot, error) {
+	voter, err := voterID(stub, poll)
+	if err != nil {
+		return Ballot{}, nil, err
+	}
+
+	weight, err := voterWeight(stub, poll, voter)
+	if err != nil {
+		return Ballot{}, nil, err
+	}
+
+	ballot := Ballot{}
+	found, err := state.GetCompositeJSON(stub, ballotObjectType, []string{poll.PollID, voter}, &ballot)
+	if err != nil {
+		return Ballot{}, nil, err
+	}
+
+	var previous *Ballot
+	if found {
+		if !poll.AllowChange {
+			return Ballot{}, nil, fmt.Errorf("已经在投票 %s 中投过票 不允许改票", poll.PollID)
+		}
+		if sameChoices(ballot.choices(), choices) {
+			return Ballot{}, nil, fmt.Errorf("已经投票给候选人 %s", strings.Join(choices, ","))
+		}
+		old := ballot
+		previous = &old
+		ballot.Changes++
+	} else {
+		mspID, err := cid.GetMSPID(stub)
+		if err != nil {
+			return Ballot{}, nil, fmt.Errorf("获取调用者MSP ID失败")
+		}
+		ballot = Ballot{PollID: poll.PollID, Voter: voter, MSPID: mspID}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return Ballot{}, nil, err
+	}
+	ballot.Candidate = choices[0]
+	ballot.Choices = choices
+	ballot.Weight = weight
+	ballot.TxID = stub.GetTxID()
+	ballot.Time = now.Format(time.RFC3339)
+
+	err = state.PutCompositeJSON(stub, ballotObjectType, []string{poll.PollID, voter}, ballot)
+	if err != nil {
+		return Ballot{}, nil, err
+	}
+
+	return ballot, previous, nil
+}
+
+// 选票内容 早期的选票只有 candidate
+func (b Ballot) choices() []string {
+	if len(b.Choices) == 0 {
+		return []string{b.Candidate}
+	}
+	return b.Choices
+}
+
+// 选票的权重 早期的选票没有权重 按1计算
+func (b Ballot) weight() float64 {
+	if b.Weight == 0 {
+		return 1
+	}
+	return b.Weight
+}
+
+func sameChoices(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 修改候选人的得票数和加权得票 返回修改后的得票
+func addVotes(stub shim.ChaincodeStubInterface, pollID string, candidate string, delta int, weight float64) (Vote, error) {
+	vote := Vote{PollID: pollID, Username: candidate}
+	_, err := state.GetCompositeJSON(stub, voteObjectType, []string{pollID, candidate}, &vote)
+	if err != nil {
+		return Vote{}, err
+	}
+
+	vote.Votenum += delta
+	vote.Weight += weight
+	if vote.Votenum < 0 {
+		return Vote{}, fmt.Errorf("候选人得票数不能为负数 %s,%s", pollID, candidate)
+	}
+
+	err = state.PutCompositeJSON(stub, voteObjectType, []string{pollID, candidate}, vote)
+	if err != nil {
+		return Vote{}, err
+	}
+	return vote, nil
+}
+
+// 查询选票
+// 秘密投票在公布期结束之前只能查询自己的选票 公布的选票包含投给的候选人
+// 入参列表
+//
+//	poll_id 投票ID
+//	voter 投票者 可选 默认为调用者自己
+//
+// 范例 ["query", "getBallot", "2024-board"]
+// 范例 ["query", "getBallot", "2024-board", "Org1MSP/S2024001"]
+func getBallot(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 1, 2)
+	if err != nil {
+		return "", err
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	// 调用者无法确定投票者标识时 只能查询公开的选票
+	self, selfErr := voterID(stub, poll)
+	voter := params.Optional(args, 1, "")
+	if voter == "" {
+		if selfErr != nil {
+			return "", selfErr
+		}
+		voter = self
+	}
+	if voter != self {
+		err = requireTalliesVisible(stub, poll)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	ballot := Ballot{}
+	found, err := state.GetCompositeJSON(stub, ballotObjectType, []string{poll.PollID, voter}, &ballot)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("没有找到投票者的选票 %s", voter)
+	}
+
+	ballotAsBytes, err := json.Marshal(ballot)
+	if err != nil {
+		return "", fmt.Errorf("无法将选票转换为Json字符串")
+	}
+	return string(ballotAsBytes), nil
+}
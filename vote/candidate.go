@@ -0,0 +1,258 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 候选人的审核状态
+const (
+	CandidatePending  = "pending"  // 等待审核
+	CandidateApproved = "approved" // 审核通过 进入投票的候选人列表
+	CandidateRejected = "rejected" // 审核不通过
+)
+
+const (
+	Agree  = "1"
+	Reject = "0"
+)
+
+// 候选人登记信息
+type Candidate struct {
+	PollID         string `json:"poll_id"`         // 投票ID
+	CandidateID    string `json:"candidate_id"`    // 候选人ID 投票时使用
+	Name           string `json:"name"`            // 候选人姓名
+	Description    string `json:"description"`     // 候选人简介
+	AttachmentHash string `json:"attachment_hash"` // 候选人资料的哈希
+	Status         string `json:"status"`          // 参考常量定义 候选人的审核状态
+	RegisteredBy   string `json:"registered_by"`   // 登记者的MSP ID
+	RegisteredAt   string `json:"registered_at"`   // 登记时间
+	Reviewer       string `json:"reviewer"`        // 审核者的MSP ID
+	ReviewedAt     string `json:"reviewed_at"`     // 审核时间
+}
+
+// 读取投票定义 并校验投票尚未开始 候选人列表在投票开始后冻结
+func getPendingPoll(stub shim.ChaincodeStubInterface, pollID string) (Poll, error) {
+	poll, err := getPoll(stub, pollID)
+	if err != nil {
+		return Poll{}, err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return Poll{}, err
+	}
+	if poll.status(now) != PollPending {
+		return Poll{}, fmt.Errorf("投票已经开始 候选人列表不能再修改 %s", pollID)
+	}
+	return poll, nil
+}
+
+// 校验调用者是否是投票的管理员
+func requirePollAdmin(stub shim.ChaincodeStubInterface, poll Poll) (string, error) {
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("获取调用者MSP ID失败")
+	}
+	if !contains(poll.Admins, mspID) {
+		return "", fmt.Errorf("组织 %s 不是投票 %s 的管理员", mspID, poll.PollID)
+	}
+	return mspID, nil
+}
+
+// 登记候选人
+// 投票开始之前可以登记 登记后需要投票的管理员审核通过才会进入候选人列表
+// 入参列表
+//
+//	poll_id 投票ID
+//	candidate 候选人信息 json string
+//
+// 范例 ["invoke", "registerCandidate", "2024-board", "{\"candidate_id\":\"alice\",\"name\":\"Alice\",\"description\":\"现任理事\",\"attachment_hash\":\"9f86d081884c7d65\"}"]
+func registerCandidate(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	candidate := Candidate{}
+	err = json.Unmarshal([]byte(args[1]), &candidate)
+	if err != nil {
+		return "", fmt.Errorf("无法将候选人信息转换为候选人对象 %s", args[1])
+	}
+	if candidate.CandidateID == "" || candidate.Name == "" {
+		return "", fmt.Errorf("候选人ID和姓名不能为空")
+	}
+
+	poll, err := getPendingPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+	if poll.Proposal {
+		return "", fmt.Errorf("治理提案的选项固定为 %s 和 %s", ProposalApprove, ProposalReject)
+	}
+
+	found, err := state.GetCompositeJSON(stub, candidateObjectType, []string{poll.PollID, candidate.CandidateID}, &Candidate{})
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return "", fmt.Errorf("候选人已经登记 %s", candidate.CandidateID)
+	}
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("获取调用者MSP ID失败")
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	candidate.PollID = poll.PollID
+	candidate.Status = CandidatePending
+	candidate.RegisteredBy = mspID
+	candidate.RegisteredAt = now.Format(time.RFC3339)
+	candidate.Reviewer = ""
+	candidate.ReviewedAt = ""
+
+	err = state.PutCompositeJSON(stub, candidateObjectType, []string{poll.PollID, candidate.CandidateID}, candidate)
+	if err != nil {
+		return "", err
+	}
+
+	return candidate.CandidateID, nil
+}
+
+// 审核候选人 只有投票的管理员可以调用
+// 投票开始之前可以重新审核 审核通过的候选人加入候选人列表 审核不通过时从列表中移除
+// 入参列表
+//
+//	poll_id 投票ID
+//	candidate_id 候选人ID
+//	agree 是否同意 0不同意 1同意
+//
+// 范例 ["invoke", "approveCandidate", "2024-board", "alice", "1"]
+func approveCandidate(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 3)
+	if err != nil {
+		return "", err
+	}
+	if args[2] != Agree && args[2] != Reject {
+		return "", fmt.Errorf("审核结果错误 需要是 %s 或 %s  %s", Agree, Reject, args[2])
+	}
+
+	poll, err := getPendingPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+	if poll.Proposal {
+		return "", fmt.Errorf("治理提案的选项固定为 %s 和 %s", ProposalApprove, ProposalReject)
+	}
+
+	mspID, err := requirePollAdmin(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	candidate := Candidate{}
+	found, err := state.GetCompositeJSON(stub, candidateObjectType, []string{poll.PollID, args[1]}, &candidate)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("候选人没有登记 %s", args[1])
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+	candidate.Reviewer = mspID
+	candidate.ReviewedAt = now.Format(time.RFC3339)
+
+	candidates := []string{}
+	for _, c := range poll.Candidates {
+		if c != candidate.CandidateID {
+			candidates = append(candidates, c)
+		}
+	}
+	if args[2] == Agree {
+		candidate.Status = CandidateApproved
+		candidates = append(candidates, candidate.CandidateID)
+	} else {
+		candidate.Status = CandidateRejected
+	}
+	poll.Candidates = candidates
+
+	err = state.PutCompositeJSON(stub, candidateObjectType, []string{poll.PollID, candidate.CandidateID}, candidate)
+	if err != nil {
+		return "", err
+	}
+	err = state.PutCompositeJSON(stub, pollObjectType, []string{poll.PollID}, poll)
+	if err != nil {
+		return "", err
+	}
+
+	return candidate.Status, nil
+}
+
+// 查询投票的候选人登记信息 按候选人ID排序
+// 入参列表
+//
+//	poll_id 投票ID
+//	status 只返回该审核状态的候选人 可选 pending/approved/rejected
+//
+// 范例 ["query", "listCandidates", "2024-board"]
+// 范例 ["query", "listCandidates", "2024-board", "pending"]
+func listCandidates(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 1, 2)
+	if err != nil {
+		return "", err
+	}
+
+	status := params.Optional(args, 1, "")
+	if status != "" && status != CandidatePending && status != CandidateApproved && status != CandidateRejected {
+		return "", fmt.Errorf("候选人审核状态错误 %s", status)
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	resultIterator, err := stub.GetStateByPartialCompositeKey(candidateObjectType, []string{poll.PollID})
+	if err != nil {
+		return "", fmt.Errorf("获取候选人列表失败 %s", poll.PollID)
+	}
+	defer resultIterator.Close()
+
+	candidates := []Candidate{}
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("获取候选人列表失败 %s", poll.PollID)
+		}
+
+		candidate := Candidate{}
+		err = json.Unmarshal(queryResult.Value, &candidate)
+		if err != nil {
+			return "", fmt.Errorf("json串转换为对象失败 %s", queryResult.Key)
+		}
+
+		if status == "" || candidate.Status == status {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	candidatesAsBytes, err := json.Marshal(candidates)
+	if err != nil {
+		return "", fmt.Errorf("无法将候选人列表转换为Json字符串")
+	}
+	return string(candidatesAsBytes), nil
+}
@@ -0,0 +1,419 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 委托的范围
+const (
+	ScopePoll  = "poll"  // 只对一次投票有效
+	ScopeTopic = "topic" // 对同一主题的全部投票有效
+)
+
+// 委托链的解析结果
+const (
+	ChainDirect     = "direct"     // 投票者自己投了票 委托不生效
+	ChainDelegated  = "delegated"  // 沿委托链找到了投票的受托人
+	ChainUnresolved = "unresolved" // 委托链上没有人投票 选票不计入结果
+	ChainCycle      = "cycle"      // 委托链形成循环 选票不计入结果
+)
+
+// 投票者把选票委托给另一个投票者
+// 按投票的委托覆盖同一投票者按主题的委托
+// 按主题的委托使用证书ID识别委托人 只对没有设置 voter_attribute 和资格属性的投票生效 对治理提案不生效
+type Delegation struct {
+	Scope     string `json:"scope"`     // 参考常量定义 委托的范围
+	Target    string `json:"target"`    // 范围是 poll 时为投票ID 范围是 topic 时为主题
+	Delegator string `json:"delegator"` // 委托人 参考 voterID
+	MSPID     string `json:"msp_id"`    // 委托人的MSP ID
+	Delegate  string `json:"delegate"`  // 受托人 与 getBallot 返回的 voter 写法相同
+	TxID      string `json:"tx_id"`     // 委托的交易ID
+	Time      string `json:"time"`      // 委托的时间
+}
+
+// 投票者的委托链
+type DelegateChain struct {
+	Voter    string   `json:"voter"`    // 投票者
+	Chain    []string `json:"chain"`    // 从投票者开始依次经过的受托人
+	Resolved string   `json:"resolved"` // 最终代为投票的人 没有计入结果时为空
+	Status   string   `json:"status"`   // 参考常量定义 委托链的解析结果
+}
+
+// 读取一个范围内的全部委托 以委托人为键
+func getDelegations(stub shim.ChaincodeStubInterface, scope string, target string) (map[string]Delegation, error) {
+	resultIterator, err := stub.GetStateByPartialCompositeKey(delegationObjectType, []string{scope, target})
+	if err != nil {
+		return nil, fmt.Errorf("获取委托失败 %s %s", scope, target)
+	}
+	defer resultIterator.Close()
+
+	delegations := map[string]Delegation{}
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("获取委托失败 %s %s", scope, target)
+		}
+
+		delegation := Delegation{}
+		err = json.Unmarshal(queryResult.Value, &delegation)
+		if err != nil {
+			return nil, fmt.Errorf("json串转换为对象失败 %s", queryResult.Key)
+		}
+		delegations[delegation.Delegator] = delegation
+	}
+
+	return delegations, nil
+}
+
+// 对一次投票生效的委托 主题的委托先生效 再用按投票的委托覆盖
+// 按主题委托时无法校验委托人的证书属性 投票设置了资格属性时只校验组织
+func effectiveDelegations(stub shim.ChaincodeStubInterface, poll Poll) (map[string]Delegation, error) {
+	delegations := map[string]Delegation{}
+
+	if poll.Topic != "" && !poll.Proposal && poll.VoterAttribute == "" && poll.Eligibility.Attribute == "" {
+		topic, err := getDelegations(stub, ScopeTopic, poll.Topic)
+		if err != nil {
+			return nil, err
+		}
+		for delegator, delegation := range topic {
+			if len(poll.Eligibility.MSPs) == 0 || contains(poll.Eligibility.MSPs, delegation.MSPID) {
+				delegations[delegator] = delegation
+			}
+		}
+	}
+
+	own, err := getDelegations(stub, ScopePoll, poll.PollID)
+	if err != nil {
+		return nil, err
+	}
+	for delegator, delegation := range own {
+		delegations[delegator] = delegation
+	}
+
+	return delegations, nil
+}
+
+// 沿委托链查找代为投票的人
+// 投过票的投票者自己的委托不生效 否则继续查找受托人 受托人没有投票时继续查找受托人的委托
+func resolveDelegate(delegations map[string]Delegation, voted map[string]bool, voter string) DelegateChain {
+	chain := DelegateChain{Voter: voter, Chain: []string{voter}}
+	visited := map[string]bool{voter: true}
+
+	current := voter
+	for {
+		if voted[current] {
+			chain.Resolved = current
+			chain.Status = ChainDelegated
+			if current == voter {
+				chain.Status = ChainDirect
+			}
+			return chain
+		}
+
+		delegation, found := delegations[current]
+		if !found {
+			chain.Status = ChainUnresolved
+			return chain
+		}
+
+		current = delegation.Delegate
+		chain.Chain = append(chain.Chain, current)
+		if visited[current] {
+			chain.Status = ChainCycle
+			return chain
+		}
+		visited[current] = true
+	}
+}
+
+// 委托后会不会形成循环 形成循环时返回循环经过的投票者
+func delegationCycle(delegations map[string]Delegation, delegator string, delegate string) []string {
+	chain := []string{delegator, delegate}
+	current := delegate
+	for len(chain) <= len(delegations)+2 {
+		if current == delegator {
+			return chain
+		}
+		delegation, found := delegations[current]
+		if !found {
+			return nil
+		}
+		current = delegation.Delegate
+		chain = append(chain, current)
+	}
+	return nil
+}
+
+// 按委托把受托人的选票复制给委托人 返回委托产生的选票 按委托人排序
+// weighted 计票方式下委托人的权重来自 setVoterWeights 登记的权重 没有登记的委托人不计入结果
+func delegatedBallots(stub shim.ChaincodeStubInterface, poll Poll, ballots []Ballot) ([]Ballot, error) {
+	delegations, err := effectiveDelegations(stub, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	voted := map[string]bool{}
+	byVoter := map[string]Ballot{}
+	for _, ballot := range ballots {
+		voted[ballot.Voter] = true
+		byVoter[ballot.Voter] = ballot
+	}
+
+	delegators := []string{}
+	for delegator := range delegations {
+		delegators = append(delegators, delegator)
+	}
+	sort.Strings(delegators)
+
+	delegated := []Ballot{}
+	for _, delegator := range delegators {
+		chain := resolveDelegate(delegations, voted, delegator)
+		if chain.Status != ChainDelegated {
+			continue
+		}
+
+		weight := 1.0
+		if poll.Method == Weighted {
+			w, found, err := registeredWeight(stub, poll.PollID, delegator)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				continue
+			}
+			weight = w
+		}
+
+		resolved := byVoter[chain.Resolved]
+		delegated = append(delegated, Ballot{
+			PollID:    poll.PollID,
+			Voter:     delegator,
+			MSPID:     delegations[delegator].MSPID,
+			Candidate: resolved.Candidate,
+			Choices:   resolved.choices(),
+			Weight:    weight,
+			TxID:      delegations[delegator].TxID,
+			Time:      delegations[delegator].Time,
+		})
+	}
+
+	return delegated, nil
+}
+
+// 校验委托的范围 返回委托人和用于检测循环的委托
+func delegationScope(stub shim.ChaincodeStubInterface, scope string, target string) (string, map[string]Delegation, error) {
+	if target == "" {
+		return "", nil, fmt.Errorf("投票ID或主题不能为空")
+	}
+
+	switch scope {
+	case ScopePoll:
+		poll, err := getPoll(stub, target)
+		if err != nil {
+			return "", nil, err
+		}
+		now, err := txTime(stub)
+		if err != nil {
+			return "", nil, err
+		}
+		status := poll.status(now)
+		if status != PollPending && status != PollOpen {
+			return "", nil, fmt.Errorf("投票已经结束 不能修改委托 %s", poll.PollID)
+		}
+		if poll.Method == Weighted && poll.WeightAttribute != "" {
+			return "", nil, fmt.Errorf("投票 %s 的权重来自证书属性 %s 不支持委托", poll.PollID, poll.WeightAttribute)
+		}
+		err = poll.Eligibility.check(stub)
+		if err != nil {
+			return "", nil, err
+		}
+		delegator, err := voterID(stub, poll)
+		if err != nil {
+			return "", nil, err
+		}
+		delegations, err := effectiveDelegations(stub, poll)
+		if err != nil {
+			return "", nil, err
+		}
+		return delegator, delegations, nil
+	case ScopeTopic:
+		delegator, err := voterID(stub, Poll{})
+		if err != nil {
+			return "", nil, err
+		}
+		delegations, err := getDelegations(stub, ScopeTopic, target)
+		if err != nil {
+			return "", nil, err
+		}
+		return delegator, delegations, nil
+	}
+
+	return "", nil, fmt.Errorf("委托范围错误 需要是 %s 或 %s  %s", ScopePoll, ScopeTopic, scope)
+}
+
+// 把选票委托给另一个投票者 再次委托时覆盖原来的委托
+// 按投票委托时需要在投票结束前 委托人需要有投票资格 按主题委托时随时可以委托
+// 委托人自己投票时委托不生效 受托人没有投票时沿受托人的委托继续查找 计票时才解析委托链
+// 入参列表
+//
+//	scope 委托范围 poll/topic
+//	target 范围是 poll 时为投票ID 范围是 topic 时为主题
+//	delegate 受托人 与 getBallot 返回的 voter 写法相同
+//
+// 范例 ["invoke", "delegate", "poll", "2024-board", "Org1MSP/S2024001"]
+// 范例 ["invoke", "delegate", "topic", "budget", "Org2MSP/eDUwOTo6Q049..."]
+func delegate(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 3)
+	if err != nil {
+		return "", err
+	}
+	if args[2] == "" {
+		return "", fmt.Errorf("受托人不能为空")
+	}
+
+	delegator, delegations, err := delegationScope(stub, args[0], args[1])
+	if err != nil {
+		return "", err
+	}
+	if args[2] == delegator {
+		return "", fmt.Errorf("不能委托给自己 %s", delegator)
+	}
+
+	cycle := delegationCycle(delegations, delegator, args[2])
+	if cycle != nil {
+		return "", fmt.Errorf("委托形成循环 %s", strings.Join(cycle, " -> "))
+	}
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("获取调用者MSP ID失败")
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	delegation := Delegation{
+		Scope:     args[0],
+		Target:    args[1],
+		Delegator: delegator,
+		MSPID:     mspID,
+		Delegate:  args[2],
+		TxID:      stub.GetTxID(),
+		Time:      now.Format(time.RFC3339),
+	}
+	err = state.PutCompositeJSON(stub, delegationObjectType, []string{args[0], args[1], delegator}, delegation)
+	if err != nil {
+		return "", err
+	}
+
+	delegationAsBytes, err := json.Marshal(delegation)
+	if err != nil {
+		return "", fmt.Errorf("无法将委托转换为Json字符串")
+	}
+	return string(delegationAsBytes), nil
+}
+
+// 撤销调用者的委托 返回原来的受托人
+// 入参列表
+//
+//	scope 委托范围 poll/topic
+//	target 范围是 poll 时为投票ID 范围是 topic 时为主题
+//
+// 范例 ["invoke", "revokeDelegation", "poll", "2024-board"]
+func revokeDelegation(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	delegator, _, err := delegationScope(stub, args[0], args[1])
+	if err != nil {
+		return "", err
+	}
+
+	delegation := Delegation{}
+	found, err := state.GetCompositeJSON(stub, delegationObjectType, []string{args[0], args[1], delegator}, &delegation)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("没有找到委托 %s %s %s", args[0], args[1], delegator)
+	}
+
+	key, err := stub.CreateCompositeKey(delegationObjectType, []string{args[0], args[1], delegator})
+	if err != nil {
+		return "", fmt.Errorf("创建复合键失败 %s %s", delegationObjectType, delegator)
+	}
+	err = stub.DelState(key)
+	if err != nil {
+		return "", fmt.Errorf("删除账本状态失败 %s", key)
+	}
+
+	return delegation.Delegate, nil
+}
+
+// 查询投票中委托人的委托链 按委托人排序
+// 委托链按查询时已有的选票解析 投票结束前结果还会变化 秘密投票在公布期结束之前不能查询
+// 入参列表
+//
+//	poll_id 投票ID
+//	voter 只查询该投票者 可选 默认查询全部委托人
+//
+// 范例 ["query", "getDelegationChain", "2024-board"]
+// 范例 ["query", "getDelegationChain", "2024-board", "Org1MSP/S2024001"]
+func getDelegationChain(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 1, 2)
+	if err != nil {
+		return "", err
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	delegations, err := effectiveDelegations(stub, poll)
+	if err != nil {
+		return "", err
+	}
+	ballots, err := getBallots(stub, poll)
+	if err != nil {
+		return "", err
+	}
+	voted := map[string]bool{}
+	for _, ballot := range ballots {
+		voted[ballot.Voter] = true
+	}
+
+	voters := []string{}
+	voter := params.Optional(args, 1, "")
+	if voter != "" {
+		voters = append(voters, voter)
+	} else {
+		for delegator := range delegations {
+			voters = append(voters, delegator)
+		}
+		sort.Strings(voters)
+	}
+
+	chains := []DelegateChain{}
+	for _, v := range voters {
+		chains = append(chains, resolveDelegate(delegations, voted, v))
+	}
+
+	chainsAsBytes, err := json.Marshal(chains)
+	if err != nil {
+		return "", fmt.Errorf("无法将委托链转换为Json字符串")
+	}
+	return string(chainsAsBytes), nil
+}
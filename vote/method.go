@@ -0,0 +1,159 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 投票者的权重 只用于 weighted 计票方式
+type VoterWeight struct {
+	PollID string  `json:"poll_id"` // 投票ID
+	Voter  string  `json:"voter"`   // 投票者 参考 voterID
+	Weight float64 `json:"weight"`  // 权重 例如持股数量
+}
+
+// 解析选票内容
+// plurality 和 weighted 只能选一个候选人
+// ranked 传入按偏好排序的候选人数组 可以只排前几位
+// approval 传入认可的候选人数组
+// ranked 和 approval 只选一个候选人时也可以直接传候选人
+func (p *Poll) parseChoices(value string) ([]string, error) {
+	choices := []string{value}
+	if (p.Method == Ranked || p.Method == Approval) && strings.HasPrefix(value, "[") {
+		err := json.Unmarshal([]byte(value), &choices)
+		if err != nil {
+			return nil, fmt.Errorf("无法将选票转换为候选人数组 %s", value)
+		}
+		if len(choices) == 0 {
+			return nil, fmt.Errorf("选票中至少需要一个候选人")
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, choice := range choices {
+		if !p.hasCandidate(choice) {
+			return nil, fmt.Errorf("候选人不在投票 %s 的候选人列表中 %s", p.PollID, choice)
+		}
+		if seen[choice] {
+			return nil, fmt.Errorf("选票中的候选人重复 %s", choice)
+		}
+		seen[choice] = true
+	}
+
+	return choices, nil
+}
+
+// 选票在实时得票中计入的候选人
+// ranked 只计第一偏好 最终结果由 finalizePoll 按轮次计算
+func (p *Poll) countedChoices(choices []string) []string {
+	if p.Method == Approval {
+		return choices
+	}
+	return choices[:1]
+}
+
+// 投票者的权重 不是 weighted 计票方式时为1
+// 投票设置了 weight_attribute 时从证书属性读取 否则从管理员登记的权重中读取
+func voterWeight(stub shim.ChaincodeStubInterface, poll Poll, voter string) (float64, error) {
+	if poll.Method != Weighted {
+		return 1, nil
+	}
+
+	if poll.WeightAttribute != "" {
+		value, found, err := cid.GetAttributeValue(stub, poll.WeightAttribute)
+		if err != nil {
+			return 0, fmt.Errorf("获取调用者证书属性失败 %s", poll.WeightAttribute)
+		}
+		if !found {
+			return 0, fmt.Errorf("调用者证书没有权重属性 %s", poll.WeightAttribute)
+		}
+		return params.PositiveFloat(value, "投票权重")
+	}
+
+	weight, found, err := registeredWeight(stub, poll.PollID, voter)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("投票者没有登记投票权重 %s", voter)
+	}
+	return weight, nil
+}
+
+// 管理员通过 setVoterWeights 登记的权重
+func registeredWeight(stub shim.ChaincodeStubInterface, pollID string, voter string) (float64, bool, error) {
+	weight := VoterWeight{}
+	found, err := state.GetCompositeJSON(stub, weightObjectType, []string{pollID, voter}, &weight)
+	if err != nil {
+		return 0, false, err
+	}
+	return weight.Weight, found, nil
+}
+
+// 登记投票者的权重 只有投票的管理员可以在投票开始之前调用
+// 投票者的写法与 getBallot 返回的 voter 一致 再次登记时覆盖原来的权重
+// 入参列表
+//
+//	poll_id 投票ID
+//	weights 投票者到权重的映射 json string
+//
+// 范例 ["invoke", "setVoterWeights", "2024-board", "{\"Org1MSP/S2024001\":100,\"Org2MSP/S2024002\":30}"]
+func setVoterWeights(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	weights := map[string]float64{}
+	err = json.Unmarshal([]byte(args[1]), &weights)
+	if err != nil {
+		return "", fmt.Errorf("无法将投票权重转换为映射 %s", args[1])
+	}
+
+	poll, err := getPendingPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+	if poll.Method != Weighted {
+		return "", fmt.Errorf("投票 %s 的计票方式是 %s 不使用权重", poll.PollID, poll.Method)
+	}
+	if poll.WeightAttribute != "" {
+		return "", fmt.Errorf("投票 %s 的权重来自证书属性 %s", poll.PollID, poll.WeightAttribute)
+	}
+
+	_, err = requirePollAdmin(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	// map 的遍历顺序不固定 按投票者排序后再校验 各背书节点返回相同的错误
+	voters := []string{}
+	for voter := range weights {
+		voters = append(voters, voter)
+	}
+	sort.Strings(voters)
+
+	for _, voter := range voters {
+		if voter == "" || weights[voter] <= 0 {
+			return "", fmt.Errorf("投票权重需要是正数  %s, %v", voter, weights[voter])
+		}
+	}
+
+	for _, voter := range voters {
+		weight := VoterWeight{PollID: poll.PollID, Voter: voter, Weight: weights[voter]}
+		err = state.PutCompositeJSON(stub, weightObjectType, []string{poll.PollID, voter}, weight)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strconv.Itoa(len(voters)), nil
+}
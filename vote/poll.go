@@ -0,0 +1,451 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 复合键前缀 每个投票的数据都以投票ID作为第一个属性 不同投票之间互不影响
+const (
+	pollObjectType       = "poll"       // 投票定义 poll~投票ID
+	voteObjectType       = "vote"       // 候选人得票 vote~投票ID~候选人
+	ballotObjectType     = "ballot"     // 选票 ballot~投票ID~投票者
+	candidateObjectType  = "candidate"  // 候选人登记信息 candidate~投票ID~候选人
+	weightObjectType     = "weight"     // 投票者权重 weight~投票ID~投票者
+	commitObjectType     = "commit"     // 秘密投票的承诺 commit~投票ID~投票者
+	commitHashObjectType = "commithash" // 承诺哈希的索引 commithash~投票ID~哈希
+	delegationObjectType = "delegation" // 委托 delegation~范围~投票ID或主题~委托人
+	proposalObjectType   = "proposal"   // 治理提案 proposal~提案ID
+	resultObjectType     = "result"     // 计票结果 result~投票ID
+)
+
+// 计票方式
+const (
+	Plurality = "plurality" // 简单多数 每票给一个候选人加1
+	Approval  = "approval"  // 认可投票 每票可以选多个候选人 每个加1
+	Ranked    = "ranked"    // 排序复选 即时决选 每轮淘汰得票最少的候选人 直到有人过半
+	Weighted  = "weighted"  // 加权投票 每票给一个候选人加上投票者的权重
+)
+
+// 支持的计票方式
+var methods = map[string]bool{
+	Plurality: true,
+	Approval:  true,
+	Ranked:    true,
+	Weighted:  true,
+}
+
+// 投票的状态 由交易时间和投票的起止时间决定
+const (
+	PollPending   = "pending"   // 尚未开始
+	PollOpen      = "open"      // 进行中 秘密投票在这个阶段提交承诺
+	PollRevealing = "revealing" // 秘密投票的公布期 投票者公布选票
+	PollClosed    = "closed"    // 已经结束 秘密投票在公布期结束后才结束
+)
+
+// 投票资格
+// 两项都设置时需要同时满足
+type Eligibility struct {
+	MSPs      []string `json:"msps"`      // 可以投票的组织MSP ID列表 为空时不限制
+	Attribute string   `json:"attribute"` // 投票者证书需要带有的属性 为空时不限制 例如 role
+	Values    []string `json:"values"`    // 属性允许的取值 为空时只要求证书带有该属性
+}
+
+// 一次投票
+type Poll struct {
+	PollID          string      `json:"poll_id"`          // 投票ID
+	Title           string      `json:"title"`            // 标题
+	Candidates      []string    `json:"candidates"`       // 候选人列表 创建时传入或者登记后审核通过 投票开始后不再变化
+	StartTime       string      `json:"start_time"`       // 开始时间 RFC3339 包含
+	EndTime         string      `json:"end_time"`         // 结束时间 RFC3339 不包含
+	Eligibility     Eligibility `json:"eligibility"`      // 投票资格
+	Method          string      `json:"method"`           // 计票方式 参考常量定义 为空时为 plurality
+	AllowChange     bool        `json:"allow_change"`     // 是否允许投票者在投票结束前改票
+	VoterAttribute  string      `json:"voter_attribute"`  // 用来识别投票者的证书属性 例如学号 为空时使用证书ID
+	Secret          bool        `json:"secret"`           // 秘密投票 投票期内只提交选票的哈希 结束后在公布期公布
+	RevealEndTime   string      `json:"reveal_end_time"`  // 秘密投票公布期的结束时间 RFC3339 公布期从投票结束时间开始
+	Topic           string      `json:"topic"`            // 投票的主题 按主题的委托对同一主题的投票都有效 为空时只使用按投票的委托
+	WeightAttribute string      `json:"weight_attribute"` // weighted 计票方式下存放权重的证书属性 为空时使用 setVoterWeights 登记的权重
+	Proposal        bool        `json:"proposal"`         // 是否是治理提案 只能由 createProposal 创建 每个组织一票
+	Rules           Rules       `json:"rules"`            // 投票通过的规则 finalizePoll 按规则得出结论
+	Admins          []string    `json:"admins"`           // 投票的管理员MSP ID列表 负责审核候选人 为空时为创建者
+	Creator         string      `json:"creator"`          // 创建者的MSP ID
+	CreatedAt       string      `json:"created_at"`       // 创建时间
+}
+
+// 投票列表中的一项 附带查询时的状态
+type PollSummary struct {
+	Poll
+	Status string `json:"status"` // 参考常量定义 投票的状态
+}
+
+func parseTime(value string, name string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s需要是RFC3339格式的时间  %s", name, value)
+	}
+	return t, nil
+}
+
+// 交易时间 所有背书节点看到的值一致
+func txTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	timestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("获取交易时间失败")
+	}
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC(), nil
+}
+
+// 校验投票定义 并补充默认值
+func (p *Poll) validate() error {
+	if p.PollID == "" {
+		return fmt.Errorf("投票ID不能为空")
+	}
+	if p.Title == "" {
+		return fmt.Errorf("投票标题不能为空")
+	}
+	if p.Candidates == nil {
+		p.Candidates = []string{}
+	}
+
+	seen := map[string]bool{}
+	for _, candidate := range p.Candidates {
+		if candidate == "" {
+			return fmt.Errorf("候选人不能为空")
+		}
+		if seen[candidate] {
+			return fmt.Errorf("候选人重复 %s", candidate)
+		}
+		seen[candidate] = true
+	}
+
+	start, err := parseTime(p.StartTime, "开始时间")
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(p.EndTime, "结束时间")
+	if err != nil {
+		return err
+	}
+	if !end.After(start) {
+		return fmt.Errorf("结束时间需要晚于开始时间  %s, %s", p.StartTime, p.EndTime)
+	}
+
+	if p.Secret {
+		revealEnd, err := parseTime(p.RevealEndTime, "公布期结束时间")
+		if err != nil {
+			return err
+		}
+		if !revealEnd.After(end) {
+			return fmt.Errorf("公布期结束时间需要晚于投票结束时间  %s, %s", p.EndTime, p.RevealEndTime)
+		}
+	} else if p.RevealEndTime != "" {
+		return fmt.Errorf("只有秘密投票可以设置公布期")
+	}
+
+	if p.Method == "" {
+		p.Method = Plurality
+	}
+	if !methods[p.Method] {
+		return fmt.Errorf("不支持的计票方式 %s", p.Method)
+	}
+
+	if p.WeightAttribute != "" && p.Method != Weighted {
+		return fmt.Errorf("只有 weighted 计票方式可以设置权重属性")
+	}
+
+	err = p.Rules.validate()
+	if err != nil {
+		return err
+	}
+
+	if len(p.Eligibility.Values) > 0 && p.Eligibility.Attribute == "" {
+		return fmt.Errorf("设置了属性取值时需要指定属性名")
+	}
+
+	return nil
+}
+
+// 投票在某个时间的状态 开始 结束和公布期结束时间在创建时已经校验过
+func (p *Poll) status(now time.Time) string {
+	start, _ := time.Parse(time.RFC3339, p.StartTime)
+	end, _ := time.Parse(time.RFC3339, p.EndTime)
+	if now.Before(start) {
+		return PollPending
+	}
+	if now.Before(end) {
+		return PollOpen
+	}
+	if p.Secret {
+		revealEnd, _ := time.Parse(time.RFC3339, p.RevealEndTime)
+		if now.Before(revealEnd) {
+			return PollRevealing
+		}
+	}
+	return PollClosed
+}
+
+// 投票进入 closed 状态的时间 秘密投票为公布期结束时间
+func (p *Poll) closeTime() string {
+	if p.Secret {
+		return p.RevealEndTime
+	}
+	return p.EndTime
+}
+
+func (p *Poll) hasCandidate(candidate string) bool {
+	for _, c := range p.Candidates {
+		if c == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// 校验交易提交者是否有资格参与投票
+func (e Eligibility) check(stub shim.ChaincodeStubInterface) error {
+	if len(e.MSPs) > 0 {
+		mspID, err := cid.GetMSPID(stub)
+		if err != nil {
+			return fmt.Errorf("获取调用者MSP ID失败")
+		}
+		if !contains(e.MSPs, mspID) {
+			return fmt.Errorf("组织 %s 没有投票资格", mspID)
+		}
+	}
+
+	if e.Attribute != "" {
+		value, found, err := cid.GetAttributeValue(stub, e.Attribute)
+		if err != nil {
+			return fmt.Errorf("获取调用者证书属性失败 %s", e.Attribute)
+		}
+		if !found {
+			return fmt.Errorf("调用者证书没有属性 %s 没有投票资格", e.Attribute)
+		}
+		if len(e.Values) > 0 && !contains(e.Values, value) {
+			return fmt.Errorf("调用者证书属性 %s=%s 没有投票资格", e.Attribute, value)
+		}
+	}
+
+	return nil
+}
+
+// 读取投票定义 不存在时返回错误
+func getPoll(stub shim.ChaincodeStubInterface, pollID string) (Poll, error) {
+	poll := Poll{}
+	found, err := state.GetCompositeJSON(stub, pollObjectType, []string{pollID}, &poll)
+	if err != nil {
+		return Poll{}, err
+	}
+	if !found {
+		return Poll{}, fmt.Errorf("投票不存在 %s", pollID)
+	}
+	return poll, nil
+}
+
+// 读取投票定义 并校验投票正在进行中
+func getOpenPoll(stub shim.ChaincodeStubInterface, pollID string) (Poll, error) {
+	poll, err := getPoll(stub, pollID)
+	if err != nil {
+		return Poll{}, err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return Poll{}, err
+	}
+
+	switch poll.status(now) {
+	case PollPending:
+		return Poll{}, fmt.Errorf("投票尚未开始 %s 开始时间 %s", pollID, poll.StartTime)
+	case PollRevealing, PollClosed:
+		return Poll{}, fmt.Errorf("投票已经结束 %s 结束时间 %s", pollID, poll.EndTime)
+	}
+	return poll, nil
+}
+
+// 创建投票
+// 投票ID不能重复 创建者的MSP ID和创建时间由链码记录
+// 创建时传入的候选人视为已经审核通过 其他候选人在投票开始之前通过 registerCandidate 登记
+// 规则中的得票比例按容差比较 0.6667 表示至少三分之二 threshold 0.5 加上 strict 表示过半
+// 入参列表
+//
+//	poll 投票定义 json string
+//
+// 范例 ["invoke", "createPoll", "{\"poll_id\":\"2024-board\",\"title\":\"2024年理事会选举\",\"candidates\":[\"alice\",\"bob\"],\"start_time\":\"2024-01-01T00:00:00Z\",\"end_time\":\"2024-01-08T00:00:00Z\",\"eligibility\":{\"msps\":[\"Org1MSP\",\"Org2MSP\"]},\"method\":\"plurality\"}"]
+// 范例 ["invoke", "createPoll", "{\"poll_id\":\"2024-charter\",\"title\":\"章程修改\",\"candidates\":[\"yes\",\"no\"],\"start_time\":\"2024-02-01T00:00:00Z\",\"end_time\":\"2024-02-08T00:00:00Z\",\"rules\":{\"quorum\":20,\"threshold\":0.6667,\"tie_break\":\"fail\"}}"]
+func createPoll(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	poll := Poll{}
+	err = json.Unmarshal([]byte(args[0]), &poll)
+	if err != nil {
+		return "", fmt.Errorf("无法将投票定义转换为投票对象 %s", args[0])
+	}
+
+	if poll.Proposal {
+		return "", fmt.Errorf("治理提案需要通过 createProposal 创建")
+	}
+
+	poll, err = putNewPoll(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	return poll.PollID, nil
+}
+
+// 校验并写入新的投票 创建时传入的候选人同时登记为审核通过
+func putNewPoll(stub shim.ChaincodeStubInterface, poll Poll) (Poll, error) {
+	err := poll.validate()
+	if err != nil {
+		return Poll{}, err
+	}
+
+	found, err := state.GetCompositeJSON(stub, pollObjectType, []string{poll.PollID}, &Poll{})
+	if err != nil {
+		return Poll{}, err
+	}
+	if found {
+		return Poll{}, fmt.Errorf("投票已经存在 %s", poll.PollID)
+	}
+
+	poll.Creator, err = cid.GetMSPID(stub)
+	if err != nil {
+		return Poll{}, fmt.Errorf("获取调用者MSP ID失败")
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return Poll{}, err
+	}
+	poll.CreatedAt = now.Format(time.RFC3339)
+	if len(poll.Admins) == 0 {
+		poll.Admins = []string{poll.Creator}
+	}
+
+	err = state.PutCompositeJSON(stub, pollObjectType, []string{poll.PollID}, poll)
+	if err != nil {
+		return Poll{}, err
+	}
+
+	for _, candidateID := range poll.Candidates {
+		candidate := Candidate{
+			PollID:       poll.PollID,
+			CandidateID:  candidateID,
+			Name:         candidateID,
+			Status:       CandidateApproved,
+			RegisteredBy: poll.Creator,
+			RegisteredAt: poll.CreatedAt,
+			Reviewer:     poll.Creator,
+			ReviewedAt:   poll.CreatedAt,
+		}
+		err = state.PutCompositeJSON(stub, candidateObjectType, []string{poll.PollID, candidateID}, candidate)
+		if err != nil {
+			return Poll{}, err
+		}
+	}
+
+	return poll, nil
+}
+
+// 查询投票定义
+// 入参列表
+//
+//	poll_id 投票ID
+//
+// 范例 ["query", "getPoll", "2024-board"]
+func queryPoll(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	summaryAsBytes, err := json.Marshal(PollSummary{Poll: poll, Status: poll.status(now)})
+	if err != nil {
+		return "", fmt.Errorf("无法将投票转换为Json字符串 %s", args[0])
+	}
+	return string(summaryAsBytes), nil
+}
+
+// 查询全部投票 按投票ID排序
+// 入参列表
+//
+//	status 只返回该状态的投票 可选 pending/open/revealing/closed
+//
+// 范例 ["query", "listPolls"]
+// 范例 ["query", "listPolls", "open"]
+func listPolls(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 0, 1)
+	if err != nil {
+		return "", err
+	}
+
+	status := params.Optional(args, 0, "")
+	if status != "" && status != PollPending && status != PollOpen && status != PollRevealing && status != PollClosed {
+		return "", fmt.Errorf("投票状态错误 %s", status)
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	resultIterator, err := stub.GetStateByPartialCompositeKey(pollObjectType, []string{})
+	if err != nil {
+		return "", fmt.Errorf("获取投票列表失败")
+	}
+	defer resultIterator.Close()
+
+	polls := []PollSummary{}
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return "", fmt.Errorf("获取投票列表失败")
+		}
+
+		poll := Poll{}
+		err = json.Unmarshal(queryResult.Value, &poll)
+		if err != nil {
+			return "", fmt.Errorf("json串转换为对象失败 %s", queryResult.Key)
+		}
+
+		summary := PollSummary{Poll: poll, Status: poll.status(now)}
+		if status == "" || summary.Status == status {
+			polls = append(polls, summary)
+		}
+	}
+
+	pollsAsBytes, err := json.Marshal(polls)
+	if err != nil {
+		return "", fmt.Errorf("无法将投票列表转换为Json字符串")
+	}
+	return string(pollsAsBytes), nil
+}
@@ -0,0 +1,154 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/governance"
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 治理提案的选项
+const (
+	ProposalApprove = "approve" // 同意
+	ProposalReject  = "reject"  // 反对
+)
+
+// 治理提案 修改 Sxc 链码的策略参数
+// 提案使用同ID的投票表决 计票后同意胜出并且满足投票规则时 Sxc 的 executeProposal 才会执行
+type Proposal struct {
+	ProposalID string                     `json:"proposal_id"` // 提案ID 与投票ID相同
+	Change     governance.ParameterChange `json:"change"`      // 提案的参数修改
+	Proposer   string                     `json:"proposer"`    // 提案者的MSP ID
+	CreatedAt  string                     `json:"created_at"`  // 创建时间
+}
+
+// 创建治理提案和表决的投票
+// 投票的选项固定为 approve 和 reject 每个组织一票 计票方式只能是 plurality 不允许改票
+// 投票资格中的组织需要与 Sxc 的治理组织一致 否则提案通过后也不能执行
+// 投票规则可以比 Sxc 治理配置的最低要求更严格 更宽松时提案通过后也不能执行
+// 入参列表
+//
+//	poll 投票定义 json string 不能设置候选人
+//	change 参数修改 json string 参考 governance.ParameterChange
+//
+// 范例 ["invoke", "createProposal", "{\"poll_id\":\"2024-coverage\",\"title\":\"调整贷款比例\",\"start_time\":\"2024-03-01T00:00:00Z\",\"end_time\":\"2024-03-08T00:00:00Z\",\"eligibility\":{\"msps\":[\"Org1MSP\",\"Org2MSP\"]},\"rules\":{\"quorum\":2,\"threshold\":0.5,\"strict\":true}}", "{\"parameter\":\"coverage\",\"coverage\":{\"max_loan_ratio\":0.8,\"collateral_ratio\":0.1}}"]
+func createProposal(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	poll := Poll{}
+	err = json.Unmarshal([]byte(args[0]), &poll)
+	if err != nil {
+		return "", fmt.Errorf("无法将投票定义转换为投票对象 %s", args[0])
+	}
+	change := governance.ParameterChange{}
+	err = json.Unmarshal([]byte(args[1]), &change)
+	if err != nil {
+		return "", fmt.Errorf("无法将参数修改转换为参数修改对象 %s", args[1])
+	}
+	err = change.Validate()
+	if err != nil {
+		return "", err
+	}
+
+	if len(poll.Candidates) > 0 {
+		return "", fmt.Errorf("治理提案的选项固定为 %s 和 %s 不能设置候选人", ProposalApprove, ProposalReject)
+	}
+	if poll.Method != "" && poll.Method != Plurality {
+		return "", fmt.Errorf("治理提案的计票方式只能是 %s", Plurality)
+	}
+	if poll.Rules.TieBreak == TieCandidateOrder {
+		return "", fmt.Errorf("治理提案平票时不能通过 平票处理方式只能是 %s", TieFail)
+	}
+	if len(poll.Eligibility.MSPs) == 0 {
+		return "", fmt.Errorf("治理提案需要在投票资格中指定可以投票的组织")
+	}
+	// 每个组织一票 允许改票时组织内的任何成员都可以覆盖其他成员的选票
+	if poll.AllowChange {
+		return "", fmt.Errorf("治理提案不允许改票")
+	}
+	poll.Candidates = []string{ProposalApprove, ProposalReject}
+	poll.Proposal = true
+
+	poll, err = putNewPoll(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	mspID, err := cid.GetMSPID(stub)
+	if err != nil {
+		return "", fmt.Errorf("获取调用者MSP ID失败")
+	}
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	proposal := Proposal{ProposalID: poll.PollID, Change: change, Proposer: mspID, CreatedAt: now.Format(time.RFC3339)}
+	err = state.PutCompositeJSON(stub, proposalObjectType, []string{proposal.ProposalID}, proposal)
+	if err != nil {
+		return "", err
+	}
+
+	return proposal.ProposalID, nil
+}
+
+// 查询治理提案和表决结论 Sxc 的 executeProposal 通过 InvokeChaincode 调用
+// 入参列表
+//
+//	proposal_id 提案ID
+//
+// 范例 ["query", "getProposal", "2024-coverage"]
+func getProposal(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	proposal := Proposal{}
+	found, err := state.GetCompositeJSON(stub, proposalObjectType, []string{args[0]}, &proposal)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("提案不存在 %s", args[0])
+	}
+
+	poll, err := getPoll(stub, proposal.ProposalID)
+	if err != nil {
+		return "", err
+	}
+
+	view := governance.Proposal{
+		ProposalID: proposal.ProposalID,
+		Change:     proposal.Change,
+		VoterMSPs:  poll.Eligibility.MSPs,
+	}
+
+	result := PollResult{}
+	found, err = state.GetCompositeJSON(stub, resultObjectType, []string{proposal.ProposalID}, &result)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		view.Status = result.Outcome.Status
+		view.Approved = result.Outcome.Status == OutcomePassed && result.Outcome.Winner == ProposalApprove
+		view.Turnout = result.Outcome.Turnout
+		if view.Approved {
+			view.Share = result.Outcome.Share
+		}
+	}
+
+	viewAsBytes, err := json.Marshal(view)
+	if err != nil {
+		return "", fmt.Errorf("无法将提案转换为Json字符串")
+	}
+	return string(viewAsBytes), nil
+}
@@ -0,0 +1,331 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 计票完成时发出的链码事件名称 其他链码和链下服务按此事件处理投票结果
+const PollFinalizedEvent = "vote.finalized"
+
+// 计票完成事件的内容
+type PollFinalized struct {
+	PollID  string   `json:"poll_id"` // 投票ID
+	Topic   string   `json:"topic"`   // 投票的主题
+	Method  string   `json:"method"`  // 计票方式
+	Winners []string `json:"winners"` // 得票最多的候选人
+	Outcome Outcome  `json:"outcome"` // 按规则得出的结论
+	TxID    string   `json:"tx_id"`   // 计票的交易ID
+}
+
+// 候选人在一轮计票中的票数
+type CandidateTally struct {
+	Candidate string  `json:"candidate"` // 候选人
+	Votes     float64 `json:"votes"`     // 票数 weighted 为加权票数
+}
+
+// 一轮计票
+// plurality approval weighted 只有一轮 ranked 每轮淘汰一个候选人
+type Round struct {
+	Round      int              `json:"round"`      // 轮次 从1开始
+	Tallies    []CandidateTally `json:"tallies"`    // 本轮仍在竞争的候选人 按候选人的顺序
+	Exhausted  float64          `json:"exhausted"`  // 偏好的候选人全部被淘汰的选票 只用于 ranked
+	Eliminated []string         `json:"eliminated"` // 本轮之后淘汰的候选人
+}
+
+// 计票结果 写入后不再修改
+type PollResult struct {
+	PollID      string   `json:"poll_id"`      // 投票ID
+	Method      string   `json:"method"`       // 计票方式
+	Ballots     int      `json:"ballots"`      // 有效选票数量 包含委托产生的选票
+	Delegated   int      `json:"delegated"`    // 委托产生的选票数量
+	Unrevealed  int      `json:"unrevealed"`   // 秘密投票中没有公布的承诺数量 不计入结果
+	TotalWeight float64  `json:"total_weight"` // 选票的总权重 不是 weighted 时等于选票数量
+	Rounds      []Round  `json:"rounds"`       // 每一轮的计票明细
+	Winners     []string `json:"winners"`      // 得票最多的候选人 平票时有多个 没有选票时为空
+	Outcome     Outcome  `json:"outcome"`      // 按投票规则得出的结论
+	TxID        string   `json:"tx_id"`        // 计票的交易ID
+	FinalizedAt string   `json:"finalized_at"` // 计票时间
+}
+
+// 读取投票的全部选票 按投票者排序
+// 全部选票包含其他投票者的选票 秘密投票在公布期结束之前返回错误 参考 requireTalliesVisible
+func getBallots(stub shim.ChaincodeStubInterface, poll Poll) ([]Ballot, error) {
+	err := requireTalliesVisible(stub, poll)
+	if err != nil {
+		return nil, err
+	}
+
+	resultIterator, err := stub.GetStateByPartialCompositeKey(ballotObjectType, []string{poll.PollID})
+	if err != nil {
+		return nil, fmt.Errorf("获取选票失败 %s", poll.PollID)
+	}
+	defer resultIterator.Close()
+
+	ballots := []Ballot{}
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("获取选票失败 %s", poll.PollID)
+		}
+
+		ballot := Ballot{}
+		err = json.Unmarshal(queryResult.Value, &ballot)
+		if err != nil {
+			return nil, fmt.Errorf("json串转换为对象失败 %s", queryResult.Key)
+		}
+		ballots = append(ballots, ballot)
+	}
+
+	return ballots, nil
+}
+
+// 按计票方式计算结果
+// 计算只依赖投票定义和选票 结果与选票的读取顺序无关 各背书节点的结果一致
+func tally(poll Poll, ballots []Ballot) PollResult {
+	result := PollResult{PollID: poll.PollID, Method: poll.Method, Ballots: len(ballots), Winners: []string{}}
+	for _, ballot := range ballots {
+		result.TotalWeight += ballot.weight()
+	}
+
+	if poll.Method == Ranked {
+		result.Rounds, result.Winners = instantRunoff(poll, ballots)
+		return result
+	}
+
+	votes := map[string]float64{}
+	for _, ballot := range ballots {
+		for _, candidate := range poll.countedChoices(ballot.choices()) {
+			votes[candidate] += ballot.weight()
+		}
+	}
+
+	round := Round{Round: 1, Tallies: roundTallies(poll.Candidates, votes), Eliminated: []string{}}
+	result.Rounds = []Round{round}
+	result.Winners = leaders(round.Tallies)
+	return result
+}
+
+// 即时决选
+// 每轮按每张选票中排名最高且没有被淘汰的候选人计票 有候选人超过未用尽选票的一半时当选
+// 否则淘汰得票最少的候选人 得票最少的候选人有多个时淘汰候选人列表中靠后的一个
+// 剩下的候选人得票全部相同时无法继续淘汰 这些候选人并列
+func instantRunoff(poll Poll, ballots []Ballot) ([]Round, []string) {
+	active := append([]string{}, poll.Candidates...)
+	rounds := []Round{}
+
+	for len(active) > 0 {
+		isActive := map[string]bool{}
+		for _, candidate := range active {
+			isActive[candidate] = true
+		}
+
+		round := Round{Round: len(rounds) + 1, Eliminated: []string{}}
+		votes := map[string]float64{}
+		for _, ballot := range ballots {
+			counted := false
+			for _, candidate := range ballot.choices() {
+				if isActive[candidate] {
+					votes[candidate] += ballot.weight()
+					counted = true
+					break
+				}
+			}
+			if !counted {
+				round.Exhausted += ballot.weight()
+			}
+		}
+		round.Tallies = roundTallies(active, votes)
+
+		continuing := 0.0
+		for _, t := range round.Tallies {
+			continuing += t.Votes
+		}
+		if continuing == 0 {
+			rounds = append(rounds, round)
+			return rounds, []string{}
+		}
+
+		for _, t := range round.Tallies {
+			if t.Votes*2 > continuing {
+				rounds = append(rounds, round)
+				return rounds, []string{t.Candidate}
+			}
+		}
+
+		if len(leaders(round.Tallies)) == len(round.Tallies) {
+			rounds = append(rounds, round)
+			return rounds, leaders(round.Tallies)
+		}
+
+		lowest := round.Tallies[len(round.Tallies)-1]
+		for i := len(round.Tallies) - 1; i >= 0; i-- {
+			if round.Tallies[i].Votes < lowest.Votes {
+				lowest = round.Tallies[i]
+			}
+		}
+
+		round.Eliminated = []string{lowest.Candidate}
+		rounds = append(rounds, round)
+
+		remaining := []string{}
+		for _, candidate := range active {
+			if candidate != lowest.Candidate {
+				remaining = append(remaining, candidate)
+			}
+		}
+		active = remaining
+	}
+
+	return rounds, []string{}
+}
+
+// 按候选人的顺序列出票数
+func roundTallies(candidates []string, votes map[string]float64) []CandidateTally {
+	tallies := []CandidateTally{}
+	for _, candidate := range candidates {
+		tallies = append(tallies, CandidateTally{Candidate: candidate, Votes: votes[candidate]})
+	}
+	return tallies
+}
+
+// 票数最多的候选人 没有人得票时为空
+func leaders(tallies []CandidateTally) []string {
+	max := 0.0
+	for _, t := range tallies {
+		if t.Votes > max {
+			max = t.Votes
+		}
+	}
+
+	winners := []string{}
+	if max == 0 {
+		return winners
+	}
+	for _, t := range tallies {
+		if t.Votes == max {
+			winners = append(winners, t.Candidate)
+		}
+	}
+	return winners
+}
+
+// 投票结束后计票 结果写入账本后不能再修改
+// 计票只读取投票定义 选票和委托 任何组织都可以调用 结果相同
+// 没有投票的委托人按委托链计入最终受托人的选票
+// 计票后按投票的规则得出 passed/failed/no-quorum 并发出 PollFinalizedEvent 事件
+// 入参列表
+//
+//	poll_id 投票ID
+//
+// 范例 ["invoke", "finalizePoll", "2024-board"]
+func finalizePoll(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+	if poll.status(now) != PollClosed {
+		return "", fmt.Errorf("投票还没有结束 %s 结束时间 %s", poll.PollID, poll.closeTime())
+	}
+
+	found, err := state.GetCompositeJSON(stub, resultObjectType, []string{poll.PollID}, &PollResult{})
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return "", fmt.Errorf("投票已经计票 结果不能修改 %s", poll.PollID)
+	}
+
+	ballots, err := getBallots(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	delegated, err := delegatedBallots(stub, poll, ballots)
+	if err != nil {
+		return "", err
+	}
+
+	result := tally(poll, append(ballots, delegated...))
+	result.Delegated = len(delegated)
+	if poll.Secret {
+		result.Unrevealed, err = countUnrevealed(stub, poll.PollID)
+		if err != nil {
+			return "", err
+		}
+	}
+	result.TxID = stub.GetTxID()
+	result.FinalizedAt = now.Format(time.RFC3339)
+	result.Outcome = poll.Rules.evaluate(poll, result)
+
+	err = state.PutCompositeJSON(stub, resultObjectType, []string{poll.PollID}, result)
+	if err != nil {
+		return "", err
+	}
+
+	event := PollFinalized{
+		PollID:  poll.PollID,
+		Topic:   poll.Topic,
+		Method:  poll.Method,
+		Winners: result.Winners,
+		Outcome: result.Outcome,
+		TxID:    result.TxID,
+	}
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return "", fmt.Errorf("无法将计票事件转换为Json字符串")
+	}
+	err = stub.SetEvent(PollFinalizedEvent, eventAsBytes)
+	if err != nil {
+		return "", fmt.Errorf("发出链码事件失败 %s", err)
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("无法将计票结果转换为Json字符串")
+	}
+	return string(resultAsBytes), nil
+}
+
+// 查询计票结果
+// 入参列表
+//
+//	poll_id 投票ID
+//
+// 范例 ["query", "getResult", "2024-board"]
+func getResult(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 1)
+	if err != nil {
+		return "", err
+	}
+
+	result := PollResult{}
+	found, err := state.GetCompositeJSON(stub, resultObjectType, []string{args[0]}, &result)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("投票还没有计票 %s", args[0])
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("无法将计票结果转换为Json字符串")
+	}
+	return string(resultAsBytes), nil
+}
@@ -0,0 +1,140 @@
+package vote
+
+import (
+	"fmt"
+)
+
+// 计票后投票的结果
+const (
+	OutcomePassed   = "passed"    // 通过 有唯一的胜出者并且满足全部规则
+	OutcomeFailed   = "failed"    // 不通过 没有人得票 平票或者得票比例不足
+	OutcomeNoQuorum = "no-quorum" // 参与量没有达到法定人数
+)
+
+// 比较得票比例时的容差 得票比例要求按四位小数书写 例如三分之二写作 0.6667
+const thresholdTolerance = 1e-4
+
+// 平票的处理方式
+const (
+	TieFail           = "fail"            // 平票时投票不通过
+	TieCandidateOrder = "candidate_order" // 候选人列表中靠前的候选人胜出
+)
+
+// 投票通过的规则 创建投票时设置 之后不能修改
+type Rules struct {
+	Quorum    float64 `json:"quorum"`    // 法定人数 最低的选票数量 weighted 为总权重 包含委托的选票 为0时不要求
+	Threshold float64 `json:"threshold"` // 胜出者需要达到的得票比例 0到1之间 例如 0.5 表示至少半数 0.6667 表示至少三分之二 为0时得票最多即可
+	Strict    bool    `json:"strict"`    // 得票比例需要超过 threshold 而不是达到 例如 threshold 0.5 时表示过半
+	TieBreak  string  `json:"tie_break"` // 参考常量定义 平票的处理方式 为空时为 fail
+}
+
+// 计票结果按规则得出的结论 以及使用的数据
+type Outcome struct {
+	Status      string  `json:"status"`       // 参考常量定义 投票的结果
+	Winner      string  `json:"winner"`       // 通过时的胜出者
+	Turnout     float64 `json:"turnout"`      // 参与量 等于计票结果的 total_weight
+	Quorum      float64 `json:"quorum"`       // 使用的法定人数
+	WinnerVotes float64 `json:"winner_votes"` // 胜出者在最后一轮的得票
+	ValidVotes  float64 `json:"valid_votes"`  // 计算得票比例的分母 approval 为参与量 其他为最后一轮候选人得票之和
+	Share       float64 `json:"share"`        // 胜出者的得票比例
+	Threshold   float64 `json:"threshold"`    // 使用的得票比例要求
+	Strict      bool    `json:"strict"`       // 得票比例是否需要超过要求
+	TieBreak    string  `json:"tie_break"`    // 使用的平票处理方式
+	TieBroken   bool    `json:"tie_broken"`   // 胜出者是否由平票处理方式决定
+	Reason      string  `json:"reason"`       // 没有通过的原因
+}
+
+// 校验规则并补齐默认值
+func (r *Rules) validate() error {
+	if r.Quorum < 0 {
+		return fmt.Errorf("法定人数不能为负数  %v", r.Quorum)
+	}
+	if r.Threshold < 0 || r.Threshold > 1 {
+		return fmt.Errorf("得票比例需要在0到1之间  %v", r.Threshold)
+	}
+	if r.TieBreak == "" {
+		r.TieBreak = TieFail
+	}
+	if r.TieBreak != TieFail && r.TieBreak != TieCandidateOrder {
+		return fmt.Errorf("不支持的平票处理方式 %s", r.TieBreak)
+	}
+	return nil
+}
+
+// 按规则评估计票结果
+// 依次校验法定人数 是否有人得票 平票 得票比例 第一项不满足的规则决定结果
+func (r Rules) evaluate(poll Poll, result PollResult) Outcome {
+	outcome := Outcome{
+		Turnout:   result.TotalWeight,
+		Quorum:    r.Quorum,
+		Threshold: r.Threshold,
+		Strict:    r.Strict,
+		TieBreak:  r.TieBreak,
+	}
+	if outcome.TieBreak == "" {
+		outcome.TieBreak = TieFail
+	}
+
+	if outcome.Turnout < r.Quorum {
+		outcome.Status = OutcomeNoQuorum
+		outcome.Reason = fmt.Sprintf("参与量 %v 低于法定人数 %v", outcome.Turnout, r.Quorum)
+		return outcome
+	}
+
+	last := Round{}
+	if len(result.Rounds) > 0 {
+		last = result.Rounds[len(result.Rounds)-1]
+	}
+	for _, t := range last.Tallies {
+		outcome.ValidVotes += t.Votes
+	}
+	if poll.Method == Approval {
+		outcome.ValidVotes = result.TotalWeight
+	}
+
+	if len(result.Winners) == 0 {
+		outcome.Status = OutcomeFailed
+		outcome.Reason = "没有候选人得票"
+		return outcome
+	}
+
+	// 计票结果中的胜出者按候选人的顺序排列 第一个就是候选人列表中靠前的
+	winner := result.Winners[0]
+	if len(result.Winners) > 1 {
+		if outcome.TieBreak == TieFail {
+			outcome.Status = OutcomeFailed
+			outcome.Reason = fmt.Sprintf("候选人平票 %v", result.Winners)
+			return outcome
+		}
+		outcome.TieBroken = true
+	}
+
+	for _, t := range last.Tallies {
+		if t.Candidate == winner {
+			outcome.WinnerVotes = t.Votes
+		}
+	}
+	outcome.Share = outcome.WinnerVotes / outcome.ValidVotes
+
+	if !r.reached(outcome.Share) {
+		outcome.Status = OutcomeFailed
+		if r.Strict {
+			outcome.Reason = fmt.Sprintf("得票比例 %v 没有超过要求的 %v", outcome.Share, r.Threshold)
+		} else {
+			outcome.Reason = fmt.Sprintf("得票比例 %v 低于要求的 %v", outcome.Share, r.Threshold)
+		}
+		return outcome
+	}
+
+	outcome.Status = OutcomePassed
+	outcome.Winner = winner
+	return outcome
+}
+
+// 得票比例是否满足要求 按容差比较 避免 0.6667 这样的书写误差使三分之二的得票不通过
+func (r Rules) reached(share float64) bool {
+	if r.Strict {
+		return share > r.Threshold+thresholdTolerance
+	}
+	return share >= r.Threshold-thresholdTolerance
+}
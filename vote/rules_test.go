@@ -0,0 +1,60 @@
+package vote
+
+import (
+	"testing"
+)
+
+// 一轮计票的结果 候选人按顺序得票
+func plurality(votes ...float64) PollResult {
+	result := PollResult{Winners: []string{}}
+	round := Round{Round: 1}
+	best := 0.0
+	for i, v := range votes {
+		candidate := string(rune('a' + i))
+		round.Tallies = append(round.Tallies, CandidateTally{Candidate: candidate, Votes: v})
+		result.TotalWeight += v
+		switch {
+		case v > best:
+			best = v
+			result.Winners = []string{candidate}
+		case v == best && v > 0:
+			result.Winners = append(result.Winners, candidate)
+		}
+	}
+	result.Rounds = []Round{round}
+	return result
+}
+
+func TestRulesEvaluate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      Rules
+		result     PollResult
+		wantStatus string
+		wantWinner string
+	}{
+		{"三分之二写作0.6667 二比一通过", Rules{Threshold: 0.6667}, plurality(2, 1), OutcomePassed, "a"},
+		{"三分之二写作0.667 二比一不通过", Rules{Threshold: 0.667}, plurality(2, 1), OutcomeFailed, ""},
+		{"三分之二写作0.6667 十比六不通过", Rules{Threshold: 0.6667}, plurality(10, 6), OutcomeFailed, ""},
+		{"至少半数 恰好一半通过", Rules{Threshold: 0.5}, plurality(2, 1, 1), OutcomePassed, "a"},
+		{"过半 恰好一半不通过", Rules{Threshold: 0.5, Strict: true}, plurality(2, 1, 1), OutcomeFailed, ""},
+		{"过半 超过一半通过", Rules{Threshold: 0.5, Strict: true}, plurality(3, 2), OutcomePassed, "a"},
+		{"全部同意", Rules{Threshold: 1}, plurality(3, 0), OutcomePassed, "a"},
+		{"法定人数", Rules{Quorum: 4, Threshold: 0.5}, plurality(2, 1), OutcomeNoQuorum, ""},
+		{"平票", Rules{TieBreak: TieFail}, plurality(1, 1), OutcomeFailed, ""},
+		{"平票时靠前的候选人胜出", Rules{TieBreak: TieCandidateOrder}, plurality(1, 1), OutcomePassed, "a"},
+		{"没有选票", Rules{}, plurality(0, 0), OutcomeFailed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome := tt.rules.evaluate(Poll{Method: Plurality}, tt.result)
+			if outcome.Status != tt.wantStatus || outcome.Winner != tt.wantWinner {
+				t.Errorf("outcome = %+v, want %s %q", outcome, tt.wantStatus, tt.wantWinner)
+			}
+			if outcome.Strict != tt.rules.Strict || outcome.Threshold != tt.rules.Threshold {
+				t.Errorf("outcome 没有记录使用的规则 %+v", outcome)
+			}
+		})
+	}
+}
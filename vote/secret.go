@@ -0,0 +1,265 @@
+package vote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 秘密投票的流程
+// 1.投票期内投票者提交承诺 sha256(选票内容 + ":" + 盐) 的十六进制 账本中只有哈希
+// 2.投票结束后的公布期内 投票者公布选票内容和盐 校验通过后才写入选票并计票
+// 3.公布期结束后才可以查询得票和计票 没有公布的承诺不计入结果
+// 盐需要是足够长的随机字符串 否则可以通过枚举候选人反推出选票
+
+// 投票者的承诺
+type Commitment struct {
+	PollID   string `json:"poll_id"`  // 投票ID
+	Voter    string `json:"voter"`    // 投票者 参考 voterID
+	MSPID    string `json:"msp_id"`   // 投票者的MSP ID
+	Hash     string `json:"hash"`     // 选票内容和盐的sha256
+	TxID     string `json:"tx_id"`    // 最后一次提交承诺的交易ID
+	Time     string `json:"time"`     // 最后一次提交承诺的时间
+	Changes  int    `json:"changes"`  // 修改承诺的次数
+	Revealed bool   `json:"revealed"` // 是否已经公布
+}
+
+var commitmentHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// 承诺的哈希 choice 与公布时传入的选票内容完全一致
+func CommitmentHash(choice string, salt string) string {
+	sum := sha256.Sum256([]byte(choice + ":" + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+// 读取秘密投票的投票定义
+func getSecretPoll(stub shim.ChaincodeStubInterface, pollID string) (Poll, error) {
+	poll, err := getPoll(stub, pollID)
+	if err != nil {
+		return Poll{}, err
+	}
+	if !poll.Secret {
+		return Poll{}, fmt.Errorf("投票 %s 不是秘密投票 请使用 voteUser", pollID)
+	}
+	return poll, nil
+}
+
+// 秘密投票在公布期结束之前不能查询得票
+func requireTalliesVisible(stub shim.ChaincodeStubInterface, poll Poll) error {
+	if !poll.Secret {
+		return nil
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return err
+	}
+	if poll.status(now) != PollClosed {
+		return fmt.Errorf("投票 %s 是秘密投票 公布期结束之后才能查询得票 公布期结束时间 %s", poll.PollID, poll.RevealEndTime)
+	}
+	return nil
+}
+
+// 提交秘密投票的承诺
+// 投票允许改票时可以在投票结束前重新提交 哈希不能与其他投票者的承诺相同 防止照抄别人的承诺
+// 入参列表
+//
+//	poll_id 投票ID
+//	hash 选票内容和盐的sha256 参考 CommitmentHash
+//
+// 范例 ["invoke", "commitVote", "2024-board", "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"]
+func commitVote(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+	if !commitmentHash.MatchString(args[1]) {
+		return "", fmt.Errorf("承诺需要是64位小写十六进制的sha256  %s", args[1])
+	}
+
+	poll, err := getSecretPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+	poll, err = getOpenPoll(stub, poll.PollID)
+	if err != nil {
+		return "", err
+	}
+	err = poll.Eligibility.check(stub)
+	if err != nil {
+		return "", err
+	}
+
+	voter, err := voterID(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	owner := ""
+	found, err := state.GetCompositeJSON(stub, commitHashObjectType, []string{poll.PollID, args[1]}, &owner)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return "", fmt.Errorf("承诺已经被提交过 %s", args[1])
+	}
+
+	commitment := Commitment{}
+	found, err = state.GetCompositeJSON(stub, commitObjectType, []string{poll.PollID, voter}, &commitment)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		if !poll.AllowChange {
+			return "", fmt.Errorf("已经在投票 %s 中投过票 不允许改票", poll.PollID)
+		}
+		key, err := stub.CreateCompositeKey(commitHashObjectType, []string{poll.PollID, commitment.Hash})
+		if err != nil {
+			return "", fmt.Errorf("创建复合键失败 %s %s", commitHashObjectType, commitment.Hash)
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return "", fmt.Errorf("删除账本状态失败 %s", key)
+		}
+		commitment.Changes++
+	} else {
+		mspID, err := cid.GetMSPID(stub)
+		if err != nil {
+			return "", fmt.Errorf("获取调用者MSP ID失败")
+		}
+		commitment = Commitment{PollID: poll.PollID, Voter: voter, MSPID: mspID}
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+	commitment.Hash = args[1]
+	commitment.TxID = stub.GetTxID()
+	commitment.Time = now.Format(time.RFC3339)
+
+	err = state.PutCompositeJSON(stub, commitObjectType, []string{poll.PollID, voter}, commitment)
+	if err != nil {
+		return "", err
+	}
+	err = state.PutCompositeJSON(stub, commitHashObjectType, []string{poll.PollID, args[1]}, voter)
+	if err != nil {
+		return "", err
+	}
+
+	commitmentAsBytes, err := json.Marshal(commitment)
+	if err != nil {
+		return "", fmt.Errorf("无法将承诺转换为Json字符串")
+	}
+	return string(commitmentAsBytes), nil
+}
+
+// 在公布期公布秘密投票的选票
+// 选票内容和盐需要与提交的承诺一致 公布后写入选票并计票 每个承诺只能公布一次
+// 入参列表
+//
+//	poll_id 投票ID
+//	choice 选票内容 与 voteUser 的 username 写法相同
+//	salt 提交承诺时使用的盐
+//
+// 范例 ["invoke", "revealVote", "2024-board", "alice", "f3a9c0d2e8b14c6f"]
+func revealVote(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 3)
+	if err != nil {
+		return "", err
+	}
+
+	poll, err := getSecretPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+	switch poll.status(now) {
+	case PollPending, PollOpen:
+		return "", fmt.Errorf("投票 %s 还没有进入公布期 公布期开始时间 %s", poll.PollID, poll.EndTime)
+	case PollClosed:
+		return "", fmt.Errorf("投票 %s 的公布期已经结束 公布期结束时间 %s", poll.PollID, poll.RevealEndTime)
+	}
+
+	voter, err := voterID(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	commitment := Commitment{}
+	found, err := state.GetCompositeJSON(stub, commitObjectType, []string{poll.PollID, voter}, &commitment)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("投票者没有在投票 %s 中提交承诺", poll.PollID)
+	}
+	if commitment.Revealed {
+		return "", fmt.Errorf("投票者已经公布过选票")
+	}
+	if CommitmentHash(args[1], args[2]) != commitment.Hash {
+		return "", fmt.Errorf("选票内容和盐与承诺不一致")
+	}
+
+	choices, err := poll.parseChoices(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	receipt, err := recordVote(stub, poll, choices)
+	if err != nil {
+		return "", err
+	}
+
+	commitment.Revealed = true
+	err = state.PutCompositeJSON(stub, commitObjectType, []string{poll.PollID, voter}, commitment)
+	if err != nil {
+		return "", err
+	}
+
+	receiptAsBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return "", fmt.Errorf("无法将投票回执转换为Json字符串")
+	}
+	return string(receiptAsBytes), nil
+}
+
+// 统计没有公布的承诺数量
+func countUnrevealed(stub shim.ChaincodeStubInterface, pollID string) (int, error) {
+	resultIterator, err := stub.GetStateByPartialCompositeKey(commitObjectType, []string{pollID})
+	if err != nil {
+		return 0, fmt.Errorf("获取承诺失败 %s", pollID)
+	}
+	defer resultIterator.Close()
+
+	unrevealed := 0
+	for resultIterator.HasNext() {
+		queryResult, err := resultIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("获取承诺失败 %s", pollID)
+		}
+
+		commitment := Commitment{}
+		err = json.Unmarshal(queryResult.Value, &commitment)
+		if err != nil {
+			return 0, fmt.Errorf("json串转换为对象失败 %s", queryResult.Key)
+		}
+		if !commitment.Revealed {
+			unrevealed++
+		}
+	}
+
+	return unrevealed, nil
+}
@@ -0,0 +1,237 @@
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/state"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+)
+
+// 得票的排序方式
+const (
+	OrderByCandidate = "candidate" // 按投票定义中候选人的顺序
+	OrderByVotes     = "votes"     // 按得票数从高到低 weighted 按加权得票 得票相同时按候选人的顺序
+)
+
+// 一页得票
+type TallyPage struct {
+	PollID   string `json:"poll_id"`  // 投票ID
+	Total    int    `json:"total"`    // 候选人总数
+	Tallies  []Vote `json:"tallies"`  // 本页候选人的得票
+	Bookmark string `json:"bookmark"` // 下一页第一个候选人 为空表示没有下一页
+}
+
+// 读取投票中全部候选人的得票 只读取候选人列表对应的键 没有得票的候选人票数为0
+func getTallies(stub shim.ChaincodeStubInterface, poll Poll, order string) ([]Vote, error) {
+	tallies, err := readTallies(stub, poll.PollID, poll.Candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	if order == OrderByVotes {
+		sort.SliceStable(tallies, func(i, j int) bool {
+			if poll.Method == Weighted {
+				return tallies[i].Weight > tallies[j].Weight
+			}
+			return tallies[i].Votenum > tallies[j].Votenum
+		})
+	}
+
+	return tallies, nil
+}
+
+// 按顺序读取候选人的得票
+func readTallies(stub shim.ChaincodeStubInterface, pollID string, candidates []string) ([]Vote, error) {
+	tallies := []Vote{}
+	for _, candidate := range candidates {
+		vote := Vote{PollID: pollID, Username: candidate}
+		_, err := state.GetCompositeJSON(stub, voteObjectType, []string{pollID, candidate}, &vote)
+		if err != nil {
+			return nil, err
+		}
+		tallies = append(tallies, vote)
+	}
+	return tallies, nil
+}
+
+func parseCount(value string, name string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无法将%s转换为非负整数 %s", name, value)
+	}
+	return n, nil
+}
+
+// 分页查询投票中候选人的得票
+// 按候选人顺序分页时只读取本页候选人的得票键
+// 没有得票的候选人没有得票键 候选人顺序也不是键的字典序 所以按投票定义中的候选人列表分页 不使用复合键的分页查询
+// 按得票排序时每页都读取全部候选人并重新排序 bookmark 是下一页第一个候选人
+// 翻页期间得票发生变化时排序会改变 后面的页可能跳过或重复候选人 需要一致的结果时在投票结束之后查询或者不分页
+// 入参列表
+//
+//	poll_id 投票ID
+//	page_size 每页的候选人数量 可选 默认0 表示不分页
+//	bookmark 第一页传空字符串 之后传上一页返回的 bookmark 可选
+//	order 排序方式 可选 candidate/votes 默认 candidate
+//
+// 范例 ["query", "getUserVote", "2024-board"]
+// 范例 ["query", "getUserVote", "2024-board", "10", "", "votes"]
+func getUserVote(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Between(args, 1, 4)
+	if err != nil {
+		return "", err
+	}
+
+	pageSize, err := parseCount(params.Optional(args, 1, "0"), "每页数量")
+	if err != nil {
+		return "", err
+	}
+	bookmark := params.Optional(args, 2, "")
+	order := params.Optional(args, 3, OrderByCandidate)
+	if order != OrderByCandidate && order != OrderByVotes {
+		return "", fmt.Errorf("排序方式错误 %s", order)
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+	err = requireTalliesVisible(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	// 按排序方式排列的候选人 按得票排序时已经读取了全部得票
+	candidates := poll.Candidates
+	var sorted []Vote
+	if order == OrderByVotes {
+		sorted, err = getTallies(stub, poll, order)
+		if err != nil {
+			return "", err
+		}
+		candidates = []string{}
+		for _, tally := range sorted {
+			candidates = append(candidates, tally.Username)
+		}
+	}
+
+	start := 0
+	if bookmark != "" {
+		start = -1
+		for i, candidate := range candidates {
+			if candidate == bookmark {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return "", fmt.Errorf("bookmark 不是投票 %s 的候选人 %s", poll.PollID, bookmark)
+		}
+	}
+
+	end := len(candidates)
+	page := TallyPage{PollID: poll.PollID, Total: len(candidates)}
+	if pageSize > 0 && end-start > pageSize {
+		end = start + pageSize
+		page.Bookmark = candidates[end]
+	}
+
+	if sorted != nil {
+		page.Tallies = sorted[start:end]
+	} else {
+		page.Tallies, err = readTallies(stub, poll.PollID, candidates[start:end])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	pageAsBytes, err := json.Marshal(page)
+	if err != nil {
+		return "", fmt.Errorf("无法将得票转换为Json字符串")
+	}
+	return string(pageAsBytes), nil
+}
+
+// 查询得票最多的前n个候选人 得票相同时按候选人的顺序
+// 入参列表
+//
+//	poll_id 投票ID
+//	n 候选人数量
+//
+// 范例 ["query", "getTopCandidates", "2024-board", "3"]
+func getTopCandidates(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	n, err := parseCount(args[1], "候选人数量")
+	if err != nil {
+		return "", err
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+	err = requireTalliesVisible(stub, poll)
+	if err != nil {
+		return "", err
+	}
+
+	tallies, err := getTallies(stub, poll, OrderByVotes)
+	if err != nil {
+		return "", err
+	}
+	if len(tallies) > n {
+		tallies = tallies[:n]
+	}
+
+	talliesAsBytes, err := json.Marshal(tallies)
+	if err != nil {
+		return "", fmt.Errorf("无法将得票转换为Json字符串")
+	}
+	return string(talliesAsBytes), nil
+}
+
+// 查询一个候选人的得票
+// 入参列表
+//
+//	poll_id 投票ID
+//	username 候选人
+//
+// 范例 ["query", "getCandidateVote", "2024-board", "alice"]
+func getCandidateVote(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	poll, err := getPoll(stub, args[0])
+	if err != nil {
+		return "", err
+	}
+	err = requireTalliesVisible(stub, poll)
+	if err != nil {
+		return "", err
+	}
+	if !poll.hasCandidate(args[1]) {
+		return "", fmt.Errorf("候选人不在投票 %s 的候选人列表中 %s", poll.PollID, args[1])
+	}
+
+	vote := Vote{PollID: poll.PollID, Username: args[1]}
+	_, err = state.GetCompositeJSON(stub, voteObjectType, []string{poll.PollID, args[1]}, &vote)
+	if err != nil {
+		return "", err
+	}
+
+	voteAsBytes, err := json.Marshal(vote)
+	if err != nil {
+		return "", fmt.Errorf("无法将得票转换为Json字符串")
+	}
+	return string(voteAsBytes), nil
+}
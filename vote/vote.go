@@ -0,0 +1,148 @@
+// Package vote 投票链码
+// 链码入口在 cmd/vote
+package vote
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ForLina/sxc_contract/core/params"
+	"github.com/ForLina/sxc_contract/core/response"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+type VoteChaincode struct {
+}
+
+// 候选人在一次投票中的得票
+type Vote struct {
+	PollID   string  `json:"poll_id"`
+	Username string  `json:"username"`
+	Votenum  int     `json:"votenum"`
+	Weight   float64 `json:"weight"` // 加权得票 只有 weighted 计票方式与 votenum 不同
+}
+
+// 投票成功后返回的回执
+type VoteReceipt struct {
+	PollID    string   `json:"poll_id"`            // 投票ID
+	Candidate string   `json:"candidate"`          // 投给的候选人 ranked 和 approval 为第一个候选人
+	Votenum   int      `json:"votenum"`            // 候选人投票后的得票数 秘密投票时为0
+	Previous  []string `json:"previous,omitempty"` // 改票之前的选票内容
+	Ballot    Ballot   `json:"ballot"`             // 投票者的选票
+}
+
+func (t *VoteChaincode) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+// 按函数名注册的业务函数
+var Functions = map[string]response.Function{
+	"createPoll":         createPoll,
+	"getPoll":            queryPoll,
+	"listPolls":          listPolls,
+	"voteUser":           voteUser,
+	"getBallot":          getBallot,
+	"registerCandidate":  registerCandidate,
+	"approveCandidate":   approveCandidate,
+	"listCandidates":     listCandidates,
+	"getUserVote":        getUserVote,
+	"getTopCandidates":   getTopCandidates,
+	"getCandidateVote":   getCandidateVote,
+	"setVoterWeights":    setVoterWeights,
+	"finalizePoll":       finalizePoll,
+	"getResult":          getResult,
+	"commitVote":         commitVote,
+	"revealVote":         revealVote,
+	"delegate":           delegate,
+	"revokeDelegation":   revokeDelegation,
+	"getDelegationChain": getDelegationChain,
+	"createProposal":     createProposal,
+	"getProposal":        getProposal,
+}
+
+func (t *VoteChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return response.Dispatch(stub, Functions, "Invoke 调用方法有误！")
+}
+
+// 投票给候选人
+// 调用者的身份决定投票者 每个投票者只能投一次 投票允许改票时可以在结束前改投其他候选人
+// 返回投票回执 包含候选人投票后的得票数和选票
+// 入参列表
+//
+//	poll_id 投票ID
+//	username 候选人 ranked 为按偏好排序的候选人数组 approval 为认可的候选人数组
+//
+// 范例 ["invoke", "voteUser", "2024-board", "alice"]
+// 范例 ["invoke", "voteUser", "2024-board", "[\"alice\",\"carol\",\"bob\"]"]
+func voteUser(stub shim.ChaincodeStubInterface, args []string) (string, error) {
+	err := params.Count(args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	pollID := args[0]
+	username := args[1]
+	if pollID == "" || username == "" {
+		return "", fmt.Errorf("投票ID和候选人不能为空")
+	}
+
+	poll, err := getOpenPoll(stub, pollID)
+	if err != nil {
+		return "", err
+	}
+	choices, err := poll.parseChoices(username)
+	if err != nil {
+		return "", err
+	}
+	err = poll.Eligibility.check(stub)
+	if err != nil {
+		return "", err
+	}
+
+	if poll.Secret {
+		return "", fmt.Errorf("投票 %s 是秘密投票 需要先 commitVote 再 revealVote", pollID)
+	}
+
+	receipt, err := recordVote(stub, poll, choices)
+	if err != nil {
+		return "", err
+	}
+
+	receiptAsBytes, err := json.Marshal(receipt)
+	if err != nil {
+		return "", fmt.Errorf("无法将投票回执转换为Json字符串")
+	}
+	return string(receiptAsBytes), nil
+}
+
+// 写入选票并更新得票 返回投票回执
+// 每个投票者只有一张选票 改票时从原来的候选人处减去原来的选票
+func recordVote(stub shim.ChaincodeStubInterface, poll Poll, choices []string) (VoteReceipt, error) {
+	ballot, previous, err := castBallot(stub, poll, choices)
+	if err != nil {
+		return VoteReceipt{}, err
+	}
+	receipt := VoteReceipt{PollID: poll.PollID, Candidate: ballot.Candidate, Ballot: ballot}
+	if previous != nil {
+		receipt.Previous = previous.choices()
+		for _, candidate := range poll.countedChoices(previous.choices()) {
+			_, err = addVotes(stub, poll.PollID, candidate, -1, -previous.weight())
+			if err != nil {
+				return VoteReceipt{}, err
+			}
+		}
+	}
+
+	for _, candidate := range poll.countedChoices(choices) {
+		vote, err := addVotes(stub, poll.PollID, candidate, 1, ballot.Weight)
+		if err != nil {
+			return VoteReceipt{}, err
+		}
+		// 秘密投票在公布期结束之前不公开得票
+		if candidate == ballot.Candidate && !poll.Secret {
+			receipt.Votenum = vote.Votenum
+		}
+	}
+
+	return receipt, nil
+}
@@ -0,0 +1,309 @@
+package vote_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ForLina/sxc_contract/scenario"
+	"github.com/ForLina/sxc_contract/vote"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+type obj = map[string]interface{}
+
+func text(s string) *string {
+	return &s
+}
+
+// 执行场景 每个失败的步骤记录一个错误
+func runScenario(t *testing.T, s scenario.Scenario) {
+	t.Helper()
+
+	result := scenario.Run(s)
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	for _, step := range result.Steps {
+		if step.Err != nil {
+			t.Errorf("%s: %v", step.Name, step.Err)
+		}
+	}
+}
+
+// 投票期 2100-01-01 到 2100-01-10
+const (
+	beforeOpen = "2099-12-31T00:00:00Z"
+	open       = "2100-01-05T00:00:00Z"
+	closed     = "2100-01-11T00:00:00Z"
+)
+
+func poll(extra string) string {
+	return `{"poll_id":"p","title":"测试","candidates":["alice","bob"],"start_time":"2100-01-01T00:00:00Z","end_time":"2100-01-10T00:00:00Z"` + extra + `}`
+}
+
+// 按顺序调用每个函数 先校验参数和状态错误 再完成一次正常流程
+func TestVoteFunctions(t *testing.T) {
+	salt := "f3a9c0d2e8b14c6f"
+
+	runScenario(t, scenario.Scenario{
+		Chaincode: "vote",
+		Creator:   "Org1MSP",
+		Init:      []string{"init"},
+		// 按权重计票的投票按学号识别投票者 权重登记在学号上
+		Attributes: map[string]map[string]string{"Org1MSP/u1": {"student_id": "S1"}},
+		Steps: []scenario.Step{
+			{Name: "未注册的函数", Args: []string{"transfer"}, Error: "Invoke 调用方法有误"},
+
+			{Name: "createPoll 参数数目", Args: []string{"createPoll"}, Error: "需要 1 个参数"},
+			{Name: "createPoll 格式", Args: []string{"createPoll", "{"}, Error: "无法将投票定义转换为投票对象"},
+			{Name: "createPoll 计票方式", Args: []string{"createPoll", poll(`,"method":"borda"`)}, Error: "不支持的计票方式"},
+			{Name: "createPoll 得票比例", Args: []string{"createPoll", poll(`,"rules":{"threshold":2}`)}, Error: "得票比例需要在0到1之间"},
+			{Name: "createPoll", Args: []string{"createPoll", poll(`,"rules":{"quorum":2,"threshold":0.5},"topic":"board"`)}, Payload: text("p")},
+			{Name: "createPoll 投票ID重复", Args: []string{"createPoll", poll("")}, Error: "投票已经存在"},
+			{Name: "createPoll 秘密投票", Args: []string{"createPoll", `{"poll_id":"s","title":"秘密","candidates":["alice","bob"],"start_time":"2100-01-01T00:00:00Z","end_time":"2100-01-10T00:00:00Z","secret":true,"reveal_end_time":"2100-01-12T00:00:00Z"}`}, Payload: text("s")},
+			{Name: "createPoll 候选人报名", Args: []string{"createPoll", `{"poll_id":"c","title":"报名","start_time":"2100-01-01T00:00:00Z","end_time":"2100-01-10T00:00:00Z"}`}, Payload: text("c")},
+			{Name: "createPoll 按权重计票", Args: []string{"createPoll", poll(`,"poll_id":"w","method":"weighted","voter_attribute":"student_id"`)}, Payload: text("w")},
+
+			{Name: "getPoll 参数数目", Args: []string{"getPoll"}, Error: "需要 1 个参数"},
+			{Name: "getPoll 投票不存在", Args: []string{"getPoll", "none"}, Error: "投票不存在"},
+			{Name: "getPoll", Time: beforeOpen, Args: []string{"getPoll", "p"}, JSON: obj{"poll_id": "p", "method": "plurality", "topic": "board"}},
+			{Name: "listPolls 状态", Args: []string{"listPolls", "done"}, Error: "投票状态错误 done"},
+			{Name: "listPolls", Time: beforeOpen, Args: []string{"listPolls", "pending"}, JSON: []interface{}{obj{"poll_id": "c"}, obj{"poll_id": "p"}, obj{"poll_id": "s"}, obj{"poll_id": "w"}}},
+
+			{Name: "registerCandidate 参数数目", Args: []string{"registerCandidate", "c"}, Error: "需要 2 个参数"},
+			{Name: "registerCandidate", Time: beforeOpen, Creator: "Org1MSP/alice", Args: []string{"registerCandidate", "c", `{"candidate_id":"alice","name":"Alice"}`}, Payload: text("alice")},
+			{Name: "approveCandidate 参数", Time: beforeOpen, Args: []string{"approveCandidate", "c", "alice", "2"}, Error: "审核结果错误 需要是 1 或 0"},
+			{Name: "approveCandidate", Time: beforeOpen, Args: []string{"approveCandidate", "c", "alice", "1"}, Payload: text("approved")},
+			{Name: "listCandidates", Time: beforeOpen, Args: []string{"listCandidates", "c"}, JSON: []interface{}{obj{"candidate_id": "alice", "status": "approved"}}},
+
+			{Name: "setVoterWeights 非权重投票", Time: beforeOpen, Args: []string{"setVoterWeights", "p", `{"Org1MSP/S1":2}`}, Error: "投票 p 的计票方式是 plurality 不使用权重"},
+			{Name: "setVoterWeights", Time: beforeOpen, Args: []string{"setVoterWeights", "w", `{"Org1MSP/S1":3}`}},
+
+			{Name: "voteUser 投票尚未开始", Time: beforeOpen, Args: []string{"voteUser", "p", "alice"}, Error: "投票尚未开始"},
+			{Name: "voteUser 候选人不在列表中", Time: open, Args: []string{"voteUser", "p", "carol"}, Error: "候选人不在投票 p 的候选人列表中"},
+			{Name: "voteUser", Time: open, Creator: "Org1MSP/u1", Args: []string{"voteUser", "p", "alice"}, JSON: obj{"poll_id": "p", "candidate": "alice", "votenum": 1}},
+			{Name: "voteUser 重复投票", Time: open, Creator: "Org1MSP/u1", Args: []string{"voteUser", "p", "bob"}, Error: "已经在投票 p 中投过票"},
+			{Time: open, Creator: "Org1MSP/u2", Args: []string{"voteUser", "p", "alice"}},
+			{Time: open, Creator: "Org1MSP/u1", Args: []string{"voteUser", "w", "bob"}},
+			{Name: "getBallot", Time: open, Creator: "Org1MSP/u1", Args: []string{"getBallot", "p"}, JSON: obj{"candidate": "alice"}},
+			{Name: "getBallot 没有投过票", Time: open, Creator: "Org1MSP/u3", Args: []string{"getBallot", "p"}, Error: "没有找到投票者的选票"},
+
+			{Name: "delegate 范围", Time: open, Args: []string{"delegate", "all", "p", "Org1MSP/u1"}, Error: "委托范围错误 需要是 poll 或 topic"},
+			{Name: "delegate", Time: open, Creator: "Org1MSP/u4", Args: []string{"delegate", "poll", "p", "Org1MSP/u5"}},
+			{Name: "getDelegationChain", Time: open, Creator: "Org1MSP/u4", Args: []string{"getDelegationChain", "p"}, JSON: []interface{}{obj{"status": "unresolved", "resolved": ""}}},
+			{Name: "revokeDelegation", Time: open, Creator: "Org1MSP/u4", Args: []string{"revokeDelegation", "poll", "p"}},
+			{Name: "revokeDelegation 没有委托", Time: open, Creator: "Org1MSP/u4", Args: []string{"revokeDelegation", "poll", "p"}, Error: "没有找到委托 poll p"},
+
+			{Name: "commitVote 哈希格式", Time: open, Args: []string{"commitVote", "s", "abc"}, Error: "承诺需要是64位小写十六进制的sha256"},
+			{Name: "commitVote 不是秘密投票", Time: open, Args: []string{"commitVote", "p", vote.CommitmentHash("alice", salt)}, Error: "不是秘密投票"},
+			{Name: "commitVote", Time: open, Args: []string{"commitVote", "s", vote.CommitmentHash("alice", salt)}, JSON: obj{"hash": vote.CommitmentHash("alice", salt), "revealed": false}},
+			{Name: "getUserVote 秘密投票公布期之前", Time: open, Args: []string{"getUserVote", "s"}, Error: "公布期结束之后才能查询得票"},
+			{Name: "revealVote 投票期内", Time: open, Args: []string{"revealVote", "s", "alice", salt}, Error: "还没有进入公布期"},
+			{Name: "revealVote 盐不一致", Time: closed, Args: []string{"revealVote", "s", "alice", "x"}, Error: "选票内容和盐与承诺不一致"},
+			{Name: "revealVote", Time: closed, Args: []string{"revealVote", "s", "alice", salt}, JSON: obj{"poll_id": "s", "candidate": "alice"}},
+
+			{Name: "getUserVote", Time: open, Args: []string{"getUserVote", "p"}, JSON: obj{"total": 2, "tallies": []interface{}{obj{"username": "alice", "votenum": 2}, obj{"username": "bob", "votenum": 0}}}},
+			{Name: "getTopCandidates 数量", Time: open, Args: []string{"getTopCandidates", "p", "x"}, Error: "x"},
+			{Name: "getTopCandidates", Time: open, Args: []string{"getTopCandidates", "p", "1"}, JSON: []interface{}{obj{"username": "alice", "votenum": 2}}},
+			{Name: "getCandidateVote", Time: open, Args: []string{"getCandidateVote", "p", "alice"}, JSON: obj{"username": "alice", "votenum": 2}},
+
+			{Name: "finalizePoll 投票期内", Time: open, Args: []string{"finalizePoll", "p"}, Error: "投票还没有结束"},
+			{Name: "getResult 还没有计票", Time: closed, Args: []string{"getResult", "p"}, Error: "还没有计票"},
+			{Name: "finalizePoll", Time: closed, Args: []string{"finalizePoll", "p"}, JSON: obj{"winners": []interface{}{"alice"}, "outcome": obj{"status": "passed", "winner": "alice"}},
+				Event: &scenario.EventExpectation{Name: vote.PollFinalizedEvent, Value: obj{"poll_id": "p", "topic": "board"}}},
+			{Name: "finalizePoll 重复计票", Time: closed, Args: []string{"finalizePoll", "p"}, Error: "已经计票"},
+			{Name: "getResult", Time: closed, Args: []string{"getResult", "p"}, JSON: obj{"winners": []interface{}{"alice"}}},
+			{Name: "finalizePoll 按权重计票", Time: closed, Args: []string{"finalizePoll", "w"}, JSON: obj{"total_weight": 3}},
+
+			{Name: "createProposal 参数数目", Args: []string{"createProposal", poll("")}, Error: "需要 2 个参数"},
+			{Name: "createProposal 候选人", Args: []string{"createProposal", poll(""), `{"parameter":"roles","roles":{"platform_msps":["Org1MSP"],"admin_msps":["Org1MSP"]}}`}, Error: "不能设置候选人"},
+			{Name: "getProposal 提案不存在", Args: []string{"getProposal", "none"}, Error: "提案不存在 none"},
+		},
+	})
+}
+
+// 写入指定类型的复合键时失败的 stub
+type failingStub struct {
+	shim.ChaincodeStubInterface
+	objectType string
+}
+
+func (s failingStub) PutState(key string, value []byte) error {
+	if strings.HasPrefix(key, "\x00"+s.objectType+"\x00") {
+		return fmt.Errorf("写入失败")
+	}
+	return s.ChaincodeStubInterface.PutState(key, value)
+}
+
+// 调用投票链码时把 stub 换成 failingStub objectType 为空时不替换
+type failingChaincode struct {
+	vote.VoteChaincode
+	objectType string
+}
+
+func (c *failingChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	if c.objectType != "" {
+		stub = failingStub{stub, c.objectType}
+	}
+	return c.VoteChaincode.Invoke(stub)
+}
+
+func invoke(t *testing.T, stub *shimtest.MockStub, creator string, args ...string) peer.Response {
+	t.Helper()
+
+	identity, err := scenario.CreatorIdentity(creator, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.Creator = identity
+
+	argsAsBytes := [][]byte{}
+	for _, arg := range args {
+		argsAsBytes = append(argsAsBytes, []byte(arg))
+	}
+	return stub.MockInvoke(fmt.Sprintf("tx%d", len(stub.State)), argsAsBytes)
+}
+
+// voteUser 的参数错误 投票不存在 写入账本失败 以及投票回执的内容
+func TestVoteUser(t *testing.T) {
+	// 投票期包含 MockStub 使用的当前时间
+	definition := `{"poll_id":"p","title":"测试","candidates":["alice","bob"],"start_time":"2000-01-01T00:00:00Z","end_time":"2999-01-01T00:00:00Z","allow_change":true}`
+
+	tests := []struct {
+		name       string
+		objectType string // 写入失败的复合键类型
+		args       []string
+		wantErr    string
+	}{
+		{"参数数目", "", []string{"voteUser", "p"}, "需要 2 个参数"},
+		{"投票ID为空", "", []string{"voteUser", "", "alice"}, "投票ID和候选人不能为空"},
+		{"候选人为空", "", []string{"voteUser", "p", ""}, "投票ID和候选人不能为空"},
+		{"投票不存在", "", []string{"voteUser", "none", "alice"}, "投票不存在 none"},
+		{"候选人不在列表中", "", []string{"voteUser", "p", "carol"}, "候选人不在投票 p 的候选人列表中"},
+		{"写入选票失败", "ballot", []string{"voteUser", "p", "alice"}, "写入账本失败"},
+		{"写入得票失败", "vote", []string{"voteUser", "p", "alice"}, "写入账本失败"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chaincode := &failingChaincode{}
+			stub := shimtest.NewMockStub("vote", chaincode)
+			response := invoke(t, stub, "Org1MSP", "createPoll", definition)
+			if response.Status != shim.OK {
+				t.Fatalf("createPoll: %s", response.Message)
+			}
+
+			chaincode.objectType = tt.objectType
+			response = invoke(t, stub, "Org1MSP/u1", tt.args...)
+			if response.Status == shim.OK || !strings.Contains(response.Message, tt.wantErr) {
+				t.Fatalf("status %d message %q, want %q", response.Status, response.Message, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("投票回执", func(t *testing.T) {
+		stub := shimtest.NewMockStub("vote", &failingChaincode{})
+		response := invoke(t, stub, "Org1MSP", "createPoll", definition)
+		if response.Status != shim.OK {
+			t.Fatalf("createPoll: %s", response.Message)
+		}
+
+		invoke(t, stub, "Org1MSP/u2", "voteUser", "p", "bob")
+		for i, candidate := range []string{"alice", "bob"} {
+			response = invoke(t, stub, "Org1MSP/u1", "voteUser", "p", candidate)
+			if response.Status != shim.OK {
+				t.Fatalf("voteUser %s: %s", candidate, response.Message)
+			}
+
+			receipt := vote.VoteReceipt{}
+			err := json.Unmarshal(response.Payload, &receipt)
+			if err != nil {
+				t.Fatalf("投票回执不是Json %s", response.Payload)
+			}
+			if receipt.PollID != "p" || receipt.Candidate != candidate || receipt.Votenum != i+1 {
+				t.Errorf("receipt = %+v", receipt)
+			}
+			ballot := receipt.Ballot
+			if ballot.PollID != "p" || ballot.MSPID != "Org1MSP" || ballot.Candidate != candidate || ballot.Weight != 1 || ballot.Changes != i || ballot.TxID == "" || ballot.Time == "" {
+				t.Errorf("ballot = %+v", ballot)
+			}
+			if i == 1 && (len(receipt.Previous) != 1 || receipt.Previous[0] != "alice") {
+				t.Errorf("previous = %v, want [alice]", receipt.Previous)
+			}
+		}
+	})
+}
+
+// 记录读取过的复合键
+type countingStub struct {
+	shim.ChaincodeStubInterface
+	reads *[]string
+}
+
+func (s countingStub) GetState(key string) ([]byte, error) {
+	_, attributes, err := s.SplitCompositeKey(key)
+	if err == nil && strings.HasPrefix(key, "\x00vote\x00") {
+		*s.reads = append(*s.reads, attributes[len(attributes)-1])
+	}
+	return s.ChaincodeStubInterface.GetState(key)
+}
+
+type countingChaincode struct {
+	vote.VoteChaincode
+	reads []string
+}
+
+func (c *countingChaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	c.reads = nil
+	return c.VoteChaincode.Invoke(countingStub{stub, &c.reads})
+}
+
+// 按候选人顺序分页时只读取本页候选人的得票
+func TestGetUserVotePage(t *testing.T) {
+	chaincode := &countingChaincode{}
+	stub := shimtest.NewMockStub("vote", chaincode)
+	response := invoke(t, stub, "Org1MSP", "createPoll", `{"poll_id":"p","title":"测试","candidates":["e","d","c","b","a"],"start_time":"2000-01-01T00:00:00Z","end_time":"2999-01-01T00:00:00Z"}`)
+	if response.Status != shim.OK {
+		t.Fatalf("createPoll: %s", response.Message)
+	}
+	invoke(t, stub, "Org1MSP/u1", "voteUser", "p", "c")
+
+	tests := []struct {
+		args      []string
+		wantPage  []string
+		wantReads []string
+		bookmark  string
+	}{
+		{[]string{"p", "2"}, []string{"e", "d"}, []string{"e", "d"}, "c"},
+		{[]string{"p", "2", "c"}, []string{"c", "b"}, []string{"c", "b"}, "a"},
+		{[]string{"p", "2", "a"}, []string{"a"}, []string{"a"}, ""},
+		{[]string{"p", "2", "", "votes"}, []string{"c", "e"}, []string{"e", "d", "c", "b", "a"}, "d"},
+	}
+
+	for _, tt := range tests {
+		response = invoke(t, stub, "Org1MSP", append([]string{"getUserVote"}, tt.args...)...)
+		if response.Status != shim.OK {
+			t.Fatalf("getUserVote %v: %s", tt.args, response.Message)
+		}
+
+		page := vote.TallyPage{}
+		err := json.Unmarshal(response.Payload, &page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, tally := range page.Tallies {
+			got = append(got, tally.Username)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.wantPage) || page.Bookmark != tt.bookmark || page.Total != 5 {
+			t.Errorf("getUserVote %v = %v bookmark %q total %d, want %v bookmark %q", tt.args, got, page.Bookmark, page.Total, tt.wantPage, tt.bookmark)
+		}
+		if fmt.Sprint(chaincode.reads) != fmt.Sprint(tt.wantReads) {
+			t.Errorf("getUserVote %v 读取了 %v, want %v", tt.args, chaincode.reads, tt.wantReads)
+		}
+	}
+}